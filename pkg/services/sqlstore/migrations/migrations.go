@@ -49,6 +49,19 @@ func addMigrationLogMigrations(mg *Migrator) {
 	}
 
 	mg.AddMigration("create migration_log table", NewAddTableMigration(migrationLogV1))
+
+	migrationFingerprintV1 := Table{
+		Name: "migration_fingerprint",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "migrations_count", Type: DB_BigInt, Nullable: false},
+			{Name: "last_migration_id", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "checksum", Type: DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "timestamp", Type: DB_DateTime, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create migration_fingerprint table", NewAddTableMigration(migrationFingerprintV1))
 }
 
 func addStarMigrations(mg *Migrator) {
@@ -123,7 +123,7 @@ type AddMissingUserSaltAndRandsMigration struct {
 }
 
 func (m *AddMissingUserSaltAndRandsMigration) Sql(dialect Dialect) string {
-	return "code migration"
+	return CodeMigrationSql
 }
 
 type TempUserDTO struct {
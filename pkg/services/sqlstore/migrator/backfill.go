@@ -0,0 +1,202 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/go-xorm/xorm"
+)
+
+// BackfillColumnMigration sets a column of existing rows to an expression of
+// other columns, e.g. a slug computed from a title after adding the slug
+// column. The expression can be set per dialect, like the sql of a
+// RawSqlMigration, since string functions differ between engines.
+type BackfillColumnMigration struct {
+	MigrationBase
+	tableName  string
+	columnName string
+	expr       map[string]string
+	where      string
+	keyColumn  string
+	batchSize  int64
+}
+
+func NewBackfillColumnMigration(tableName string, columnName string) *BackfillColumnMigration {
+	return &BackfillColumnMigration{tableName: tableName, columnName: columnName, expr: make(map[string]string)}
+}
+
+func (m *BackfillColumnMigration) As(expr string) *BackfillColumnMigration {
+	m.expr["default"] = expr
+	return m
+}
+
+func (m *BackfillColumnMigration) Sqlite(expr string) *BackfillColumnMigration {
+	m.expr[SQLITE] = expr
+	return m
+}
+
+func (m *BackfillColumnMigration) Mysql(expr string) *BackfillColumnMigration {
+	m.expr[MYSQL] = expr
+	return m
+}
+
+func (m *BackfillColumnMigration) Postgres(expr string) *BackfillColumnMigration {
+	m.expr[POSTGRES] = expr
+	return m
+}
+
+// Where restricts the backfill to the rows matching the condition, e.g. to
+// rows where the column is still NULL.
+func (m *BackfillColumnMigration) Where(condition string) *BackfillColumnMigration {
+	m.where = condition
+	return m
+}
+
+// Batch updates the rows in chunks of size consecutive values of an integer
+// key column, see ChunkedExec. This keeps single statements small on large
+// tables, the chunks are still committed together.
+func (m *BackfillColumnMigration) Batch(keyColumn string, size int64) *BackfillColumnMigration {
+	m.keyColumn = keyColumn
+	m.batchSize = size
+	return m
+}
+
+func (m *BackfillColumnMigration) Validate(mg *Migrator) error {
+	if dialectSql(m.expr).forDialect(mg.Dialect) == "" {
+		return fmt.Errorf("backfill of %s.%s has no expression for %s", m.tableName, m.columnName, mg.Dialect.DriverName())
+	}
+	if m.keyColumn != "" && m.batchSize <= 0 {
+		return fmt.Errorf("backfill of %s.%s has invalid batch size %d", m.tableName, m.columnName, m.batchSize)
+	}
+	return nil
+}
+
+func (m *BackfillColumnMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *BackfillColumnMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	quote := mg.Dialect.Quote
+	sql := fmt.Sprintf("UPDATE %s SET %s = %s", quote(m.tableName), quote(m.columnName), dialectSql(m.expr).forDialect(mg.Dialect))
+
+	if m.keyColumn == "" {
+		if m.where != "" {
+			sql += " WHERE " + m.where
+		}
+		_, err := sess.Exec(sql)
+		return err
+	}
+
+	sql += fmt.Sprintf(" WHERE %s >= %s AND %s < %s", quote(m.keyColumn), mg.Dialect.Placeholder(1), quote(m.keyColumn), mg.Dialect.Placeholder(2))
+	if m.where != "" {
+		sql += " AND (" + m.where + ")"
+	}
+
+	chunked := NewChunkedExec(m.tableName, m.keyColumn, m.batchSize)
+	return chunked.Run(sess, mg, func(sess *xorm.Session, from int64, to int64) (int64, error) {
+		result, err := sess.Exec(sql, from, to)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	})
+}
+
+func (m *BackfillColumnMigration) String() string {
+	return fmt.Sprintf("BackfillColumn %s.%s", m.tableName, m.columnName)
+}
+
+// AddColumnFromJoinMigration adds a column and fills it from the matching row
+// of another table, e.g. a denormalized org_name on dashboard from the name of
+// its org. On is the join condition and As the source expression, both refer
+// to the tables by name, e.g. On("org.id = dashboard.org_id").As("org.name").
+// The column must be nullable or have a default, rows without a matching row
+// keep it. If the column already exists, e.g. when the update of an earlier
+// run failed after MySQL committed the ADD COLUMN, only the backfill runs.
+type AddColumnFromJoinMigration struct {
+	MigrationBase
+	tableName   string
+	column      *Column
+	sourceTable string
+	on          string
+	expr        string
+	keyColumn   string
+	batchSize   int64
+}
+
+func NewAddColumnFromJoinMigration(table Table, col *Column, sourceTable string) *AddColumnFromJoinMigration {
+	return &AddColumnFromJoinMigration{tableName: table.Name, column: col, sourceTable: sourceTable}
+}
+
+func (m *AddColumnFromJoinMigration) On(condition string) *AddColumnFromJoinMigration {
+	m.on = condition
+	return m
+}
+
+func (m *AddColumnFromJoinMigration) As(expr string) *AddColumnFromJoinMigration {
+	m.expr = expr
+	return m
+}
+
+// Batch updates the rows in chunks of size consecutive values of an integer
+// key column of the table, see ChunkedExec.
+func (m *AddColumnFromJoinMigration) Batch(keyColumn string, size int64) *AddColumnFromJoinMigration {
+	m.keyColumn = keyColumn
+	m.batchSize = size
+	return m
+}
+
+func (m *AddColumnFromJoinMigration) Validate(mg *Migrator) error {
+	if m.on == "" || m.expr == "" {
+		return fmt.Errorf("column %s.%s needs a join condition and a source expression", m.tableName, m.column.Name)
+	}
+	if !m.column.Nullable && m.column.Default == "" {
+		return fmt.Errorf("column %s.%s must be nullable or have a default, rows without a row in %s are not updated", m.tableName, m.column.Name, m.sourceTable)
+	}
+	if m.keyColumn != "" && m.batchSize <= 0 {
+		return fmt.Errorf("backfill of %s.%s has invalid batch size %d", m.tableName, m.column.Name, m.batchSize)
+	}
+	return nil
+}
+
+func (m *AddColumnFromJoinMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *AddColumnFromJoinMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	exists := false
+	if sql, args := dialect.ColumnCheckSql(m.tableName, m.column.Name); sql != "" {
+		results, err := sess.SQL(sql, args...).Query()
+		if err != nil {
+			return err
+		}
+		exists = len(results) > 0
+	}
+	if !exists {
+		if _, err := sess.Exec(dialect.AddColumnSql(m.tableName, m.column)); err != nil {
+			return err
+		}
+	}
+
+	if m.keyColumn == "" {
+		_, err := sess.Exec(dialect.UpdateFromSql(m.tableName, m.column.Name, m.sourceTable, m.on, m.expr, ""))
+		return err
+	}
+
+	key := dialect.Quote(m.tableName) + "." + dialect.Quote(m.keyColumn)
+	sql := dialect.UpdateFromSql(m.tableName, m.column.Name, m.sourceTable, m.on, m.expr,
+		fmt.Sprintf("%s >= %s AND %s < %s", key, dialect.Placeholder(1), key, dialect.Placeholder(2)))
+
+	chunked := NewChunkedExec(m.tableName, m.keyColumn, m.batchSize)
+	return chunked.Run(sess, mg, func(sess *xorm.Session, from int64, to int64) (int64, error) {
+		result, err := sess.Exec(sql, from, to)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	})
+}
+
+func (m *AddColumnFromJoinMigration) String() string {
+	return fmt.Sprintf("AddColumnFromJoin %s.%s %s FROM %s", m.tableName, m.column.Name, m.column.Type, m.sourceTable)
+}
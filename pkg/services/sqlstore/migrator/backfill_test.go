@@ -0,0 +1,90 @@
+package migrator
+
+import (
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func queryRows(x *xorm.Engine, sql string) []map[string]string {
+	results, err := x.QueryString(sql)
+	So(err, ShouldBeNil)
+	return results
+}
+
+func TestBackfillColumnMigration(t *testing.T) {
+	Convey("Backfilling a column", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT, slug TEXT)",
+			"INSERT INTO dashboard (id, title, slug) VALUES (1, 'A', NULL), (2, 'B', 'kept'), (5, 'C', NULL), (6, 'D', NULL)",
+		)
+		backfill := NewBackfillColumnMigration("dashboard", "slug").As("upper(title)").Sqlite("lower(title)").Where("slug IS NULL")
+		expected := []map[string]string{{"slug": "a"}, {"slug": "kept"}, {"slug": "c"}, {"slug": "d"}}
+
+		Convey("updates the matching rows with the expression of the dialect", func() {
+			mg.AddMigration("backfill slug", backfill)
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT slug FROM dashboard ORDER BY id"), ShouldResemble, expected)
+		})
+
+		Convey("updates the matching rows in batches", func() {
+			mg.AddMigration("backfill slug", backfill.Batch("id", 2))
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT slug FROM dashboard ORDER BY id"), ShouldResemble, expected)
+		})
+
+		Convey("fails without an expression for the dialect", func() {
+			mg.AddMigration("backfill slug", NewBackfillColumnMigration("dashboard", "slug").Mysql("lower(title)"))
+			So(mg.Start(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAddColumnFromJoinMigration(t *testing.T) {
+	Convey("Adding a column from a join", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE org (id INTEGER PRIMARY KEY, legacy_id INTEGER, name TEXT)",
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, org_id INTEGER)",
+			"INSERT INTO org (id, legacy_id, name) VALUES (1, 100, 'main'), (2, NULL, 'other')",
+			"INSERT INTO dashboard (id, org_id) VALUES (1, 1), (2, 100), (3, 7), (4, 2)",
+		)
+		orgName := func() *AddColumnFromJoinMigration {
+			return NewAddColumnFromJoinMigration(Table{Name: "dashboard"}, &Column{Name: "org_name", Type: DB_NVarchar, Length: 190, Nullable: true}, "org").
+				On("org.id = dashboard.org_id OR org.legacy_id = dashboard.org_id").
+				As("org.name")
+		}
+		expected := []map[string]string{{"org_name": "main"}, {"org_name": "main"}, {"org_name": ""}, {"org_name": "other"}}
+
+		Convey("fills it from the matching rows and leaves the others", func() {
+			mg.AddMigration("add org name", orgName())
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT org_name FROM dashboard ORDER BY id"), ShouldResemble, expected)
+			So(queryRows(x, "SELECT COUNT(*) AS count FROM dashboard WHERE org_name IS NULL"), ShouldResemble, []map[string]string{{"count": "1"}})
+		})
+
+		Convey("fills it in batches", func() {
+			mg.AddMigration("add org name", orgName().Batch("id", 1))
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT org_name FROM dashboard ORDER BY id"), ShouldResemble, expected)
+		})
+
+		Convey("keeps the join condition apart from the batch range on MySQL and Postgres", func() {
+			on := "org.id = dashboard.org_id OR org.legacy_id = dashboard.org_id"
+			So(NewMysqlDialect(nil).UpdateFromSql("dashboard", "org_name", "org", on, "org.name", "dashboard.id >= ? AND dashboard.id < ?"), ShouldEqual,
+				"UPDATE `dashboard` JOIN `org` ON ("+on+") SET `dashboard`.`org_name` = org.name WHERE (dashboard.id >= ? AND dashboard.id < ?)")
+			So(NewPostgresDialect(nil).UpdateFromSql("dashboard", "org_name", "org", on, "org.name", "dashboard.id >= $1 AND dashboard.id < $2"), ShouldEqual,
+				`UPDATE "dashboard" SET "org_name" = org.name FROM "org" WHERE (`+on+`) AND (dashboard.id >= $1 AND dashboard.id < $2)`)
+		})
+
+		Convey("rejects columns rows without a match can't keep", func() {
+			m := NewAddColumnFromJoinMigration(Table{Name: "dashboard"}, &Column{Name: "org_name", Type: DB_NVarchar, Length: 190}, "org").
+				On("org.id = dashboard.org_id").
+				As("org.name")
+			So(m.Validate(mg), ShouldNotBeNil)
+		})
+	})
+}
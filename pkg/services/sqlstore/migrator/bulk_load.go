@@ -0,0 +1,83 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/go-xorm/xorm"
+)
+
+// WithoutIndexes drops the secondary indexes of a table, runs load and
+// creates the indexes again from their definitions in the database, so their
+// names, uniqueness, column order and conditions are kept. Inserting many rows
+// into a table without indexes and indexing them once afterwards is faster
+// than updating the indexes for every row. See Dialect.IndexDefinitions for
+// the indexes that are kept in place.
+func WithoutIndexes(sess *xorm.Session, mg *Migrator, tableName string, load func() error) error {
+	definitions, err := mg.Dialect.IndexDefinitions(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range definitions {
+		if _, err := sess.Exec(index.DropSql); err != nil {
+			return err
+		}
+	}
+	mg.Logger.Debug("Dropped indexes for bulk load", "table", tableName, "indexes", len(definitions))
+
+	if err := load(); err != nil {
+		return err
+	}
+
+	for _, index := range definitions {
+		if _, err := sess.Exec(index.CreateSql); err != nil {
+			return fmt.Errorf("recreating index %s on %s failed: %v", index.Name, tableName, err)
+		}
+	}
+	return nil
+}
+
+// BulkLoadMigration runs statements loading rows into a table with the
+// secondary indexes of the table dropped, see WithoutIndexes. On Postgres and
+// SQLite a failing load rolls back the dropped indexes with the migration.
+// MySQL commits the transaction when dropping an index, there the indexes
+// stay dropped if the load fails and have to be created again by hand.
+type BulkLoadMigration struct {
+	MigrationBase
+	tableName  string
+	statements []string
+}
+
+func NewBulkLoadMigration(tableName string, statements ...string) *BulkLoadMigration {
+	return &BulkLoadMigration{tableName: tableName, statements: statements}
+}
+
+func (m *BulkLoadMigration) Validate(mg *Migrator) error {
+	if len(m.statements) == 0 {
+		return fmt.Errorf("bulk load into %s has no statements", m.tableName)
+	}
+	return nil
+}
+
+func (m *BulkLoadMigration) SqlStatements(dialect Dialect) []string {
+	return m.statements
+}
+
+func (m *BulkLoadMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.statements)
+}
+
+func (m *BulkLoadMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return WithoutIndexes(sess, mg, m.tableName, func() error {
+		for _, sql := range mg.statements(m) {
+			if _, err := sess.Exec(sql); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *BulkLoadMigration) String() string {
+	return fmt.Sprintf("BulkLoad %s (%d statements)", m.tableName, len(m.statements))
+}
@@ -0,0 +1,48 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBulkLoadMigration(t *testing.T) {
+	Convey("Bulk loading rows without indexes", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE tag (id INTEGER PRIMARY KEY, term TEXT, org_id INTEGER)",
+			"CREATE UNIQUE INDEX UQE_tag_term ON tag (term)",
+			"CREATE INDEX IDX_tag_org_id ON tag (org_id DESC) WHERE org_id IS NOT NULL",
+			"INSERT INTO tag (id, term, org_id) VALUES (1, 'a', 1)",
+		)
+		indexes := func() []map[string]string {
+			return queryRows(x, "SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = 'tag' ORDER BY name")
+		}
+		before := indexes()
+
+		Convey("recreates the indexes from their definitions after the load", func() {
+			// the unique index would reject the duplicate in between
+			mg.AddMigration("load tags", NewBulkLoadMigration("tag",
+				"INSERT INTO tag (id, term, org_id) VALUES (2, 'a', 2), (3, 'b', NULL)",
+				"DELETE FROM tag WHERE id = 1",
+			))
+			So(mg.Start(), ShouldBeNil)
+			So(before, ShouldHaveLength, 2)
+			So(indexes(), ShouldResemble, before)
+			So(queryRows(x, "SELECT id FROM tag ORDER BY id"), ShouldResemble, []map[string]string{{"id": "2"}, {"id": "3"}})
+
+			_, err := x.Exec("INSERT INTO tag (id, term) VALUES (4, 'b')")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rolls back the dropped indexes when they can't be created again", func() {
+			mg.AddMigration("load tags", NewBulkLoadMigration("tag", "INSERT INTO tag (id, term) VALUES (2, 'a')"))
+			err := mg.Start()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "recreating index UQE_tag_term on tag failed")
+			So(err.(*MigrationError).Sql, ShouldEqual, "INSERT INTO tag (id, term) VALUES (2, 'a')")
+			So(indexes(), ShouldResemble, before)
+			So(queryRows(x, "SELECT id FROM tag"), ShouldResemble, []map[string]string{{"id": "1"}})
+		})
+	})
+}
@@ -0,0 +1,188 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// ChunkedExec processes the rows of a table in chunks of consecutive key
+// ranges, for code migrations that touch too many rows for a single
+// statement. The chunks keep single statements small, but the migration still
+// runs in a single transaction, so their locks are held until it commits and
+// canceling the context rolls back the chunks processed so far. Batches run
+// with RunCommittedBatches are committed one by one instead.
+type ChunkedExec struct {
+	TableName string
+	KeyColumn string
+	ChunkSize int64
+	Context   context.Context
+	// Progress is called after every chunk with the number of rows processed so far
+	Progress func(processed int64)
+	// Pause is waited between chunks, giving other queries a chance to run
+	Pause time.Duration
+}
+
+// ChunkFunc processes the rows with from <= key < to and returns the number of
+// rows it processed.
+type ChunkFunc func(sess *xorm.Session, from int64, to int64) (int64, error)
+
+func NewChunkedExec(tableName string, keyColumn string, chunkSize int64) *ChunkedExec {
+	return &ChunkedExec{TableName: tableName, KeyColumn: keyColumn, ChunkSize: chunkSize}
+}
+
+func (c *ChunkedExec) Run(sess *xorm.Session, mg *Migrator, chunk ChunkFunc) error {
+	if c.ChunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", c.ChunkSize)
+	}
+
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	minKey, maxKey, ok, err := c.keyRange(sess, mg.Dialect)
+	if err != nil || !ok {
+		return err
+	}
+	if maxKey == math.MaxInt64 {
+		return fmt.Errorf("key %d of %s leaves no room for the end of the last chunk", maxKey, c.TableName)
+	}
+
+	var processed int64
+	for from := minKey; ; from += c.ChunkSize {
+		// compared before adding, from + ChunkSize overflows for keys close to
+		// the maximum
+		last := from > maxKey-c.ChunkSize
+		to := maxKey + 1
+		if !last {
+			to = from + c.ChunkSize
+		}
+
+		if err := ctx.Err(); err != nil {
+			mg.Logger.Warn("Chunked execution canceled", "table", c.TableName, "processed", processed)
+			return err
+		}
+
+		count, err := chunk(sess, from, to)
+		if err != nil {
+			return err
+		}
+
+		processed += count
+		mg.Logger.Debug("Processed chunk", "table", c.TableName, "from", from, "to", to, "processed", processed)
+		if c.Progress != nil {
+			c.Progress(processed)
+		}
+		if last {
+			return nil
+		}
+		if err := c.pause(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// BatchFunc processes at most limit rows and returns the number of rows it
+// processed, 0 once no rows are left.
+type BatchFunc func(sess *xorm.Session, limit int64) (int64, error)
+
+// RunBatches calls batch until it processes no more rows, for chunks that
+// can't be told apart by key, e.g. deleting the rows matching a condition
+// with a LIMIT. KeyColumn is not used.
+func (c *ChunkedExec) RunBatches(sess *xorm.Session, mg *Migrator, batch BatchFunc) error {
+	return c.runBatches(mg, func(limit int64) (int64, error) {
+		return batch(sess, limit)
+	})
+}
+
+// RunCommittedBatches is RunBatches with every batch in a transaction of its
+// own, committed before the next one starts, so the locks and undo of a batch
+// are released right away. It must not be called within the transaction of a
+// migration, see BatchedMigration. A failing batch only rolls back itself,
+// batch has to find the remaining rows again, e.g. by their condition.
+func (c *ChunkedExec) RunCommittedBatches(mg *Migrator, batch BatchFunc) error {
+	return c.runBatches(mg, func(limit int64) (int64, error) {
+		var count int64
+		err := mg.inTransaction(func(sess *xorm.Session) error {
+			var err error
+			count, err = batch(sess, limit)
+			return err
+		})
+		return count, err
+	})
+}
+
+func (c *ChunkedExec) runBatches(mg *Migrator, batch func(limit int64) (int64, error)) error {
+	if c.ChunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", c.ChunkSize)
+	}
+
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var processed int64
+	for {
+		if err := ctx.Err(); err != nil {
+			mg.Logger.Warn("Chunked execution canceled", "table", c.TableName, "processed", processed)
+			return err
+		}
+
+		count, err := batch(c.ChunkSize)
+		if err != nil || count == 0 {
+			return err
+		}
+
+		processed += count
+		mg.Logger.Debug("Processed batch", "table", c.TableName, "rows", count, "processed", processed)
+		if c.Progress != nil {
+			c.Progress(processed)
+		}
+		if err := c.pause(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *ChunkedExec) pause(ctx context.Context) error {
+	if c.Pause <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(c.Pause):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *ChunkedExec) keyRange(sess *xorm.Session, dialect Dialect) (int64, int64, bool, error) {
+	quote := dialect.Quote
+	sql := fmt.Sprintf("SELECT MIN(%s) AS min_key, MAX(%s) AS max_key FROM %s", quote(c.KeyColumn), quote(c.KeyColumn), quote(c.TableName))
+	results, err := sess.SQL(sql).Query()
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// an empty table has NULL bounds
+	if len(results) == 0 || len(results[0]["min_key"]) == 0 {
+		return 0, 0, false, nil
+	}
+
+	minKey, err := strconv.ParseInt(string(results[0]["min_key"]), 10, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	maxKey, err := strconv.ParseInt(string(results[0]["max_key"]), 10, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return minKey, maxKey, true, nil
+}
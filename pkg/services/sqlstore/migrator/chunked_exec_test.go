@@ -0,0 +1,70 @@
+package migrator
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChunkedExec(t *testing.T) {
+	Convey("Processing a table in chunks", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x, "CREATE TABLE event (id INTEGER PRIMARY KEY)")
+		mg := NewMigrator(x)
+		sess := x.NewSession()
+		defer sess.Close()
+
+		insertKeys := func(keys ...int64) {
+			for _, key := range keys {
+				_, err := x.Exec("INSERT INTO event (id) VALUES (?)", key)
+				So(err, ShouldBeNil)
+			}
+		}
+
+		chunks := []string{}
+		var processed int64
+		c := NewChunkedExec("event", "id", 4)
+		c.Progress = func(rows int64) {
+			processed = rows
+		}
+		run := func() error {
+			return c.Run(sess, mg, func(sess *xorm.Session, from int64, to int64) (int64, error) {
+				chunks = append(chunks, strconv.FormatInt(from, 10)+"-"+strconv.FormatInt(to, 10))
+				return countRows(sess, mg.Dialect.CountSql("event", "id >= "+strconv.FormatInt(from, 10)+" AND id < "+strconv.FormatInt(to, 10)))
+			})
+		}
+
+		Convey("covers the key range", func() {
+			insertKeys(1, 2, 7, 10)
+			So(run(), ShouldBeNil)
+			So(chunks, ShouldResemble, []string{"1-5", "5-9", "9-11"})
+			So(processed, ShouldEqual, 4)
+		})
+
+		Convey("doesn't overflow for keys close to the maximum", func() {
+			insertKeys(math.MaxInt64-9, math.MaxInt64-1)
+			So(run(), ShouldBeNil)
+			So(chunks, ShouldResemble, []string{
+				"9223372036854775798-9223372036854775802",
+				"9223372036854775802-9223372036854775806",
+				"9223372036854775806-9223372036854775807",
+			})
+			So(processed, ShouldEqual, 2)
+		})
+
+		Convey("fails for the maximum key", func() {
+			insertKeys(1, math.MaxInt64)
+			So(run(), ShouldNotBeNil)
+			So(chunks, ShouldBeEmpty)
+		})
+
+		Convey("does nothing for an empty table", func() {
+			So(run(), ShouldBeNil)
+			So(chunks, ShouldBeEmpty)
+		})
+	})
+}
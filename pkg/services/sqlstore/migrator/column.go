@@ -12,6 +12,18 @@ type Column struct {
 	IsPrimaryKey    bool
 	IsAutoIncrement bool
 	Default         string
+	// DialectDefaults overrides Default for the dialects it has a default
+	// for, keyed by driver name like the sql of a RawSqlMigration, e.g. an
+	// expression on Postgres and a literal on SQLite.
+	DialectDefaults map[string]string
+	Comment         string
+
+	// DisplayWidth and Zerofill declare legacy MySQL integer columns such as
+	// INT(11) ZEROFILL, so the columns match those of existing tables.
+	// Neither changes the values a column holds, MySQL deprecated both in
+	// 8.0.17 and the other dialects ignore them.
+	DisplayWidth int
+	Zerofill     bool
 }
 
 func (col *Column) String(d Dialect) string {
@@ -0,0 +1,176 @@
+package migrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+const (
+	DiffOnlyInA = "only in a"
+	DiffOnlyInB = "only in b"
+)
+
+const (
+	ObjectTable  = "table"
+	ObjectColumn = "column"
+	ObjectIndex  = "index"
+)
+
+// DatabaseDifference is a difference between two databases. Object is the
+// kind of the object that differs and Name its name, empty for tables. Kind
+// is DiffOnlyInA, DiffOnlyInB or the Diff* kind of a difference, with the
+// values of both databases in A and B.
+type DatabaseDifference struct {
+	Table  string
+	Object string
+	Name   string
+	Kind   string
+	A      string
+	B      string
+}
+
+func (d DatabaseDifference) String() string {
+	object := d.Table
+	if d.Name != "" {
+		object += "." + d.Name
+	}
+	if d.Kind == DiffOnlyInA || d.Kind == DiffOnlyInB {
+		return fmt.Sprintf("%s %s: %s", d.Object, object, d.Kind)
+	}
+	return fmt.Sprintf("%s %s: %s differs, a has %s, b has %s", d.Object, object, d.Kind, d.A, d.B)
+}
+
+// CompareDatabases compares the tables, columns and indexes of two
+// databases, e.g. staging and production. The databases may use different
+// engines, column types are equal if either dialect considers them
+// equivalent. Names are compared case insensitively, column order and
+// defaults are not compared.
+func CompareDatabases(dialectA Dialect, dbA *xorm.Engine, dialectB Dialect, dbB *xorm.Engine) ([]DatabaseDifference, error) {
+	sessA := dbA.NewSession()
+	defer sessA.Close()
+	sessB := dbB.NewSession()
+	defer sessB.Close()
+
+	tablesA, err := dialectA.ListTables(sessA)
+	if err != nil {
+		return nil, err
+	}
+	tablesB, err := dialectB.ListTables(sessB)
+	if err != nil {
+		return nil, err
+	}
+
+	namesB := map[string]string{}
+	for _, name := range tablesB {
+		namesB[strings.ToLower(name)] = name
+	}
+
+	differences := []DatabaseDifference{}
+	for _, nameA := range tablesA {
+		nameB, ok := namesB[strings.ToLower(nameA)]
+		if !ok {
+			differences = append(differences, DatabaseDifference{Table: nameA, Object: ObjectTable, Kind: DiffOnlyInA})
+			continue
+		}
+		delete(namesB, strings.ToLower(nameA))
+
+		tableA, indexesA, err := describeTableAndIndexes(sessA, dialectA, nameA)
+		if err != nil {
+			return nil, err
+		}
+		tableB, indexesB, err := describeTableAndIndexes(sessB, dialectB, nameB)
+		if err != nil {
+			return nil, err
+		}
+
+		differences = append(differences, compareColumns(dialectA, tableA, dialectB, tableB)...)
+		differences = append(differences, compareIndexes(nameA, indexesA, indexesB)...)
+	}
+
+	onlyInB := make([]string, 0, len(namesB))
+	for _, name := range namesB {
+		onlyInB = append(onlyInB, name)
+	}
+	sort.Strings(onlyInB)
+	for _, name := range onlyInB {
+		differences = append(differences, DatabaseDifference{Table: name, Object: ObjectTable, Kind: DiffOnlyInB})
+	}
+
+	return differences, nil
+}
+
+func describeTableAndIndexes(sess *xorm.Session, dialect Dialect, tableName string) (*Table, []*Index, error) {
+	table, err := dialect.DescribeTable(sess, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexes, err := dialect.ListIndexes(sess, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return table, indexes, nil
+}
+
+func compareColumns(dialectA Dialect, tableA *Table, dialectB Dialect, tableB *Table) []DatabaseDifference {
+	differences := []DatabaseDifference{}
+	colsB := map[string]*Column{}
+	for _, col := range tableB.Columns {
+		colsB[strings.ToLower(col.Name)] = col
+	}
+
+	for _, colA := range tableA.Columns {
+		colB, ok := colsB[strings.ToLower(colA.Name)]
+		if !ok {
+			differences = append(differences, DatabaseDifference{Table: tableA.Name, Object: ObjectColumn, Name: colA.Name, Kind: DiffOnlyInA})
+			continue
+		}
+		delete(colsB, strings.ToLower(colA.Name))
+
+		if !dialectA.TypesEquivalent(colA.Type, colB.Type) && !dialectB.TypesEquivalent(colA.Type, colB.Type) {
+			differences = append(differences, DatabaseDifference{Table: tableA.Name, Object: ObjectColumn, Name: colA.Name, Kind: DiffColumnType, A: colA.Type, B: colB.Type})
+		}
+		if colA.Nullable != colB.Nullable {
+			differences = append(differences, DatabaseDifference{Table: tableA.Name, Object: ObjectColumn, Name: colA.Name, Kind: DiffColumnNullable, A: nullability(colA.Nullable), B: nullability(colB.Nullable)})
+		}
+	}
+
+	for _, colB := range tableB.Columns {
+		if _, ok := colsB[strings.ToLower(colB.Name)]; ok {
+			differences = append(differences, DatabaseDifference{Table: tableA.Name, Object: ObjectColumn, Name: colB.Name, Kind: DiffOnlyInB})
+		}
+	}
+
+	return differences
+}
+
+func compareIndexes(tableName string, indexesA []*Index, indexesB []*Index) []DatabaseDifference {
+	differences := []DatabaseDifference{}
+	byNameB := map[string]*Index{}
+	for _, index := range indexesB {
+		byNameB[strings.ToLower(index.Name)] = index
+	}
+
+	for _, indexA := range indexesA {
+		indexB, ok := byNameB[strings.ToLower(indexA.Name)]
+		if !ok {
+			differences = append(differences, DatabaseDifference{Table: tableName, Object: ObjectIndex, Name: indexA.Name, Kind: DiffOnlyInA})
+			continue
+		}
+		delete(byNameB, strings.ToLower(indexA.Name))
+
+		if a, b := indexDefinition(indexA), indexDefinition(indexB); !strings.EqualFold(a, b) {
+			differences = append(differences, DatabaseDifference{Table: tableName, Object: ObjectIndex, Name: indexA.Name, Kind: DiffIndexDefinition, A: a, B: b})
+		}
+	}
+
+	for _, indexB := range indexesB {
+		if _, ok := byNameB[strings.ToLower(indexB.Name)]; ok {
+			differences = append(differences, DatabaseDifference{Table: tableName, Object: ObjectIndex, Name: indexB.Name, Kind: DiffOnlyInB})
+		}
+	}
+
+	return differences
+}
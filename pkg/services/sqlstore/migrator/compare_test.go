@@ -0,0 +1,58 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareDatabases(t *testing.T) {
+	Convey("Comparing two databases", t, func() {
+		dbA := newSqliteTestEngine(t)
+		dbB := newSqliteTestEngine(t)
+		execTestSql(dbA,
+			"CREATE TABLE alert (id INTEGER PRIMARY KEY)",
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT NOT NULL, version INTEGER, uid TEXT)",
+			"CREATE UNIQUE INDEX UQE_dashboard_uid ON dashboard (uid)",
+			"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+		)
+		compare := func() []DatabaseDifference {
+			differences, err := CompareDatabases(NewDialect(dbA), dbA, NewDialect(dbB), dbB)
+			So(err, ShouldBeNil)
+			return differences
+		}
+
+		Convey("finds no differences between equal databases", func() {
+			execTestSql(dbB,
+				"CREATE TABLE ALERT (ID INTEGER PRIMARY KEY)",
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title VARCHAR(255) NOT NULL, version BIGINT, uid TEXT)",
+				"CREATE UNIQUE INDEX UQE_dashboard_uid ON dashboard (uid)",
+				"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+			)
+			So(compare(), ShouldBeEmpty)
+		})
+
+		Convey("reports tables, columns and indexes that differ", func() {
+			execTestSql(dbB,
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT, version TEXT, slug TEXT)",
+				"CREATE INDEX IDX_dashboard_slug ON dashboard (slug)",
+				"CREATE INDEX IDX_dashboard_title ON dashboard (title, id)",
+				"CREATE TABLE tag (id INTEGER PRIMARY KEY)",
+			)
+			differences := compare()
+			So(differences, ShouldResemble, []DatabaseDifference{
+				{Table: "alert", Object: ObjectTable, Kind: DiffOnlyInA},
+				{Table: "dashboard", Object: ObjectColumn, Name: "title", Kind: DiffColumnNullable, A: "NOT NULL", B: "NULL"},
+				{Table: "dashboard", Object: ObjectColumn, Name: "version", Kind: DiffColumnType, A: "INTEGER", B: "TEXT"},
+				{Table: "dashboard", Object: ObjectColumn, Name: "uid", Kind: DiffOnlyInA},
+				{Table: "dashboard", Object: ObjectColumn, Name: "slug", Kind: DiffOnlyInB},
+				{Table: "dashboard", Object: ObjectIndex, Name: "IDX_dashboard_title", Kind: DiffIndexDefinition, A: "(title)", B: "(title, id)"},
+				{Table: "dashboard", Object: ObjectIndex, Name: "UQE_dashboard_uid", Kind: DiffOnlyInA},
+				{Table: "dashboard", Object: ObjectIndex, Name: "IDX_dashboard_slug", Kind: DiffOnlyInB},
+				{Table: "tag", Object: ObjectTable, Kind: DiffOnlyInB},
+			})
+			So(differences[0].String(), ShouldEqual, "table alert: only in a")
+			So(differences[2].String(), ShouldEqual, "column dashboard.version: column type differs, a has INTEGER, b has TEXT")
+		})
+	})
+}
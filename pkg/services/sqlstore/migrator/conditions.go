@@ -1,10 +1,29 @@
 package migrator
 
+import "fmt"
+
 type MigrationCondition interface {
 	Sql(dialect Dialect) (string, []interface{})
 	IsFulfilled(results []map[string][]byte) bool
 }
 
+// ExplainingCondition is implemented by conditions that can tell why they
+// are not fulfilled from the same results, e.g. "table user does not exist".
+// The reason is logged when the migration is skipped or deferred.
+type ExplainingCondition interface {
+	MigrationCondition
+	Reason(results []map[string][]byte) string
+}
+
+// DeferringCondition is implemented by conditions that may be fulfilled on a
+// later run, e.g. once a table has grown. A migration whose condition is not
+// fulfilled is recorded in the migration log as executed, unless Defers
+// tells otherwise. It is then left pending and checked again on the next run.
+type DeferringCondition interface {
+	MigrationCondition
+	Defers(results []map[string][]byte) bool
+}
+
 type ExistsMigrationCondition struct{}
 
 func (c *ExistsMigrationCondition) IsFulfilled(results []map[string][]byte) bool {
@@ -17,6 +36,32 @@ func (c *NotExistsMigrationCondition) IsFulfilled(results []map[string][]byte) b
 	return len(results) == 0
 }
 
+type IfTableExistsCondition struct {
+	ExistsMigrationCondition
+	TableName string
+}
+
+func (c *IfTableExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
+	return dialect.TableCheckSql(c.TableName)
+}
+
+func (c *IfTableExistsCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("table %s does not exist", c.TableName)
+}
+
+type IfTableNotExistsCondition struct {
+	NotExistsMigrationCondition
+	TableName string
+}
+
+func (c *IfTableNotExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
+	return dialect.TableCheckSql(c.TableName)
+}
+
+func (c *IfTableNotExistsCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("table %s already exists", c.TableName)
+}
+
 type IfIndexExistsCondition struct {
 	ExistsMigrationCondition
 	TableName string
@@ -27,6 +72,10 @@ func (c *IfIndexExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
 	return dialect.IndexCheckSql(c.TableName, c.IndexName)
 }
 
+func (c *IfIndexExistsCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("index %s does not exist on table %s", c.IndexName, c.TableName)
+}
+
 type IfIndexNotExistsCondition struct {
 	NotExistsMigrationCondition
 	TableName string
@@ -37,6 +86,10 @@ func (c *IfIndexNotExistsCondition) Sql(dialect Dialect) (string, []interface{})
 	return dialect.IndexCheckSql(c.TableName, c.IndexName)
 }
 
+func (c *IfIndexNotExistsCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("index %s already exists on table %s", c.IndexName, c.TableName)
+}
+
 type IfColumnNotExistsCondition struct {
 	NotExistsMigrationCondition
 	TableName  string
@@ -46,3 +99,131 @@ type IfColumnNotExistsCondition struct {
 func (c *IfColumnNotExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
 	return dialect.ColumnCheckSql(c.TableName, c.ColumnName)
 }
+
+func (c *IfColumnNotExistsCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("column %s.%s already exists", c.TableName, c.ColumnName)
+}
+
+// IfConstraintNotExistsCondition runs the migration if the table has no
+// constraint of the name, see Dialect.ConstraintExistsSql.
+type IfConstraintNotExistsCondition struct {
+	NotExistsMigrationCondition
+	TableName      string
+	ConstraintName string
+}
+
+func (c *IfConstraintNotExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
+	return dialect.ConstraintExistsSql(c.TableName, c.ConstraintName)
+}
+
+func (c *IfConstraintNotExistsCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("constraint %s already exists on table %s", c.ConstraintName, c.TableName)
+}
+
+// IfSqlExistsCondition runs the migration if the query returns any rows, e.g.
+// rows the migration has to fix. The query is run as a subquery of
+// Dialect.ExistsSql.
+type IfSqlExistsCondition struct {
+	Query string
+	Args  []interface{}
+}
+
+func (c *IfSqlExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
+	return dialect.ExistsSql(c.Query), c.Args
+}
+
+func (c *IfSqlExistsCondition) IsFulfilled(results []map[string][]byte) bool {
+	return ExistsSqlResult(results)
+}
+
+func (c *IfSqlExistsCondition) Reason(results []map[string][]byte) string {
+	return "query returned no rows: " + c.Query
+}
+
+// IfSqlNotExistsCondition runs the migration if the query returns no rows.
+type IfSqlNotExistsCondition struct {
+	Query string
+	Args  []interface{}
+}
+
+func (c *IfSqlNotExistsCondition) Sql(dialect Dialect) (string, []interface{}) {
+	return dialect.ExistsSql(c.Query), c.Args
+}
+
+func (c *IfSqlNotExistsCondition) IsFulfilled(results []map[string][]byte) bool {
+	return !ExistsSqlResult(results)
+}
+
+func (c *IfSqlNotExistsCondition) Reason(results []map[string][]byte) string {
+	return "query returned rows: " + c.Query
+}
+
+// ExistsSqlResult decodes the result of a Dialect.ExistsSql query, which is
+// t or true on Postgres and 1 on MySQL and SQLite when rows exist.
+func ExistsSqlResult(results []map[string][]byte) bool {
+	if len(results) == 0 {
+		return false
+	}
+	return introspectedBool(results[0]["found"])
+}
+
+// RowCountCondition runs the migration once the table has more than MinRows
+// rows. Until then the migration is deferred, so it runs on the first run
+// after the table has grown.
+type RowCountCondition struct {
+	TableName string
+	MinRows   int64
+}
+
+// rowsSql selects a row past MinRows rows rather than counting all of them.
+func (c *RowCountCondition) rowsSql(dialect Dialect) string {
+	return "SELECT 1 FROM " + dialect.Quote(c.TableName) + dialect.LimitOffset(1, c.MinRows)
+}
+
+func (c *RowCountCondition) Sql(dialect Dialect) (string, []interface{}) {
+	return dialect.ExistsSql(c.rowsSql(dialect)), nil
+}
+
+func (c *RowCountCondition) IsFulfilled(results []map[string][]byte) bool {
+	return ExistsSqlResult(results)
+}
+
+func (c *RowCountCondition) Defers(results []map[string][]byte) bool {
+	return true
+}
+
+func (c *RowCountCondition) Reason(results []map[string][]byte) string {
+	return fmt.Sprintf("table %s has at most %d rows", c.TableName, c.MinRows)
+}
+
+// indexRowCountCondition creates an index that doesn't exist yet once the
+// table has more than MinRows rows, see AddIndexMigration.MinRows. Only a
+// small table defers the migration, an existing index skips it as usual.
+type indexRowCountCondition struct {
+	index IfIndexNotExistsCondition
+	rows  RowCountCondition
+}
+
+func (c *indexRowCountCondition) Sql(dialect Dialect) (string, []interface{}) {
+	indexSql, args := c.index.Sql(dialect)
+	return fmt.Sprintf("SELECT EXISTS (%s) AS index_found, EXISTS (%s) AS found", indexSql, c.rows.rowsSql(dialect)), args
+}
+
+func (c *indexRowCountCondition) IsFulfilled(results []map[string][]byte) bool {
+	return !c.indexExists(results) && ExistsSqlResult(results)
+}
+
+func (c *indexRowCountCondition) Defers(results []map[string][]byte) bool {
+	return !c.indexExists(results)
+}
+
+func (c *indexRowCountCondition) Reason(results []map[string][]byte) string {
+	if c.indexExists(results) {
+		return c.index.Reason(results)
+	}
+	return c.rows.Reason(results)
+}
+
+func (c *indexRowCountCondition) indexExists(results []map[string][]byte) bool {
+	return len(results) > 0 && introspectedBool(results[0]["index_found"])
+}
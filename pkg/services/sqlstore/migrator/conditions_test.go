@@ -0,0 +1,181 @@
+package migrator
+
+import (
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newSqliteTestEngine(t *testing.T) *xorm.Engine {
+	x, err := xorm.NewEngine(SQLITE, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory database
+	x.SetMaxOpenConns(1)
+	return x
+}
+
+func execTestSql(x *xorm.Engine, statements ...string) {
+	for _, sql := range statements {
+		_, err := x.Exec(sql)
+		So(err, ShouldBeNil)
+	}
+}
+
+func isFulfilled(t *testing.T, x *xorm.Engine, condition MigrationCondition) bool {
+	sql, args := condition.Sql(NewDialect(x))
+	results, err := x.SQL(sql, args...).Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return condition.IsFulfilled(results)
+}
+
+func TestTableConditions(t *testing.T) {
+	Convey("Table conditions", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x, "CREATE TABLE userXorg (id INTEGER)")
+
+		Convey("don't treat underscores as wildcards", func() {
+			So(isFulfilled(t, x, &IfTableExistsCondition{TableName: "user_org"}), ShouldBeFalse)
+			So(isFulfilled(t, x, &IfTableNotExistsCondition{TableName: "user_org"}), ShouldBeTrue)
+			So(isFulfilled(t, x, &IfTableExistsCondition{TableName: "userXorg"}), ShouldBeTrue)
+		})
+	})
+}
+
+func TestEscapeLike(t *testing.T) {
+	Convey("EscapeLike", t, func() {
+		x := newSqliteTestEngine(t)
+		dialect := NewDialect(x)
+		execTestSql(x, "CREATE TABLE userXorg (id INTEGER)")
+
+		probe := "SELECT name FROM sqlite_master WHERE type='table' AND name LIKE ? " + dialect.LikeEscapeStr()
+
+		Convey("an unescaped pattern matches any character", func() {
+			results, err := x.SQL(probe, "user_org").Query()
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 1)
+		})
+
+		Convey("an escaped pattern matches the underscore only", func() {
+			results, err := x.SQL(probe, dialect.EscapeLike("user_org")).Query()
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 0)
+		})
+
+		Convey("escapes wildcards and the escape character", func() {
+			So(dialect.EscapeLike(`50%_off\`), ShouldEqual, `50\%\_off\\`)
+		})
+	})
+}
+
+func TestSqlExistsConditions(t *testing.T) {
+	Convey("Sql exists conditions", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, slug TEXT)",
+			"INSERT INTO dashboard (slug) VALUES ('a'), (NULL)",
+		)
+
+		Convey("without args", func() {
+			withoutSlug := "SELECT 1 FROM dashboard WHERE slug IS NULL"
+			So(isFulfilled(t, x, &IfSqlExistsCondition{Query: withoutSlug}), ShouldBeTrue)
+			So(isFulfilled(t, x, &IfSqlNotExistsCondition{Query: withoutSlug}), ShouldBeFalse)
+		})
+
+		Convey("with args", func() {
+			withSlug := "SELECT 1 FROM dashboard WHERE slug = ?"
+			So(isFulfilled(t, x, &IfSqlExistsCondition{Query: withSlug, Args: []interface{}{"b"}}), ShouldBeFalse)
+			So(isFulfilled(t, x, &IfSqlNotExistsCondition{Query: withSlug, Args: []interface{}{"b"}}), ShouldBeTrue)
+		})
+	})
+}
+
+func TestExistsSqlResult(t *testing.T) {
+	Convey("ExistsSqlResult", t, func() {
+		for _, tc := range []struct {
+			engine string
+			value  string
+			exists bool
+		}{
+			{engine: POSTGRES, value: "true", exists: true},
+			{engine: POSTGRES, value: "t", exists: true},
+			{engine: POSTGRES, value: "false", exists: false},
+			{engine: POSTGRES, value: "f", exists: false},
+			{engine: MYSQL, value: "1", exists: true},
+			{engine: MYSQL, value: "0", exists: false},
+			{engine: SQLITE, value: "1", exists: true},
+			{engine: SQLITE, value: "0", exists: false},
+		} {
+			results := []map[string][]byte{{"found": []byte(tc.value)}}
+			So(ExistsSqlResult(results), ShouldEqual, tc.exists)
+		}
+
+		So(ExistsSqlResult(nil), ShouldBeFalse)
+	})
+}
+
+func TestConstraintNotExistsCondition(t *testing.T) {
+	Convey("IfConstraintNotExistsCondition", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE org (id INTEGER PRIMARY KEY)",
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, org_id INTEGER, slug TEXT, "+
+				"CONSTRAINT `FK_dashboard_org_id` FOREIGN KEY (org_id) REFERENCES org (id), CONSTRAINT chk_slug CHECK (length(slug) < 100))",
+			"CREATE UNIQUE INDEX UQE_dashboard_slug ON dashboard (slug)",
+			"CREATE INDEX IDX_dashboard_org_id ON dashboard (org_id)",
+		)
+
+		Convey("finds constraints and unique indexes", func() {
+			for _, name := range []string{"FK_dashboard_org_id", "chk_slug", "UQE_dashboard_slug"} {
+				So(isFulfilled(t, x, &IfConstraintNotExistsCondition{TableName: "dashboard", ConstraintName: name}), ShouldBeFalse)
+			}
+		})
+
+		Convey("doesn't match partial names or plain indexes", func() {
+			for _, name := range []string{"chk", "chkXslug", "IDX_dashboard_org_id"} {
+				So(isFulfilled(t, x, &IfConstraintNotExistsCondition{TableName: "dashboard", ConstraintName: name}), ShouldBeTrue)
+			}
+		})
+
+		Convey("only looks at the given table", func() {
+			So(isFulfilled(t, x, &IfConstraintNotExistsCondition{TableName: "org", ConstraintName: "chk_slug"}), ShouldBeTrue)
+		})
+	})
+}
+
+func TestConditionReasons(t *testing.T) {
+	Convey("Condition reasons", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+			"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+		)
+
+		for _, tc := range []struct {
+			condition ExplainingCondition
+			reason    string
+		}{
+			{&IfTableExistsCondition{TableName: "user"}, "table user does not exist"},
+			{&IfTableNotExistsCondition{TableName: "dashboard"}, "table dashboard already exists"},
+			{&indexRowCountCondition{
+				index: IfIndexNotExistsCondition{TableName: "dashboard", IndexName: "IDX_dashboard_title"},
+				rows:  RowCountCondition{TableName: "dashboard", MinRows: 10},
+			}, "index IDX_dashboard_title already exists on table dashboard"},
+			{&indexRowCountCondition{
+				index: IfIndexNotExistsCondition{TableName: "dashboard", IndexName: "IDX_dashboard_id"},
+				rows:  RowCountCondition{TableName: "dashboard", MinRows: 10},
+			}, "table dashboard has at most 10 rows"},
+		} {
+			sql, args := tc.condition.Sql(NewDialect(x))
+			results, err := x.SQL(sql, args...).Query()
+			So(err, ShouldBeNil)
+			So(tc.condition.IsFulfilled(results), ShouldBeFalse)
+			So(tc.condition.Reason(results), ShouldEqual, tc.reason)
+		}
+	})
+}
@@ -0,0 +1,460 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+// DropConstraintMigration drops a constraint knowing only its name. Postgres
+// drops any kind of constraint with DROP CONSTRAINT, MySQL needs the type of
+// the constraint looked up first and SQLite rebuilds the table.
+type DropConstraintMigration struct {
+	MigrationBase
+	tableName      string
+	constraintName string
+}
+
+func NewDropConstraintMigration(tableName string, constraintName string) *DropConstraintMigration {
+	return &DropConstraintMigration{tableName: tableName, constraintName: constraintName}
+}
+
+func (m *DropConstraintMigration) Table(tableName string) *DropConstraintMigration {
+	m.tableName = tableName
+	return m
+}
+
+func (m *DropConstraintMigration) Constraint(constraintName string) *DropConstraintMigration {
+	m.constraintName = constraintName
+	return m
+}
+
+func (m *DropConstraintMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *DropConstraintMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return mg.Dialect.DropConstraint(sess, m.tableName, m.constraintName)
+}
+
+func (m *DropConstraintMigration) String() string {
+	return fmt.Sprintf("DropConstraint %s ON %s", m.constraintName, m.tableName)
+}
+
+// RenameConstraintMigration renames a constraint. Postgres renames it in
+// place, MySQL can only rename unique constraints in place and drops and adds
+// foreign keys and check constraints again from their definitions in the
+// information schema, SQLite rebuilds the table.
+type RenameConstraintMigration struct {
+	MigrationBase
+	tableName string
+	oldName   string
+	newName   string
+}
+
+func NewRenameConstraintMigration(tableName string, oldName string, newName string) *RenameConstraintMigration {
+	return &RenameConstraintMigration{tableName: tableName, oldName: oldName, newName: newName}
+}
+
+func (m *RenameConstraintMigration) Table(tableName string) *RenameConstraintMigration {
+	m.tableName = tableName
+	return m
+}
+
+func (m *RenameConstraintMigration) Old(name string) *RenameConstraintMigration {
+	m.oldName = name
+	return m
+}
+
+func (m *RenameConstraintMigration) New(name string) *RenameConstraintMigration {
+	m.newName = name
+	return m
+}
+
+func (m *RenameConstraintMigration) Validate(mg *Migrator) error {
+	if m.tableName == "" || m.oldName == "" || m.newName == "" {
+		return fmt.Errorf("renaming a constraint needs a table, the old and the new name")
+	}
+	return nil
+}
+
+func (m *RenameConstraintMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *RenameConstraintMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return mg.Dialect.RenameConstraint(sess, m.tableName, m.oldName, m.newName)
+}
+
+func (m *RenameConstraintMigration) String() string {
+	return fmt.Sprintf("RenameConstraint %s TO %s ON %s", m.oldName, m.newName, m.tableName)
+}
+
+// AddForeignKeyMigration adds a foreign key to an existing table, SQLite
+// rebuilds the table. Deferrable foreign keys fail validation on MySQL. Rows
+// referencing missing rows are counted first and fail the migration with
+// the count, unless OnOrphans says to set them to NULL or delete them, which
+// NotValid foreign keys reject.
+type AddForeignKeyMigration struct {
+	MigrationBase
+	tableName  string
+	foreignKey *ForeignKey
+	onOrphans  string
+}
+
+func NewAddForeignKeyMigration(tableName string, fk *ForeignKey) *AddForeignKeyMigration {
+	return &AddForeignKeyMigration{tableName: tableName, foreignKey: fk, onOrphans: OrphansFail}
+}
+
+// OnOrphans sets what to do with orphaned rows, one of the Orphans* constants.
+func (m *AddForeignKeyMigration) OnOrphans(action string) *AddForeignKeyMigration {
+	m.onOrphans = action
+	return m
+}
+
+// IfNotExists skips the migration if the table already has a constraint of
+// the name of the foreign key, e.g. when it was added by a run that failed
+// before it was recorded in the migration log.
+func (m *AddForeignKeyMigration) IfNotExists() *AddForeignKeyMigration {
+	m.Condition = &IfConstraintNotExistsCondition{TableName: m.tableName, ConstraintName: m.foreignKey.XName(m.tableName)}
+	return m
+}
+
+func (m *AddForeignKeyMigration) Validate(mg *Migrator) error {
+	if len(m.foreignKey.Cols) == 0 || len(m.foreignKey.Cols) != len(m.foreignKey.RefCols) {
+		return fmt.Errorf("foreign key %s needs as many referenced columns as columns", m.foreignKey.XName(m.tableName))
+	}
+	switch m.onOrphans {
+	case OrphansFail, OrphansSetNull, OrphansDelete:
+	default:
+		return fmt.Errorf("unknown action %q for orphaned rows of foreign key %s", m.onOrphans, m.foreignKey.XName(m.tableName))
+	}
+	// Postgres doesn't look for orphans of a NOT VALID foreign key, so they
+	// couldn't be cleaned up
+	if m.foreignKey.NotValid && m.onOrphans != OrphansFail {
+		return fmt.Errorf("foreign key %s is not valid, its orphaned rows cannot be cleaned up", m.foreignKey.XName(m.tableName))
+	}
+
+	_, err := mg.Dialect.DeferrableStr(m.foreignKey)
+	return err
+}
+
+func (m *AddForeignKeyMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *AddForeignKeyMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	// counting the orphans would scan the table NOT VALID is meant to skip,
+	// VALIDATE CONSTRAINT reports them instead
+	if !m.foreignKey.NotValid || mg.Dialect.DriverName() != POSTGRES {
+		if err := handleOrphans(sess, mg, m.tableName, m.foreignKey, m.onOrphans); err != nil {
+			return err
+		}
+	}
+	return mg.Dialect.AddForeignKey(sess, m.tableName, m.foreignKey)
+}
+
+func (m *AddForeignKeyMigration) String() string {
+	return fmt.Sprintf("AddForeignKey %s ON %s", m.foreignKey.XName(m.tableName), m.tableName)
+}
+
+// handleOrphans fails or cleans up the rows the foreign key would reject, so
+// the migration fails with the number of rows to fix rather than with the
+// error of the database.
+func handleOrphans(sess *xorm.Session, mg *Migrator, tableName string, fk *ForeignKey, action string) error {
+	dialect := mg.Dialect
+	condition := dialect.OrphanedRowsCondition(tableName, fk)
+
+	count, err := countRows(sess, dialect.CountSql(tableName, condition))
+	if err != nil || count == 0 {
+		return err
+	}
+
+	quotedTable := dialect.Quote(tableName)
+	switch action {
+	case OrphansSetNull:
+		set := make([]string, len(fk.Cols))
+		for i, col := range fk.Cols {
+			set[i] = dialect.Quote(col) + " = NULL"
+		}
+		_, err = sess.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE %s", quotedTable, strings.Join(set, ", "), condition))
+	case OrphansDelete:
+		_, err = sess.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", quotedTable, condition))
+	default:
+		return fmt.Errorf("%d rows of %s reference rows missing from %s, foreign key %s cannot be added", count, tableName, fk.RefTable, fk.XName(tableName))
+	}
+	if err != nil {
+		return err
+	}
+
+	mg.Logger.Info("Cleaned up orphaned rows", "table", tableName, "foreignKey", fk.XName(tableName), "rows", count, "action", action)
+	return nil
+}
+
+// AddForeignKeyColumnMigration adds a NOT NULL column referencing another
+// table to a populated table: the column is added as nullable, filled by the
+// backfill expression, checked for rows left without a value, made NOT NULL
+// and then gets its foreign key. The expression may refer to the columns of
+// the table, e.g. a subquery looking up the referenced row. SQLite rebuilds
+// the table twice.
+type AddForeignKeyColumnMigration struct {
+	MigrationBase
+	tableName  string
+	column     *Column
+	foreignKey *ForeignKey
+	backfill   string
+}
+
+func NewAddForeignKeyColumnMigration(table Table, col *Column, fk *ForeignKey) *AddForeignKeyColumnMigration {
+	m := &AddForeignKeyColumnMigration{tableName: table.Name, column: col, foreignKey: fk}
+	m.Condition = &IfColumnNotExistsCondition{TableName: table.Name, ColumnName: col.Name}
+	return m
+}
+
+// Backfill sets the expression the column is set to for the existing rows.
+func (m *AddForeignKeyColumnMigration) Backfill(expr string) *AddForeignKeyColumnMigration {
+	m.backfill = expr
+	return m
+}
+
+func (m *AddForeignKeyColumnMigration) Validate(mg *Migrator) error {
+	if m.backfill == "" {
+		return fmt.Errorf("column %s.%s needs a backfill expression", m.tableName, m.column.Name)
+	}
+	if m.column.Nullable {
+		return fmt.Errorf("column %s.%s is nullable, add it with an AddColumnMigration instead", m.tableName, m.column.Name)
+	}
+	if len(m.foreignKey.Cols) != 1 || m.foreignKey.Cols[0] != m.column.Name || len(m.foreignKey.RefCols) != 1 {
+		return fmt.Errorf("foreign key %s must reference one column from column %s", m.foreignKey.XName(m.tableName), m.column.Name)
+	}
+
+	_, err := mg.Dialect.DeferrableStr(m.foreignKey)
+	return err
+}
+
+func (m *AddForeignKeyColumnMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *AddForeignKeyColumnMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	quotedTable, quotedCol := dialect.Quote(m.tableName), dialect.Quote(m.column.Name)
+
+	nullable := *m.column
+	nullable.Nullable = true
+	if _, err := sess.Exec(dialect.AddColumnSql(m.tableName, &nullable)); err != nil {
+		return err
+	}
+
+	if _, err := sess.Exec(fmt.Sprintf("UPDATE %s SET %s = %s", quotedTable, quotedCol, m.backfill)); err != nil {
+		return err
+	}
+
+	missing, err := countRows(sess, dialect.CountSql(m.tableName, quotedCol+" IS NULL"))
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return fmt.Errorf("backfill left %d rows of %s without a value for %s", missing, m.tableName, m.column.Name)
+	}
+	if err := handleOrphans(sess, mg, m.tableName, m.foreignKey, OrphansFail); err != nil {
+		return err
+	}
+
+	if err := dialect.ModifyColumn(sess, m.tableName, m.column); err != nil {
+		return err
+	}
+	return dialect.AddForeignKey(sess, m.tableName, m.foreignKey)
+}
+
+func (m *AddForeignKeyColumnMigration) String() string {
+	return fmt.Sprintf("AddForeignKeyColumn %s.%s %s REFERENCES %s", m.tableName, m.column.Name, m.column.Type, m.foreignKey.RefTable)
+}
+
+// AddCheckConstraintMigration adds a check constraint to an existing table,
+// SQLite rebuilds the table. MySQL only enforces check constraints from 8.0.16
+// on, older servers parse and ignore them.
+type AddCheckConstraintMigration struct {
+	MigrationBase
+	tableName  string
+	constraint *CheckConstraint
+}
+
+func NewAddCheckConstraintMigration(tableName string, constraint *CheckConstraint) *AddCheckConstraintMigration {
+	return &AddCheckConstraintMigration{tableName: tableName, constraint: constraint}
+}
+
+// IfNotExists skips the migration if the table already has a constraint of
+// the name.
+func (m *AddCheckConstraintMigration) IfNotExists() *AddCheckConstraintMigration {
+	m.Condition = &IfConstraintNotExistsCondition{TableName: m.tableName, ConstraintName: m.constraint.Name}
+	return m
+}
+
+func (m *AddCheckConstraintMigration) Validate(mg *Migrator) error {
+	if m.constraint.Name == "" || m.constraint.Expr == "" {
+		return fmt.Errorf("check constraint on %s needs a name and an expression", m.tableName)
+	}
+	return nil
+}
+
+func (m *AddCheckConstraintMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *AddCheckConstraintMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return mg.Dialect.AddCheckConstraint(sess, m.tableName, m.constraint)
+}
+
+func (m *AddCheckConstraintMigration) String() string {
+	return fmt.Sprintf("AddCheckConstraint %s ON %s", m.constraint.Name, m.tableName)
+}
+
+// ValidateConstraintMigration checks the existing rows against a foreign key
+// or check constraint added with NotValid. Postgres validates without blocking
+// writes to the table, on the other dialects the constraint was validated when
+// it was added and the migration does nothing.
+type ValidateConstraintMigration struct {
+	MigrationBase
+	tableName      string
+	constraintName string
+}
+
+func NewValidateConstraintMigration(tableName string, constraintName string) *ValidateConstraintMigration {
+	return &ValidateConstraintMigration{tableName: tableName, constraintName: constraintName}
+}
+
+func (m *ValidateConstraintMigration) Sql(dialect Dialect) string {
+	return dialect.ValidateConstraintSql(m.tableName, m.constraintName)
+}
+
+func (m *ValidateConstraintMigration) String() string {
+	return fmt.Sprintf("ValidateConstraint %s ON %s", m.constraintName, m.tableName)
+}
+
+// AddExcludeConstraintMigration adds a Postgres exclusion constraint, other
+// dialects fail validation. A gist index over scalar types such as integers
+// or text compared with = needs the btree_gist extension, which has to be
+// created by a superuser. The constraint is dropped by name with a
+// DropConstraintMigration.
+type AddExcludeConstraintMigration struct {
+	MigrationBase
+	tableName  string
+	constraint *ExcludeConstraint
+}
+
+func NewAddExcludeConstraintMigration(tableName string, constraint *ExcludeConstraint) *AddExcludeConstraintMigration {
+	return &AddExcludeConstraintMigration{tableName: tableName, constraint: constraint}
+}
+
+// IfNotExists skips the migration if the table already has a constraint of
+// the name.
+func (m *AddExcludeConstraintMigration) IfNotExists() *AddExcludeConstraintMigration {
+	m.Condition = &IfConstraintNotExistsCondition{TableName: m.tableName, ConstraintName: m.constraint.Name}
+	return m
+}
+
+func (m *AddExcludeConstraintMigration) Validate(mg *Migrator) error {
+	if m.constraint.Name == "" {
+		return fmt.Errorf("exclude constraint on %s needs a name", m.tableName)
+	}
+	if len(m.constraint.Elements) == 0 {
+		return fmt.Errorf("exclude constraint %s has no elements", m.constraint.Name)
+	}
+	for _, element := range m.constraint.Elements {
+		if (element.Column == "") == (element.Expr == "") || element.Operator == "" {
+			return fmt.Errorf("elements of exclude constraint %s need either a column or an expression, and an operator", m.constraint.Name)
+		}
+	}
+
+	_, err := mg.Dialect.AddExcludeConstraintSql(m.tableName, m.constraint)
+	return err
+}
+
+func (m *AddExcludeConstraintMigration) Sql(dialect Dialect) string {
+	sql, _ := dialect.AddExcludeConstraintSql(m.tableName, m.constraint)
+	return sql
+}
+
+func (m *AddExcludeConstraintMigration) String() string {
+	return fmt.Sprintf("AddExcludeConstraint %s ON %s", m.constraint.Name, m.tableName)
+}
+
+// PromoteUniqueToPrimaryKeyMigration makes the columns of a unique index the
+// primary key of the table, e.g. a natural key that should cluster the rows or
+// be referenced by foreign keys. The old primary key is dropped if there is
+// one, the index is dropped as the primary key replaces it. Before anything
+// changes the columns are checked to be NOT NULL and not already part of the
+// primary key. MySQL and Postgres replace the constraints, SQLite rebuilds
+// the table. Foreign keys referencing the old primary key have to be dropped
+// first.
+type PromoteUniqueToPrimaryKeyMigration struct {
+	MigrationBase
+	tableName string
+	index     *Index
+}
+
+func NewPromoteUniqueToPrimaryKeyMigration(table Table, index *Index) *PromoteUniqueToPrimaryKeyMigration {
+	return &PromoteUniqueToPrimaryKeyMigration{tableName: table.Name, index: index}
+}
+
+func (m *PromoteUniqueToPrimaryKeyMigration) Validate(mg *Migrator) error {
+	if m.index.Type != UniqueIndex {
+		return fmt.Errorf("index %s is not a unique index", m.index.XName(m.tableName))
+	}
+	return nil
+}
+
+func (m *PromoteUniqueToPrimaryKeyMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *PromoteUniqueToPrimaryKeyMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	indexName := m.index.XName(m.tableName)
+
+	// the columns are taken from the database, not from the migration
+	indexes, err := dialect.ListIndexes(sess, m.tableName)
+	if err != nil {
+		return err
+	}
+	var index *Index
+	for _, existing := range indexes {
+		if strings.EqualFold(existing.Name, indexName) && existing.Type == UniqueIndex {
+			index = existing
+		}
+	}
+	if index == nil {
+		return fmt.Errorf("table %s has no unique index %s", m.tableName, indexName)
+	}
+
+	table, err := dialect.DescribeTable(sess, m.tableName)
+	if err != nil {
+		return err
+	}
+	cols := map[string]*Column{}
+	for _, col := range table.Columns {
+		cols[strings.ToLower(col.Name)] = col
+	}
+	for _, name := range index.Cols {
+		col, ok := cols[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("column %s of index %s not found in table %s", name, indexName, m.tableName)
+		}
+		if col.Nullable {
+			return fmt.Errorf("column %s.%s is nullable, make it NOT NULL before promoting %s to the primary key", m.tableName, name, indexName)
+		}
+		for _, pk := range table.PrimaryKeys {
+			if strings.EqualFold(pk, name) {
+				return fmt.Errorf("column %s.%s is already part of the primary key", m.tableName, name)
+			}
+		}
+	}
+
+	return dialect.ReplacePrimaryKey(sess, m.tableName, table.PrimaryKeys, index)
+}
+
+func (m *PromoteUniqueToPrimaryKeyMigration) String() string {
+	return fmt.Sprintf("PromoteUniqueToPrimaryKey %s ON %s", m.index.XName(m.tableName), m.tableName)
+}
@@ -0,0 +1,61 @@
+package migrator
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPromoteUniqueToPrimaryKeyMigration(t *testing.T) {
+	Convey("Promoting a unique index to the primary key", t, func() {
+		x := newSqliteTestEngine(t)
+		mg := NewMigrator(x)
+		sess := x.NewSession()
+		defer sess.Close()
+
+		promote := func(create string, index *Index) error {
+			execTestSql(x,
+				create,
+				"CREATE UNIQUE INDEX "+index.XName("dashboard")+" ON dashboard ("+strings.Join(index.Cols, ", ")+")",
+				"INSERT INTO dashboard (id, uid) VALUES (1, 'a'), (2, 'b')",
+			)
+			return NewPromoteUniqueToPrimaryKeyMigration(Table{Name: "dashboard"}, index).Exec(sess, mg)
+		}
+
+		Convey("rejects nullable columns", func() {
+			err := promote("CREATE TABLE dashboard (id INTEGER PRIMARY KEY, uid TEXT)", &Index{Cols: []string{"uid"}, Type: UniqueIndex})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "nullable")
+		})
+
+		Convey("rejects columns of the primary key", func() {
+			err := promote("CREATE TABLE dashboard (id INTEGER NOT NULL, uid TEXT NOT NULL, PRIMARY KEY (id))", &Index{Cols: []string{"id", "uid"}, Type: UniqueIndex})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "already part of the primary key")
+		})
+
+		Convey("replaces the primary key and drops the index", func() {
+			index := &Index{Cols: []string{"uid"}, Type: UniqueIndex}
+			err := promote("CREATE TABLE dashboard (id INTEGER PRIMARY KEY, uid TEXT NOT NULL)", index)
+			So(err, ShouldBeNil)
+
+			table, err := mg.Dialect.DescribeTable(sess, "dashboard")
+			So(err, ShouldBeNil)
+			So(table.PrimaryKeys, ShouldResemble, []string{"uid"})
+
+			indexes, err := mg.Dialect.ListIndexes(sess, "dashboard")
+			So(err, ShouldBeNil)
+			for _, existing := range indexes {
+				So(strings.ToLower(existing.Name), ShouldNotEqual, strings.ToLower(index.XName("dashboard")))
+			}
+
+			count, err := x.Table("dashboard").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			_, err = x.Exec("INSERT INTO dashboard (id, uid) VALUES (3, 'a')")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
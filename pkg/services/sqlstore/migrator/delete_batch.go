@@ -0,0 +1,83 @@
+package migrator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+const defaultDeleteBatchSize = 1000
+
+// DeleteBatchMigration deletes the rows matching a condition in batches of at
+// most BatchSize rows until none are left, e.g. for cleaning up old rows of a
+// large table. Every batch is committed on its own, see BatchedMigration, so
+// the deleted rows don't stay locked and the undo or WAL doesn't grow until
+// the migration commits. The condition is evaluated again for every batch.
+type DeleteBatchMigration struct {
+	MigrationBase
+	tableName string
+	where     string
+	batchSize int64
+	pause     time.Duration
+}
+
+func NewDeleteBatchMigration(tableName string, where string) *DeleteBatchMigration {
+	return &DeleteBatchMigration{tableName: tableName, where: where, batchSize: defaultDeleteBatchSize}
+}
+
+func (m *DeleteBatchMigration) BatchSize(size int64) *DeleteBatchMigration {
+	m.batchSize = size
+	return m
+}
+
+// Pause waits between the batches, giving other queries on the table a
+// chance to run.
+func (m *DeleteBatchMigration) Pause(pause time.Duration) *DeleteBatchMigration {
+	m.pause = pause
+	return m
+}
+
+func (m *DeleteBatchMigration) Validate(mg *Migrator) error {
+	if m.where == "" {
+		return fmt.Errorf("batched delete from %s needs a condition", m.tableName)
+	}
+	if m.batchSize <= 0 {
+		return fmt.Errorf("batched delete from %s has invalid batch size %d", m.tableName, m.batchSize)
+	}
+	return nil
+}
+
+func (m *DeleteBatchMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *DeleteBatchMigration) ExecBatches(mg *Migrator) error {
+	return m.chunkedExec().RunCommittedBatches(mg, m.deleteBatch(mg))
+}
+
+// Exec deletes the rows left after ExecBatches in the migration's
+// transaction, e.g. rows that started matching in between.
+func (m *DeleteBatchMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return m.chunkedExec().RunBatches(sess, mg, m.deleteBatch(mg))
+}
+
+func (m *DeleteBatchMigration) chunkedExec() *ChunkedExec {
+	chunked := NewChunkedExec(m.tableName, "", m.batchSize)
+	chunked.Pause = m.pause
+	return chunked
+}
+
+func (m *DeleteBatchMigration) deleteBatch(mg *Migrator) BatchFunc {
+	return func(sess *xorm.Session, limit int64) (int64, error) {
+		result, err := sess.Exec(mg.Dialect.DeleteBatchSql(m.tableName, m.where, limit))
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}
+}
+
+func (m *DeleteBatchMigration) String() string {
+	return fmt.Sprintf("DeleteBatch %s WHERE %s", m.tableName, m.where)
+}
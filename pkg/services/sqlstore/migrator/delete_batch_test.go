@@ -0,0 +1,62 @@
+package migrator
+
+import (
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func migrationLogRows(x *xorm.Engine, migrationId string) []map[string]string {
+	results, err := x.QueryString("SELECT success, error FROM migration_log WHERE migration_id = ?", migrationId)
+	So(err, ShouldBeNil)
+	return results
+}
+
+func TestDeleteBatchMigration(t *testing.T) {
+	Convey("Deleting rows in batches", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x, "CREATE TABLE event (id INTEGER PRIMARY KEY, old INTEGER)")
+		for i := 1; i <= 15; i++ {
+			_, err := x.Exec("INSERT INTO event (id, old) VALUES (?, ?)", i, i <= 12)
+			So(err, ShouldBeNil)
+		}
+		deleteOld := NewDeleteBatchMigration("event", "old = 1").BatchSize(5)
+
+		countEvents := func() int64 {
+			count, err := x.Table("event").Count()
+			So(err, ShouldBeNil)
+			return count
+		}
+
+		Convey("deletes every matching row", func() {
+			mg.AddMigration("delete old events", deleteOld)
+			So(mg.Start(), ShouldBeNil)
+			So(countEvents(), ShouldEqual, 3)
+			So(migrationLogRows(x, "delete old events"), ShouldResemble, []map[string]string{{"success": "1", "error": ""}})
+		})
+
+		Convey("keeps the committed batches when a batch fails", func() {
+			execTestSql(x, "CREATE TRIGGER keep_event BEFORE DELETE ON event WHEN OLD.id = 8 BEGIN SELECT RAISE(ABORT, 'event 8 is kept'); END")
+			mg.AddMigration("delete old events", deleteOld)
+			So(mg.Start(), ShouldNotBeNil)
+			So(countEvents(), ShouldEqual, 10)
+			So(migrationLogRows(x, "delete old events"), ShouldBeEmpty)
+
+			Convey("and deletes the rest when run again", func() {
+				execTestSql(x, "DROP TRIGGER keep_event")
+				So(mg.Start(), ShouldBeNil)
+				So(countEvents(), ShouldEqual, 3)
+				So(migrationLogRows(x, "delete old events"), ShouldResemble, []map[string]string{{"success": "1", "error": ""}})
+			})
+		})
+
+		Convey("doesn't delete anything when its condition isn't fulfilled", func() {
+			deleteOld.Condition = &IfTableExistsCondition{TableName: "missing"}
+			mg.AddMigration("delete old events", deleteOld)
+			So(mg.Start(), ShouldBeNil)
+			So(countEvents(), ShouldEqual, 15)
+		})
+	})
+}
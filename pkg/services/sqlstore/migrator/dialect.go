@@ -1,8 +1,12 @@
 package migrator
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/go-xorm/xorm"
 )
@@ -16,24 +20,114 @@ type Dialect interface {
 	EqStr() string
 	ShowCreateNull() bool
 	SqlType(col *Column) string
+	TypesEquivalent(declared string, introspected string) bool
 	SupportEngine() bool
 	LikeStr() string
+	EscapeLike(value string) string
+	LikeEscapeStr() string
 	Default(col *Column) string
 	BooleanStr(bool) string
+	BinaryStr(value []byte) string
 	DateTimeFunc(string) string
+	ZeroDateTimeExpr(expr string, replacement string) string
+	Random() string
+	OutOfRangeExpr(col *Column) string
+	JsonObjectExpr(keys []string, values []string) string
+	JsonExtractTextExpr(expr string, path []string) string
+	JsonExtractExpr(expr string, path []string) string
+	JsonValueExpr(value string) string
+	JsonSetExpr(expr string, path []string, value string) string
+	JsonRemoveExpr(expr string, path []string) string
+
+	MaxIndexColumns() int
+	MaxIndexKeyLength() int
+	IndexKeyLength(col *Column) int
+	MaxColumns() int
+	MaxRowSize() int
+	ColumnRowSize(col *Column) int
 
 	CreateIndexSql(tableName string, index *Index) string
+	NullsNotDistinctStr() (string, error)
 	CreateTableSql(table *Table) string
+	PartitionByStr(expr string) (string, error)
+	AddPartitionSql(tableName string, partitionName string, bound *PartitionBound) (string, error)
 	AddColumnSql(tableName string, col *Column) string
+	ModifyColumnSql(tableName string, col *Column) []string
+	ModifyColumn(sess *xorm.Session, tableName string, col *Column) error
+	DropColumnSql(tableName string, columnName string) []string
+	DropColumn(sess *xorm.Session, tableName string, columnName string) error
+	ReorderColumns(sess *xorm.Session, tableName string, columns []string) error
 	CopyTableData(sourceTable string, targetTable string, sourceCols []string, targetCols []string) string
+	BulkLoad(sess *xorm.Session, tableName string, data *DelimitedData, r io.Reader) (int64, error)
+	CastExpr(expr string, col *Column) string
 	DropTable(tableName string) string
+	TableLoggedSql(tableName string, logged bool) (string, error)
+	ClusterTableSql(tableName string, index *Index) (string, error)
 	DropIndexSql(tableName string, index *Index) string
+	IndexVisibilitySql(tableName string, index *Index, visible bool) (string, error)
+	DropConstraint(sess *xorm.Session, tableName string, constraintName string) error
+	RenameConstraint(sess *xorm.Session, tableName string, oldName string, newName string) error
+	AddForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error
+	AddPrimaryKey(sess *xorm.Session, tableName string, cols []string) error
+	ReplacePrimaryKey(sess *xorm.Session, tableName string, oldCols []string, index *Index) error
+	DropForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error
+	DeferrableStr(fk *ForeignKey) (string, error)
+	OrphanedRowsCondition(tableName string, fk *ForeignKey) string
+	AddExcludeConstraintSql(tableName string, constraint *ExcludeConstraint) (string, error)
+	AddCheckConstraint(sess *xorm.Session, tableName string, check *CheckConstraint) error
+	ForeignKeyChecksSql(enabled bool) string
+	SetLockTimeout(sess *xorm.Session, timeout time.Duration) (string, error)
+	ValidateConstraintSql(tableName string, constraintName string) string
 
 	RenameTable(oldName string, newName string) string
+	SwapTableSql(tableName string, newTableName string, backupTableName string) []string
+	TableScopedIndexNames() bool
+	SyncAutoIncrementSql(tableName string, col *Column) string
+	AutoIncrementStartSql(tableName string, col *Column, value int64) []string
+	SetAutoIncrementStart(sess *xorm.Session, tableName string, col *Column, value int64) error
+	CreateViewSql(viewName string, sql string) []string
+	DropViewSql(viewName string, ifExists bool, cascade bool) string
+	ViewDefinitionSql(viewName string) (string, []interface{})
+	CreateMaterializedViewSql(viewName string, sql string) (string, error)
+	RefreshMaterializedViewSql(viewName string, concurrently bool) (string, error)
+	DropMaterializedViewSql(viewName string, ifExists bool, cascade bool) (string, error)
+	CreateTriggerSql(tableName string, trigger *Trigger, body string) []string
+	DropTriggerSql(tableName string, triggerName string) []string
+	IncrementOnUpdateTriggerSql(tableName string, triggerName string, columnName string) []string
 	UpdateTableSql(tableName string, columns []*Column) string
+	CountSql(tableName string, where string) string
+	TableSizeSql(tableName string) (string, []interface{})
+	DuplicateKeysSql(tableName string, index *Index) string
+	DeleteDuplicatesSql(tableName string, index *Index, orderBy string, keyColumn string) string
+	DeleteBatchSql(tableName string, where string, limit int64) string
+	UpdateFromSql(tableName string, columnName string, sourceTable string, on string, expr string, where string) string
+	ExistsSql(subquery string) string
+	SavepointSql(name string) string
+	RollbackToSavepointSql(name string) string
+	ReleaseSavepointSql(name string) string
+	NullSafeEquals(a string, b string) string
+	Lower(expr string) string
+	Upper(expr string) string
+	Placeholder(n int) string
+	SupportsReturning() bool
+	SupportsTransactionalDDL() bool
+	ExplainSql(query string) string
+	SetTransactionIsolationSql(level string) ([]string, error)
+	SetSessionIsolationSql(level string) (string, error)
+	SetSchemaSql(schema string) (string, error)
+	OnlineDDLSql(change string, col *Column, ddl *OnlineDDL) (string, error)
+	ModifyColumnChange(sess *xorm.Session, tableName string, col *Column) (string, error)
 
+	TableCheckSql(tableName string) (string, []interface{})
 	IndexCheckSql(tableName, indexName string) (string, []interface{})
 	ColumnCheckSql(tableName, columnName string) (string, []interface{})
+	ConstraintExistsSql(tableName, constraintName string) (string, []interface{})
+	ListTables(sess *xorm.Session) ([]string, error)
+	DescribeTable(sess *xorm.Session, tableName string) (*Table, error)
+	ListIndexes(sess *xorm.Session, tableName string) ([]*Index, error)
+	ListConstraints(sess *xorm.Session, tableName string) ([]*Constraint, error)
+	IndexDefinitions(sess *xorm.Session, tableName string) ([]*IndexDefinition, error)
+	TableDependents(sess *xorm.Session, tableName string) ([]string, error)
 
 	ColString(*Column) string
 	ColStringNoPk(*Column) string
@@ -50,6 +144,16 @@ type Dialect interface {
 	IsUniqueConstraintViolation(err error) bool
 }
 
+// NotSupportedError is returned for features the database engine lacks.
+type NotSupportedError struct {
+	Feature    string
+	DriverName string
+}
+
+func (e *NotSupportedError) Error() string {
+	return fmt.Sprintf("%s: not supported by %s", e.Feature, e.DriverName)
+}
+
 func NewDialect(engine *xorm.Engine) Dialect {
 	name := engine.DriverName()
 	switch name {
@@ -74,6 +178,10 @@ func (d *BaseDialect) DriverName() string {
 	return d.driverName
 }
 
+func (d *BaseDialect) notSupported(feature string) error {
+	return &NotSupportedError{Feature: feature, DriverName: d.driverName}
+}
+
 func (b *BaseDialect) ShowCreateNull() bool {
 	return true
 }
@@ -86,10 +194,52 @@ func (b *BaseDialect) LikeStr() string {
 	return "LIKE"
 }
 
+// EscapeLike escapes the LIKE wildcards in value so it only matches itself,
+// e.g. a table named user_org doesn't match userXorg. The pattern must be
+// used together with LikeEscapeStr, as in: LIKE ? ESCAPE '\'.
+func (b *BaseDialect) EscapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+func (b *BaseDialect) LikeEscapeStr() string {
+	return `ESCAPE '\'`
+}
+
 func (b *BaseDialect) OrStr() string {
 	return "OR"
 }
 
+// TypesEquivalent reports whether a declared column type, e.g. as returned by
+// SqlType, and the type the database reports for the column are the same, so
+// a schema diff doesn't flag differences in spelling only.
+func (db *BaseDialect) TypesEquivalent(declared string, introspected string) bool {
+	return canonicalType(declared, nil) == canonicalType(introspected, nil)
+}
+
+var typeCharsetPattern = regexp.MustCompile(` (CHARACTER SET|CHARSET|COLLATE) .*$`)
+
+// canonicalType upper cases a column type, drops charset and collation and
+// replaces its name using synonyms, keeping the parenthesized arguments after
+// the replaced name. Names are matched with the words following the
+// arguments, e.g. TIMESTAMP WITHOUT TIME ZONE for TIMESTAMP(3) WITHOUT TIME ZONE.
+func canonicalType(sqlType string, synonyms map[string]string) string {
+	sqlType = strings.Join(strings.Fields(strings.ToUpper(sqlType)), " ")
+	sqlType = typeCharsetPattern.ReplaceAllString(sqlType, "")
+
+	name, args := sqlType, ""
+	if start := strings.Index(sqlType, "("); start != -1 {
+		if end := strings.Index(sqlType[start:], ")"); end != -1 {
+			name = strings.Join(strings.Fields(sqlType[:start]+" "+sqlType[start+end+1:]), " ")
+			args = strings.Replace(sqlType[start:start+end+1], " ", "", -1)
+		}
+	}
+
+	if synonym, ok := synonyms[name]; ok {
+		name = synonym
+	}
+	return name + args
+}
+
 func (b *BaseDialect) EqStr() string {
 	return "="
 }
@@ -98,10 +248,119 @@ func (b *BaseDialect) Default(col *Column) string {
 	return col.Default
 }
 
+// columnDefault renders the default of the column for the dialect, empty if
+// it has none.
+func (db *BaseDialect) columnDefault(col *Column) string {
+	if dflt := col.DialectDefaults[db.dialect.DriverName()]; dflt != "" {
+		dialectCol := *col
+		dialectCol.Default = dflt
+		col = &dialectCol
+	}
+	if col.Default == "" {
+		return ""
+	}
+	return db.dialect.Default(col)
+}
+
+// BinaryStr returns a literal of binary data, e.g. for defaults of binary
+// columns. MySQL only accepts defaults for BLOB columns from 8.0.13.
+func (db *BaseDialect) BinaryStr(value []byte) string {
+	return fmt.Sprintf("X'%X'", value)
+}
+
 func (db *BaseDialect) DateTimeFunc(value string) string {
 	return value
 }
 
+// ZeroDateTimeExpr returns expr with MySQL style zero dates ('0000-00-00')
+// replaced by the replacement expression, e.g. NULL or a sentinel literal.
+func (db *BaseDialect) ZeroDateTimeExpr(expr string, replacement string) string {
+	return fmt.Sprintf("CASE WHEN %s LIKE '0000-00-00%%' THEN %s ELSE %s END", expr, replacement, expr)
+}
+
+// Random returns an expression evaluating to a random float in [0, 1) for
+// every row, e.g. for jittering values or for ORDER BY with Limit to sample
+// rows.
+func (db *BaseDialect) Random() string {
+	return "random()"
+}
+
+// OutOfRangeExpr returns a condition matching the rows whose value of col
+// would not fit the type of col, or an empty string if every value fits.
+func (db *BaseDialect) OutOfRangeExpr(col *Column) string {
+	name := db.dialect.Quote(col.Name)
+	switch col.Type {
+	case DB_TinyInt:
+		return fmt.Sprintf("(%s < -128 OR %s > 127)", name, name)
+	case DB_SmallInt:
+		return fmt.Sprintf("(%s < -32768 OR %s > 32767)", name, name)
+	case DB_MediumInt:
+		return fmt.Sprintf("(%s < -8388608 OR %s > 8388607)", name, name)
+	case DB_Int, DB_Integer:
+		return fmt.Sprintf("(%s < -2147483648 OR %s > 2147483647)", name, name)
+	case DB_Char, DB_Varchar, DB_NVarchar:
+		if col.Length > 0 {
+			return fmt.Sprintf("CHAR_LENGTH(%s) > %d", name, col.Length)
+		}
+	}
+	return ""
+}
+
+// JsonObjectExpr returns an expression building a JSON object with the given
+// keys from the values, which are SQL expressions such as quoted columns.
+func (db *BaseDialect) JsonObjectExpr(keys []string, values []string) string {
+	return "json_object(" + jsonObjectArgs(keys, values) + ")"
+}
+
+func jsonObjectArgs(keys []string, values []string) string {
+	args := make([]string, len(keys))
+	for i, key := range keys {
+		args[i] = "'" + strings.Replace(key, "'", "''", -1) + "', " + values[i]
+	}
+	return strings.Join(args, ", ")
+}
+
+// JsonExtractTextExpr returns the value at path in the JSON document expr,
+// with strings unquoted and NULL if the path is missing. The path lists the
+// object keys to descend into.
+func (db *BaseDialect) JsonExtractTextExpr(expr string, path []string) string {
+	return "json_extract(" + expr + ", " + jsonPathLiteral(path) + ")"
+}
+
+// JsonExtractExpr returns the value at path in the JSON document expr as
+// JSON, which JsonSetExpr can store elsewhere in a document.
+func (db *BaseDialect) JsonExtractExpr(expr string, path []string) string {
+	return "json_extract(" + expr + ", " + jsonPathLiteral(path) + ")"
+}
+
+// JsonValueExpr returns the JSON text value, e.g. "draft" or {"a": 1}, as a
+// JSON expression for JsonSetExpr.
+func (db *BaseDialect) JsonValueExpr(value string) string {
+	return "json('" + strings.Replace(value, "'", "''", -1) + "')"
+}
+
+// JsonSetExpr returns the JSON document expr with the field at path set to
+// the JSON expression value, adding the field if it is missing. MySQL and
+// Postgres leave the document unchanged if a parent object is missing.
+func (db *BaseDialect) JsonSetExpr(expr string, path []string, value string) string {
+	return "json_set(" + expr + ", " + jsonPathLiteral(path) + ", " + value + ")"
+}
+
+// JsonRemoveExpr returns the JSON document expr without the field at path.
+func (db *BaseDialect) JsonRemoveExpr(expr string, path []string) string {
+	return "json_remove(" + expr + ", " + jsonPathLiteral(path) + ")"
+}
+
+// jsonPathLiteral returns path as the string literal of a JSON path in the
+// syntax of SQLite and MySQL, quoting every key.
+func jsonPathLiteral(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = `."` + strings.Replace(strings.Replace(key, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+	}
+	return "'$" + strings.Replace(strings.Join(keys, ""), "'", "''", -1) + "'"
+}
+
 func (b *BaseDialect) CreateTableSql(table *Table) string {
 	sql := "CREATE TABLE IF NOT EXISTS "
 	sql += b.dialect.Quote(table.Name) + " (\n"
@@ -132,14 +391,125 @@ func (b *BaseDialect) CreateTableSql(table *Table) string {
 		sql += " ENGINE=InnoDB DEFAULT CHARSET utf8mb4 COLLATE utf8mb4_unicode_ci"
 	}
 
+	if table.PartitionBy != "" {
+		// migrations validate the partitioning before creating tables
+		if clause, err := b.dialect.PartitionByStr(table.PartitionBy); err == nil {
+			sql += clause
+		}
+	}
+
 	sql += ";"
 	return sql
 }
 
+func (db *BaseDialect) PartitionByStr(expr string) (string, error) {
+	return "", db.notSupported("partitioning")
+}
+
+func (db *BaseDialect) AddPartitionSql(tableName string, partitionName string, bound *PartitionBound) (string, error) {
+	return "", db.notSupported("partitioning")
+}
+
 func (db *BaseDialect) AddColumnSql(tableName string, col *Column) string {
 	return fmt.Sprintf("alter table %s ADD COLUMN %s", db.dialect.Quote(tableName), col.StringNoPk(db.dialect))
 }
 
+func (db *BaseDialect) ModifyColumnSql(tableName string, col *Column) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY %s", db.dialect.Quote(tableName), col.StringNoPk(db.dialect))}
+}
+
+func (db *BaseDialect) ModifyColumn(sess *xorm.Session, tableName string, col *Column) error {
+	for _, sql := range db.dialect.ModifyColumnSql(tableName, col) {
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *BaseDialect) DropColumnSql(tableName string, columnName string) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", db.dialect.Quote(tableName), db.dialect.Quote(columnName))}
+}
+
+func (db *BaseDialect) DropColumn(sess *xorm.Session, tableName string, columnName string) error {
+	for _, sql := range db.dialect.DropColumnSql(tableName, columnName) {
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *BaseDialect) ReorderColumns(sess *xorm.Session, tableName string, columns []string) error {
+	return db.notSupported("reordering columns")
+}
+
+// columnOrder returns the existing columns with the given columns moved to
+// the front, and whether that changes the order.
+func columnOrder(tableName string, existing []string, columns []string) ([]string, bool, error) {
+	moved := map[string]bool{}
+	for _, col := range columns {
+		found := false
+		for _, name := range existing {
+			if strings.EqualFold(name, col) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false, fmt.Errorf("column %s not found on table %s", col, tableName)
+		}
+		if moved[strings.ToLower(col)] {
+			return nil, false, fmt.Errorf("column %s is listed twice", col)
+		}
+		moved[strings.ToLower(col)] = true
+	}
+
+	order := []string{}
+	for _, col := range columns {
+		for _, name := range existing {
+			if strings.EqualFold(name, col) {
+				order = append(order, name)
+			}
+		}
+	}
+	for _, name := range existing {
+		if !moved[strings.ToLower(name)] {
+			order = append(order, name)
+		}
+	}
+
+	for i, name := range order {
+		if name != existing[i] {
+			return order, true, nil
+		}
+	}
+	return order, false, nil
+}
+
+func (db *BaseDialect) MaxIndexKeyLength() int {
+	return 0
+}
+
+func (db *BaseDialect) IndexKeyLength(col *Column) int {
+	return 0
+}
+
+// MaxColumns is the maximum number of columns of a table, 0 if unknown.
+func (db *BaseDialect) MaxColumns() int {
+	return 0
+}
+
+// MaxRowSize is the maximum size of a row in bytes as estimated with
+// ColumnRowSize, 0 if rows are not limited.
+func (db *BaseDialect) MaxRowSize() int {
+	return 0
+}
+
+func (db *BaseDialect) ColumnRowSize(col *Column) int {
+	return 0
+}
+
 func (db *BaseDialect) CreateIndexSql(tableName string, index *Index) string {
 	quote := db.dialect.Quote
 	var unique string
@@ -174,6 +544,97 @@ func (db *BaseDialect) CopyTableData(sourceTable string, targetTable string, sou
 	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quote(targetTable), targetColsSql, sourceColsSql, quote(sourceTable))
 }
 
+// bulkLoadMaxParams keeps the inserts of BulkLoad within the 999 bound
+// parameters SQLite allows by default, the lowest limit of the engines.
+const bulkLoadMaxParams = 999
+
+// BulkLoad inserts the delimited rows read from r into the table with
+// multi-row inserts and returns the number of rows loaded. Postgres loads the
+// rows this way too: COPY FROM STDIN needs the copy protocol of the driver on
+// a prepared statement, which the session of a migration doesn't expose, and
+// COPY from a file on the server needs superuser rights.
+func (db *BaseDialect) BulkLoad(sess *xorm.Session, tableName string, data *DelimitedData, r io.Reader) (int64, error) {
+	if len(data.Columns) == 0 {
+		return 0, fmt.Errorf("bulk load into %s needs the columns of the rows", tableName)
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = data.comma()
+	reader.FieldsPerRecord = len(data.Columns)
+	if data.Header {
+		if _, err := reader.Read(); err != nil {
+			if err == io.EOF {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+
+	insertSql := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", db.dialect.Quote(tableName), db.QuoteColList(data.Columns))
+	rowsPerInsert := bulkLoadMaxParams / len(data.Columns)
+	values := []string{}
+	args := []interface{}{}
+	var loaded int64
+
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		if _, err := sess.Exec(insertSql+strings.Join(values, ", "), args...); err != nil {
+			return err
+		}
+		loaded += int64(len(values))
+		values, args = values[:0], args[:0]
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return loaded, err
+		}
+
+		placeholders := make([]string, len(record))
+		for i, field := range record {
+			args = append(args, field)
+			if field == data.null() {
+				args[len(args)-1] = nil
+			}
+			placeholders[i] = db.dialect.Placeholder(len(args))
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+
+		if len(values) == rowsPerInsert {
+			if err := flush(); err != nil {
+				return loaded, err
+			}
+		}
+	}
+	return loaded, flush()
+}
+
+// CastExpr converts the value of expr to the type of the column.
+func (db *BaseDialect) CastExpr(expr string, col *Column) string {
+	return fmt.Sprintf("CAST(%s AS %s)", expr, db.dialect.SqlType(castColumn(col)))
+}
+
+// castColumn returns a copy of the column rendering its plain type, SqlType
+// changes the column and turns auto increment columns into SERIAL.
+func castColumn(col *Column) *Column {
+	typeCol := *col
+	typeCol.IsAutoIncrement = false
+	switch typeCol.Type {
+	case DB_Serial:
+		typeCol.Type = DB_Int
+	case DB_BigSerial:
+		typeCol.Type = DB_BigInt
+	}
+	return &typeCol
+}
+
 func (db *BaseDialect) DropTable(tableName string) string {
 	quote := db.dialect.Quote
 	return fmt.Sprintf("DROP TABLE IF EXISTS %s", quote(tableName))
@@ -184,20 +645,495 @@ func (db *BaseDialect) RenameTable(oldName string, newName string) string {
 	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quote(oldName), quote(newName))
 }
 
+// SwapTableSql renames tableName to backupTableName and newTableName to
+// tableName, which is atomic on engines with transactional DDL. The backup
+// is dropped afterwards if it exists.
+func (db *BaseDialect) SwapTableSql(tableName string, newTableName string, backupTableName string) []string {
+	return []string{
+		db.dialect.RenameTable(tableName, backupTableName),
+		db.dialect.RenameTable(newTableName, tableName),
+	}
+}
+
+// TableScopedIndexNames reports whether index names only have to be unique
+// per table rather than per schema.
+func (db *BaseDialect) TableScopedIndexNames() bool {
+	return false
+}
+
+// SyncAutoIncrementSql moves the next auto increment value past the ids
+// inserted explicitly, e.g. by copying rows. Only needed for sequences.
+func (db *BaseDialect) SyncAutoIncrementSql(tableName string, col *Column) string {
+	return ""
+}
+
+// AutoIncrementStartSql sets the next value of an auto increment column, e.g.
+// past a range of ids reserved for seeded rows.
+func (db *BaseDialect) AutoIncrementStartSql(tableName string, col *Column, value int64) []string {
+	return nil
+}
+
+func (db *BaseDialect) SetAutoIncrementStart(sess *xorm.Session, tableName string, col *Column, value int64) error {
+	for _, sql := range db.dialect.AutoIncrementStartSql(tableName, col, value) {
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *BaseDialect) CreateViewSql(viewName string, sql string) []string {
+	return []string{fmt.Sprintf("CREATE OR REPLACE VIEW %s AS %s", db.dialect.Quote(viewName), sql)}
+}
+
+// DropViewSql drops a view, cascade only applies to dialects dropping the
+// views depending on the dropped one.
+func (db *BaseDialect) DropViewSql(viewName string, ifExists bool, cascade bool) string {
+	return dropObjectSql("VIEW", db.dialect.Quote(viewName), ifExists, false)
+}
+
+func dropObjectSql(objectType string, name string, ifExists bool, cascade bool) string {
+	sql := "DROP " + objectType + " "
+	if ifExists {
+		sql += "IF EXISTS "
+	}
+	sql += name
+	if cascade {
+		sql += " CASCADE"
+	}
+	return sql
+}
+
+// ViewDefinitionSql returns the query selecting the definition of a view as
+// definition, no rows mean the view doesn't exist.
+func (db *BaseDialect) ViewDefinitionSql(viewName string) (string, []interface{}) {
+	return "", nil
+}
+
+func (db *BaseDialect) CreateMaterializedViewSql(viewName string, sql string) (string, error) {
+	return "", db.notSupported("materialized view")
+}
+
+func (db *BaseDialect) RefreshMaterializedViewSql(viewName string, concurrently bool) (string, error) {
+	return "", db.notSupported("materialized view")
+}
+
+func (db *BaseDialect) DropMaterializedViewSql(viewName string, ifExists bool, cascade bool) (string, error) {
+	return "", db.notSupported("materialized view")
+}
+
+func (db *BaseDialect) CreateTriggerSql(tableName string, trigger *Trigger, body string) []string {
+	quote := db.dialect.Quote
+	return []string{fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW BEGIN\n%s;\nEND",
+		quote(trigger.Name), trigger.Timing, trigger.Event, quote(tableName), strings.TrimSuffix(strings.TrimSpace(body), ";"))}
+}
+
+func (db *BaseDialect) DropTriggerSql(tableName string, triggerName string) []string {
+	return []string{fmt.Sprintf("DROP TRIGGER %s", db.dialect.Quote(triggerName))}
+}
+
+// IncrementOnUpdateTriggerSql returns the statements creating a trigger that
+// increments the column on every update of a row, see
+// AddVersionColumnMigration.
+func (db *BaseDialect) IncrementOnUpdateTriggerSql(tableName string, triggerName string, columnName string) []string {
+	col := db.dialect.Quote(columnName)
+	trigger := &Trigger{Name: triggerName, Timing: TriggerBefore, Event: TriggerUpdate}
+	return db.dialect.CreateTriggerSql(tableName, trigger, fmt.Sprintf("SET NEW.%s = OLD.%s + 1", col, col))
+}
+
+// SetTransactionIsolationSql returns the statements setting the isolation
+// level of a transaction that has just been started.
+func (db *BaseDialect) SetTransactionIsolationSql(level string) ([]string, error) {
+	level, err := normalizeIsolationLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"SET TRANSACTION ISOLATION LEVEL " + level}, nil
+}
+
+// SetSessionIsolationSql returns the statement setting the isolation level
+// of the connection for the transactions started after it, for dialects that
+// only accept it outside of transactions. None by default.
+func (db *BaseDialect) SetSessionIsolationSql(level string) (string, error) {
+	_, err := normalizeIsolationLevel(level)
+	return "", err
+}
+
+// SetSchemaSql returns the statement making the current transaction resolve
+// unqualified names in the given schema.
+func (db *BaseDialect) SetSchemaSql(schema string) (string, error) {
+	return "", db.notSupported("schema")
+}
+
+// ModifyColumnChange returns the online DDL change modifying the column to
+// col is, DDLModifyColumn unless the engine can make the change cheaper.
+func (db *BaseDialect) ModifyColumnChange(sess *xorm.Session, tableName string, col *Column) (string, error) {
+	return DDLModifyColumn, nil
+}
+
+// OnlineDDLSql returns the clause appended to the statement making the change
+// to request the algorithm and lock of ddl, or an error if the change doesn't
+// support them. col is the changed column, if any.
+func (db *BaseDialect) OnlineDDLSql(change string, col *Column, ddl *OnlineDDL) (string, error) {
+	return "", nil
+}
+
+func normalizeIsolationLevel(level string) (string, error) {
+	normalized := strings.ToUpper(strings.Replace(strings.TrimSpace(level), "_", " ", -1))
+	switch normalized {
+	case IsolationReadUncommitted, IsolationReadCommitted, IsolationRepeatableRead, IsolationSerializable:
+		return normalized, nil
+	}
+	return "", fmt.Errorf("unknown transaction isolation level %q", level)
+}
+
 func (db *BaseDialect) ColumnCheckSql(tableName, columnName string) (string, []interface{}) {
 	return "", nil
 }
 
+func (db *BaseDialect) ConstraintExistsSql(tableName, constraintName string) (string, []interface{}) {
+	return "", nil
+}
+
+// ListTables returns the names of the tables of the database, without views.
+func (db *BaseDialect) ListTables(sess *xorm.Session) ([]string, error) {
+	return nil, db.notSupported("list tables")
+}
+
+// tableNames reads the table names from a query selecting them as name.
+func tableNames(sess *xorm.Session, sql string, args ...interface{}) ([]string, error) {
+	results, err := sess.SQL(sql, args...).Query()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(results))
+	for i, row := range results {
+		names[i] = string(row["name"])
+	}
+	return names, nil
+}
+
+// DescribeTable reads the columns, primary key and comments of a table from
+// the database, column types are as reported by the database.
+func (db *BaseDialect) DescribeTable(sess *xorm.Session, tableName string) (*Table, error) {
+	return nil, db.notSupported("describe table")
+}
+
+// ListIndexes reads the indexes of a table except its primary key.
+func (db *BaseDialect) ListIndexes(sess *xorm.Session, tableName string) ([]*Index, error) {
+	return nil, db.notSupported("list indexes")
+}
+
+// ListConstraints reads the constraints of a table, ordered by name.
+func (db *BaseDialect) ListConstraints(sess *xorm.Session, tableName string) ([]*Constraint, error) {
+	return nil, db.notSupported("list constraints")
+}
+
+// IndexDefinitions reads the secondary indexes of a table with their full
+// definitions, including what Index doesn't describe such as sort order or
+// the condition of a partial index. Indexes backing the primary key or a
+// constraint are left out, they can't be dropped on their own.
+func (db *BaseDialect) IndexDefinitions(sess *xorm.Session, tableName string) ([]*IndexDefinition, error) {
+	return nil, db.notSupported("index definitions")
+}
+
+// TableDependents returns the other tables referencing a table by a foreign
+// key and the views selecting from it, ordered by name. Renaming the table
+// moves these references along with it.
+func (db *BaseDialect) TableDependents(sess *xorm.Session, tableName string) ([]string, error) {
+	return nil, db.notSupported("table dependents")
+}
+
 func (db *BaseDialect) DropIndexSql(tableName string, index *Index) string {
 	quote := db.dialect.Quote
 	name := index.XName(tableName)
 	return fmt.Sprintf("DROP INDEX %v ON %s", quote(name), quote(tableName))
 }
 
+func (db *BaseDialect) DropConstraint(sess *xorm.Session, tableName string, constraintName string) error {
+	quote := db.dialect.Quote
+	_, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", quote(tableName), quote(constraintName)))
+	return err
+}
+
+func (db *BaseDialect) RenameConstraint(sess *xorm.Session, tableName string, oldName string, newName string) error {
+	quote := db.dialect.Quote
+	_, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s RENAME CONSTRAINT %s TO %s", quote(tableName), quote(oldName), quote(newName)))
+	return err
+}
+
+func (db *BaseDialect) foreignKeyDef(tableName string, fk *ForeignKey) (string, error) {
+	sql := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		db.dialect.Quote(fk.XName(tableName)), db.QuoteColList(fk.Cols), db.dialect.Quote(fk.RefTable), db.QuoteColList(fk.RefCols))
+	if fk.OnDelete != "" {
+		sql += " ON DELETE " + fk.OnDelete
+	}
+	if fk.OnUpdate != "" {
+		sql += " ON UPDATE " + fk.OnUpdate
+	}
+
+	deferrable, err := db.dialect.DeferrableStr(fk)
+	if err != nil {
+		return "", err
+	}
+	return sql + deferrable, nil
+}
+
+// DeferrableStr returns the DEFERRABLE clause of a foreign key definition,
+// including its leading space.
+func (db *BaseDialect) DeferrableStr(fk *ForeignKey) (string, error) {
+	switch {
+	case fk.InitiallyDeferred:
+		return " DEFERRABLE INITIALLY DEFERRED", nil
+	case fk.Deferrable:
+		return " DEFERRABLE INITIALLY IMMEDIATE", nil
+	}
+	return "", nil
+}
+
+// OrphanedRowsCondition matches the rows of the table referencing rows the
+// foreign key would not find. Rows with NULL in any of the columns are not
+// checked by foreign keys and don't match.
+func (db *BaseDialect) OrphanedRowsCondition(tableName string, fk *ForeignKey) string {
+	return db.orphanedRowsCondition(tableName, fk, db.dialect.Quote(fk.RefTable))
+}
+
+// orphanedRowsCondition looks the referenced rows up in refSource, the
+// referenced table or a query selecting its rows.
+func (db *BaseDialect) orphanedRowsCondition(tableName string, fk *ForeignKey, refSource string) string {
+	quote := db.dialect.Quote
+	// the alias keeps self references apart from the outer table
+	ref := quote("fk_ref")
+
+	notNull := make([]string, len(fk.Cols))
+	join := make([]string, len(fk.Cols))
+	for i, col := range fk.Cols {
+		notNull[i] = quote(tableName) + "." + quote(col) + " IS NOT NULL"
+		join[i] = ref + "." + quote(fk.RefCols[i]) + " = " + quote(tableName) + "." + quote(col)
+	}
+	return fmt.Sprintf("%s AND NOT EXISTS (SELECT 1 FROM %s %s WHERE %s)", strings.Join(notNull, " AND "), refSource, ref, strings.Join(join, " AND "))
+}
+
+func (db *BaseDialect) AddForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error {
+	def, err := db.foreignKeyDef(tableName, fk)
+	if err != nil {
+		return err
+	}
+	_, err = sess.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", db.dialect.Quote(tableName), def))
+	return err
+}
+
+// AddPrimaryKey adds a primary key to a table that has none, e.g. one created
+// with CREATE TABLE ... AS SELECT.
+func (db *BaseDialect) AddPrimaryKey(sess *xorm.Session, tableName string, cols []string) error {
+	_, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", db.dialect.Quote(tableName), db.QuoteColList(cols)))
+	return err
+}
+
+// ReplacePrimaryKey makes the columns of the unique index the primary key and
+// drops the index, in a single ALTER TABLE so the table is never left with
+// neither. oldCols are the columns of the current primary key, empty if the
+// table has none.
+func (db *BaseDialect) ReplacePrimaryKey(sess *xorm.Session, tableName string, oldCols []string, index *Index) error {
+	quote := db.dialect.Quote
+	changes := []string{}
+	if len(oldCols) > 0 {
+		changes = append(changes, "DROP PRIMARY KEY")
+	}
+	changes = append(changes, fmt.Sprintf("ADD PRIMARY KEY (%s)", db.QuoteColList(index.Cols)), "DROP INDEX "+quote(index.Name))
+	_, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s %s", quote(tableName), strings.Join(changes, ", ")))
+	return err
+}
+
+func (db *BaseDialect) DropForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error {
+	return db.dialect.DropConstraint(sess, tableName, fk.XName(tableName))
+}
+
+func (db *BaseDialect) checkConstraintDef(check *CheckConstraint) string {
+	return fmt.Sprintf("CONSTRAINT %s CHECK (%s)", db.dialect.Quote(check.Name), check.Expr)
+}
+
+func (db *BaseDialect) AddCheckConstraint(sess *xorm.Session, tableName string, check *CheckConstraint) error {
+	_, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", db.dialect.Quote(tableName), db.checkConstraintDef(check)))
+	return err
+}
+
+// SetLockTimeout sets how long statements of the session wait for a lock
+// before failing, returning the statement setting the previous timeout again,
+// see WithLockTimeout.
+func (db *BaseDialect) SetLockTimeout(sess *xorm.Session, timeout time.Duration) (string, error) {
+	return db.dialect.NoOpSql(), nil
+}
+
+// ForeignKeyChecksSql turns the foreign key checks of the session off or on
+// again, see WithoutForeignKeyChecks.
+func (db *BaseDialect) ForeignKeyChecksSql(enabled bool) string {
+	return db.dialect.NoOpSql()
+}
+
+// ValidateConstraintSql checks the existing rows against a constraint added
+// NOT VALID. Only Postgres adds constraints without checking the rows, the
+// others have nothing left to check.
+func (db *BaseDialect) ValidateConstraintSql(tableName string, constraintName string) string {
+	return db.dialect.NoOpSql()
+}
+
+func (db *BaseDialect) AddExcludeConstraintSql(tableName string, constraint *ExcludeConstraint) (string, error) {
+	return "", db.notSupported("exclude constraint")
+}
+
 func (db *BaseDialect) UpdateTableSql(tableName string, columns []*Column) string {
 	return "-- NOT REQUIRED"
 }
 
+// CountSql returns the query counting the rows of a table matching where as
+// count, all rows if where is empty.
+func (db *BaseDialect) CountSql(tableName string, where string) string {
+	sql := "SELECT COUNT(*) AS count FROM " + db.dialect.Quote(tableName)
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	return sql
+}
+
+// TableSizeSql returns the query reading the number of rows of a table as
+// row_count and its size in bytes, indexes included, as byte_size. The base
+// dialect counts the rows, with a NULL size, see TableSize.
+func (db *BaseDialect) TableSizeSql(tableName string) (string, []interface{}) {
+	return "SELECT COUNT(*) AS row_count, NULL AS byte_size FROM " + db.dialect.Quote(tableName), nil
+}
+
+// Placeholder returns the placeholder of the n-th parameter of a query,
+// counting from 1. Data migrations building parameterized queries use it
+// rather than interpolating values into the sql.
+func (db *BaseDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// SupportsReturning tells whether INSERT ... RETURNING is supported, see
+// InsertReturningId.
+func (db *BaseDialect) SupportsReturning() bool {
+	return false
+}
+
+// SupportsTransactionalDDL tells whether DDL statements are part of the
+// transaction they run in rather than committing it.
+func (db *BaseDialect) SupportsTransactionalDDL() bool {
+	return true
+}
+
+// DeleteBatchSql returns the statement deleting at most limit rows matching
+// where, run repeatedly until it deletes no more rows.
+func (db *BaseDialect) DeleteBatchSql(tableName string, where string, limit int64) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s%s", db.dialect.Quote(tableName), where, db.dialect.Limit(limit))
+}
+
+// UpdateFromSql returns the statement setting a column to an expression of
+// the matching row of another table, on is the join condition and both may
+// refer to the tables by name. Rows without a matching row are not updated.
+// where optionally restricts the updated rows. The default is a correlated
+// subquery, SQLite only has UPDATE ... FROM since 3.33.
+func (db *BaseDialect) UpdateFromSql(tableName string, columnName string, sourceTable string, on string, expr string, where string) string {
+	quote := db.dialect.Quote
+	sql := fmt.Sprintf("UPDATE %s SET %s = (SELECT %s FROM %s WHERE (%s)) WHERE EXISTS (SELECT 1 FROM %s WHERE (%s))",
+		quote(tableName), quote(columnName), expr, quote(sourceTable), on, quote(sourceTable), on)
+	if where != "" {
+		sql += " AND (" + where + ")"
+	}
+	return sql
+}
+
+// ExistsSql returns the query telling whether the subquery returns any rows
+// as found. Postgres returns a bool, MySQL and SQLite return 0 or 1, see
+// ExistsSqlResult.
+func (db *BaseDialect) ExistsSql(subquery string) string {
+	return "SELECT EXISTS (" + subquery + ") AS found"
+}
+
+// SavepointSql returns the statement setting a savepoint in the current
+// transaction, see OptionalStatement.
+func (db *BaseDialect) SavepointSql(name string) string {
+	return "SAVEPOINT " + db.dialect.Quote(name)
+}
+
+func (db *BaseDialect) RollbackToSavepointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + db.dialect.Quote(name)
+}
+
+func (db *BaseDialect) ReleaseSavepointSql(name string) string {
+	return "RELEASE SAVEPOINT " + db.dialect.Quote(name)
+}
+
+// NullSafeEquals returns the condition comparing two expressions with NULL
+// equal to NULL, e.g. for matching keys with nullable columns.
+func (db *BaseDialect) NullSafeEquals(a string, b string) string {
+	return fmt.Sprintf("(%s = %s OR (%s IS NULL AND %s IS NULL))", a, b, a, b)
+}
+
+// Lower returns expr converted to lower case, for case-insensitive
+// comparisons and indexes. SQLite only converts ASCII letters, MySQL leaves
+// binary strings unchanged.
+func (db *BaseDialect) Lower(expr string) string {
+	return "LOWER(" + expr + ")"
+}
+
+// Upper returns expr converted to upper case, with the caveats of Lower.
+func (db *BaseDialect) Upper(expr string) string {
+	return "UPPER(" + expr + ")"
+}
+
+// DuplicateKeysSql returns the query counting the key combinations of the
+// index that more than one row has, as count. Rows with NULL in a key column
+// are skipped unless the index treats NULLs as equal.
+func (db *BaseDialect) DuplicateKeysSql(tableName string, index *Index) string {
+	cols := db.QuoteColList(index.Cols)
+	sql := "SELECT " + cols + " FROM " + db.dialect.Quote(tableName)
+	if !index.NullsNotDistinct {
+		notNull := make([]string, len(index.Cols))
+		for i, col := range index.Cols {
+			notNull[i] = db.dialect.Quote(col) + " IS NOT NULL"
+		}
+		sql += " WHERE " + strings.Join(notNull, " AND ")
+	}
+	sql += " GROUP BY " + cols + " HAVING COUNT(*) > 1"
+	return "SELECT COUNT(*) AS count FROM (" + sql + ") " + db.dialect.Quote("duplicates")
+}
+
+// DeleteDuplicatesSql returns the statement deleting the rows of the table
+// whose key in the index another row has, keeping the first row of each key
+// by orderBy, by the key column if orderBy is empty. The key column has to
+// identify rows. Rows with NULL in a key column are kept, unless the index
+// treats NULLs as equal. The rows to delete are selected in a derived table
+// since MySQL doesn't allow subqueries of the table a statement deletes from.
+func (db *BaseDialect) DeleteDuplicatesSql(tableName string, index *Index, orderBy string, keyColumn string) string {
+	quote := db.dialect.Quote
+	key := quote(keyColumn)
+	if orderBy == "" {
+		orderBy = key
+	}
+
+	conditions := make([]string, 0, 2*len(index.Cols))
+	same := make([]string, len(index.Cols))
+	for i, col := range index.Cols {
+		if !index.NullsNotDistinct {
+			conditions = append(conditions, "d."+quote(col)+" IS NOT NULL")
+		}
+		same[i] = db.dialect.NullSafeEquals("k."+quote(col), "d."+quote(col))
+	}
+	keep := fmt.Sprintf("SELECT k.%s FROM %s k WHERE %s ORDER BY %s LIMIT 1", key, quote(tableName), strings.Join(same, " AND "), orderBy)
+	conditions = append(conditions, fmt.Sprintf("d.%s <> (%s)", key, keep))
+
+	// DISTINCT keeps MySQL from merging the derived table into the delete
+	duplicates := fmt.Sprintf("SELECT DISTINCT d.%s FROM %s d WHERE %s", key, quote(tableName), strings.Join(conditions, " AND "))
+	return fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT %s FROM (%s) %s)", quote(tableName), key, key, duplicates, quote("duplicates"))
+}
+
+// ExplainSql returns the statement showing the query plan of query without
+// executing it.
+func (db *BaseDialect) ExplainSql(query string) string {
+	return "EXPLAIN " + query
+}
+
 func (db *BaseDialect) ColString(col *Column) string {
 	sql := db.dialect.Quote(col.Name) + " "
 
@@ -218,8 +1154,8 @@ func (db *BaseDialect) ColString(col *Column) string {
 		}
 	}
 
-	if col.Default != "" {
-		sql += "DEFAULT " + db.dialect.Default(col) + " "
+	if dflt := db.columnDefault(col); dflt != "" {
+		sql += "DEFAULT " + dflt + " "
 	}
 
 	return sql
@@ -238,8 +1174,8 @@ func (db *BaseDialect) ColStringNoPk(col *Column) string {
 		}
 	}
 
-	if col.Default != "" {
-		sql += "DEFAULT " + db.dialect.Default(col) + " "
+	if dflt := db.columnDefault(col); dflt != "" {
+		sql += "DEFAULT " + dflt + " "
 	}
 
 	return sql
@@ -265,6 +1201,27 @@ func (db *BaseDialect) CleanDB() error {
 	return nil
 }
 
+// NullsNotDistinctStr returns the clause making unique indexes treat NULLs
+// as equal. MySQL and SQLite always treat NULLs as distinct.
+func (db *BaseDialect) NullsNotDistinctStr() (string, error) {
+	return "", db.notSupported("nulls not distinct")
+}
+
+func (db *BaseDialect) IndexVisibilitySql(tableName string, index *Index, visible bool) (string, error) {
+	return "", db.notSupported("index visibility")
+}
+
+func (db *BaseDialect) TableLoggedSql(tableName string, logged bool) (string, error) {
+	return "", db.notSupported("unlogged tables")
+}
+
+// ClusterTableSql returns the statement rewriting the table in the order of
+// the index. InnoDB always stores rows in primary key order, so on MySQL the
+// clustering is chosen with the primary key when the table is created.
+func (db *BaseDialect) ClusterTableSql(tableName string, index *Index) (string, error) {
+	return "", db.notSupported("clustering tables")
+}
+
 func (db *BaseDialect) NoOpSql() string {
 	return "SELECT 0;"
 }
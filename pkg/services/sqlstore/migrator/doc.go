@@ -0,0 +1,17 @@
+// Package migrator applies the schema migrations of the Grafana database.
+// Migrations are registered in order with Migrator.AddMigration, Start runs
+// the ones not recorded in the migration_log table yet.
+//
+// Migrator.Rollback undoes the last applied migration and removes it from
+// the migration log. Only these migrations can undo themselves, from their
+// own definition:
+//
+//	AddTableMigration      drops the table
+//	AddColumnMigration     drops the column, SQLite rebuilds the table
+//	AddIndexMigration      drops the index
+//	RenameTableMigration   renames the table back
+//
+// Migrations changing or moving data, dropping objects or running raw sql
+// can't tell what they destroyed and can't be rolled back, write a new
+// migration undoing them instead.
+package migrator
@@ -0,0 +1,108 @@
+package migrator
+
+import (
+	"github.com/go-xorm/xorm"
+)
+
+// DryRun checks the pending migrations without applying them, to catch
+// errors in generated sql before a production run. All pending migrations
+// are validated first. On SQLite the migrations, code migrations included,
+// are then applied to an in-memory database with the schema of the database
+// but none of its rows. On Postgres, where DDL is transactional, they are
+// applied in a single transaction that is rolled back: this takes the same
+// locks as the real run until the end of the dry run, and sequences used by
+// inserts stay advanced. MySQL commits DDL implicitly, so nothing is applied
+// there and only the validation runs.
+func (mg *Migrator) DryRun() error {
+	logMap, err := mg.GetMigrationLog()
+	if err != nil {
+		return err
+	}
+	if err := mg.validate(logMap); err != nil {
+		return err
+	}
+
+	switch mg.Dialect.DriverName() {
+	case SQLITE:
+		return mg.dryRunInMemory(logMap)
+	case POSTGRES:
+		return mg.dryRunRolledBack(logMap)
+	}
+	return nil
+}
+
+// dryRunRolledBack applies the pending migrations in one transaction, each
+// seeing the changes of the previous ones, and rolls it back.
+func (mg *Migrator) dryRunRolledBack(logMap map[string]MigrationLog) error {
+	sess := mg.x.NewSession()
+	defer sess.Close()
+
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+	defer sess.Rollback()
+	if err := mg.prepareSession(sess); err != nil {
+		return err
+	}
+
+	dryRun := *mg
+	dryRun.Logger = mg.Logger.New("dryRun", true)
+	dryRun.SkipRecorder = nil
+
+	for _, m := range mg.migrations {
+		if !mg.pending(m, logMap) {
+			continue
+		}
+
+		sql, statements := dryRun.logSql(m)
+		if err := dryRun.exec(m, statements, sess); err != nil && err != errMigrationDeferred {
+			return &MigrationError{Migration: m, Sql: sql, Err: err}
+		}
+	}
+	return nil
+}
+
+func (mg *Migrator) dryRunInMemory(logMap map[string]MigrationLog) error {
+	x, err := xorm.NewEngine(SQLITE, ":memory:")
+	if err != nil {
+		return err
+	}
+	defer x.Close()
+	// every connection would get its own in-memory database
+	x.SetMaxOpenConns(1)
+
+	// tables first since indexes, views and triggers refer to them
+	schema, err := mg.x.SQL("SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' ORDER BY CASE type WHEN 'table' THEN 0 ELSE 1 END, rowid").Query()
+	if err != nil {
+		return err
+	}
+	for _, row := range schema {
+		if _, err := x.Exec(string(row["sql"])); err != nil {
+			return err
+		}
+	}
+
+	dryRun := *mg
+	dryRun.x = x
+	dryRun.Dialect = NewDialect(x)
+	dryRun.Logger = mg.Logger.New("dryRun", true)
+	dryRun.SkipRecorder = nil
+
+	for _, m := range mg.migrations {
+		if !mg.pending(m, logMap) {
+			continue
+		}
+
+		sql, statements := dryRun.logSql(m)
+		err := dryRun.inTransaction(func(sess *xorm.Session) error {
+			if err := dryRun.exec(m, statements, sess); err != errMigrationDeferred {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return &MigrationError{Migration: m, Sql: sql, Err: err}
+		}
+	}
+	return nil
+}
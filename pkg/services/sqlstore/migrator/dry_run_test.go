@@ -0,0 +1,65 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDryRun(t *testing.T) {
+	Convey("Dry running migrations on SQLite", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+			"INSERT INTO dashboard (title) VALUES ('a')",
+		)
+
+		sess := x.NewSession()
+		defer sess.Close()
+
+		shouldBeUnchanged := func() {
+			tables, err := mg.Dialect.ListTables(sess)
+			So(err, ShouldBeNil)
+			So(tables, ShouldResemble, []string{"dashboard", "migration_log"})
+
+			results, err := x.QueryString("SELECT id, title FROM dashboard")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"id": "1", "title": "a"}})
+
+			count, err := x.Table("migration_log").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		}
+
+		Convey("applies the pending migrations to a copy of the schema", func() {
+			mg.AddMigration("create tag", NewAddTableMigration(Table{
+				Name:    "tag",
+				Columns: []*Column{{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true}},
+			}))
+			mg.AddMigration("add dashboard tag", NewAddColumnMigration(Table{Name: "dashboard"}, &Column{Name: "tag_id", Type: DB_BigInt, Nullable: true}))
+			// only works with the changes of the previous migrations
+			mg.AddMigration("seed tag", NewRawSqlMigration("INSERT INTO tag (id) SELECT tag_id FROM dashboard"))
+
+			So(mg.DryRun(), ShouldBeNil)
+			shouldBeUnchanged()
+		})
+
+		Convey("reports the failing migration", func() {
+			mg.AddMigration("update dashboard", NewRawSqlMigration("UPDATE dashboard SET title = 'b'"))
+			mg.AddMigration("broken", NewRawSqlMigration("UPDATE missing SET title = 'b'"))
+
+			err := mg.DryRun()
+			So(err, ShouldNotBeNil)
+			migrationErr, ok := err.(*MigrationError)
+			So(ok, ShouldBeTrue)
+			So(migrationErr.Migration.Id(), ShouldEqual, "broken")
+			shouldBeUnchanged()
+		})
+
+		Convey("leaves out applied migrations", func() {
+			execTestSql(x, "INSERT INTO migration_log (migration_id, sql, success, error, timestamp) VALUES ('broken', 'UPDATE missing SET title = ''b''', 1, '', '2019-01-01 00:00:00')")
+			mg.AddMigration("broken", NewRawSqlMigration("UPDATE missing SET title = 'b'"))
+			So(mg.DryRun(), ShouldBeNil)
+		})
+	})
+}
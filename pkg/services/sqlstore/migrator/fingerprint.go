@@ -0,0 +1,89 @@
+package migrator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// MigrationFingerprint identifies the set of migrations of the last run of
+// the migrator that applied all of them. When the registered migrations
+// have the same fingerprint Start skips reading the migration log.
+type MigrationFingerprint struct {
+	Id              int64
+	MigrationsCount int64
+	LastMigrationId string
+	Checksum        string
+	Timestamp       time.Time
+}
+
+// fingerprint returns the fingerprint of the registered migrations. The
+// checksum is of the ids of all migrations and the checksums of the
+// repeatable ones, so a changed repeatable migration doesn't get skipped.
+func (mg *Migrator) fingerprint() MigrationFingerprint {
+	fingerprint := MigrationFingerprint{MigrationsCount: int64(len(mg.migrations))}
+	hash := sha256.New()
+	for _, m := range mg.migrations {
+		hash.Write([]byte(m.Id() + "\n"))
+		if _, ok := m.(*RepeatableMigration); ok {
+			sql, _ := mg.logSql(m)
+			hash.Write([]byte(sqlChecksum(sql) + "\n"))
+		}
+		fingerprint.LastMigrationId = m.Id()
+	}
+	fingerprint.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return fingerprint
+}
+
+// fingerprintMatches tells whether the stored fingerprint is the one of the
+// registered migrations, false if there is no migration_fingerprint table.
+func (mg *Migrator) fingerprintMatches(fingerprint MigrationFingerprint) (bool, error) {
+	matches := false
+	err := mg.inTransaction(func(sess *xorm.Session) error {
+		sql, args := mg.Dialect.TableCheckSql("migration_fingerprint")
+		results, err := sess.SQL(sql, args...).Query()
+		if err != nil || len(results) == 0 {
+			return err
+		}
+
+		var stored MigrationFingerprint
+		has, err := sess.Desc("id").Get(&stored)
+		if err != nil || !has {
+			return err
+		}
+		matches = stored.MigrationsCount == fingerprint.MigrationsCount &&
+			stored.LastMigrationId == fingerprint.LastMigrationId &&
+			stored.Checksum == fingerprint.Checksum
+		return nil
+	})
+	return matches, err
+}
+
+// storeFingerprint replaces the stored fingerprint, if there is a
+// migration_fingerprint table.
+func (mg *Migrator) storeFingerprint(fingerprint MigrationFingerprint) error {
+	return mg.inTransaction(func(sess *xorm.Session) error {
+		cleared, err := mg.clearFingerprint(sess)
+		if err != nil || !cleared {
+			return err
+		}
+		fingerprint.Timestamp = time.Now()
+		_, err = sess.Insert(&fingerprint)
+		return err
+	})
+}
+
+// clearFingerprint deletes the stored fingerprint, false if there is no
+// migration_fingerprint table.
+func (mg *Migrator) clearFingerprint(sess *xorm.Session) (bool, error) {
+	sql, args := mg.Dialect.TableCheckSql("migration_fingerprint")
+	results, err := sess.SQL(sql, args...).Query()
+	if err != nil || len(results) == 0 {
+		return false, err
+	}
+
+	_, err = sess.Exec("DELETE FROM " + mg.Dialect.Quote("migration_fingerprint"))
+	return err == nil, err
+}
@@ -0,0 +1,62 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrationFingerprint(t *testing.T) {
+	Convey("Fingerprints of the registered migrations", t, func() {
+		x, _ := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE migration_fingerprint (id INTEGER PRIMARY KEY AUTOINCREMENT, migrations_count INTEGER, last_migration_id TEXT, checksum TEXT, timestamp DATETIME)",
+			"CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)",
+		)
+
+		// a new migrator per run, as after a restart
+		start := func(migrations map[string]Migration, ids ...string) error {
+			mg := NewMigrator(x)
+			for _, id := range ids {
+				mg.AddMigration(id, migrations[id])
+			}
+			return mg.Start()
+		}
+		migrations := map[string]Migration{
+			"first":  NewRawSqlMigration("INSERT INTO events (name) VALUES ('first')"),
+			"second": NewRawSqlMigration("INSERT INTO events (name) VALUES ('second')"),
+			"view":   NewRepeatableMigration(NewRawSqlMigration("INSERT INTO events (name) VALUES ('view')")),
+		}
+
+		So(start(migrations, "first", "view"), ShouldBeNil)
+		So(hookEvents(t, x), ShouldResemble, []string{"first", "view"})
+
+		Convey("skip reading the migration log when unchanged", func() {
+			execTestSql(x, "DROP TABLE migration_log")
+			So(start(migrations, "first", "view"), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{"first", "view"})
+		})
+
+		Convey("run the migrations added since", func() {
+			So(start(migrations, "first", "view", "second"), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{"first", "view", "second"})
+		})
+
+		Convey("run changed repeatable migrations", func() {
+			migrations["view"] = NewRepeatableMigration(NewRawSqlMigration("INSERT INTO events (name) VALUES ('view v2')"))
+			So(start(migrations, "first", "view"), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{"first", "view", "view v2"})
+		})
+
+		Convey("are not stored while a migration is deferred", func() {
+			deferred := NewRawSqlMigration("INSERT INTO events (name) VALUES ('deferred')")
+			deferred.Condition = &RowCountCondition{TableName: "events", MinRows: 2}
+			migrations["deferred"] = deferred
+			So(start(migrations, "first", "view", "deferred"), ShouldBeNil)
+
+			execTestSql(x, "INSERT INTO events (name) VALUES ('filler')")
+			So(start(migrations, "first", "view", "deferred"), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{"first", "view", "filler", "deferred"})
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/go-xorm/xorm"
+)
+
+// WithoutForeignKeyChecks runs fn with foreign key checks turned off for the
+// session and turns them on again afterwards, also when fn fails. See
+// Dialect.ForeignKeyChecksSql for what turning them off means per engine.
+func WithoutForeignKeyChecks(sess *xorm.Session, mg *Migrator, fn func() error) error {
+	return withSessionSetting(sess, func() (string, error) {
+		_, err := sess.Exec(mg.Dialect.ForeignKeyChecksSql(false))
+		return mg.Dialect.ForeignKeyChecksSql(true), err
+	}, fn)
+}
+
+// WithoutForeignKeyChecksMigration runs a migration with foreign key checks
+// turned off, e.g. a data reorganization that can't insert rows in the order
+// the foreign keys require. Rows violating foreign keys are not found later
+// on MySQL and Postgres, the migration has to leave consistent data behind.
+type WithoutForeignKeyChecksMigration struct {
+	wrappedMigration
+}
+
+func NewWithoutForeignKeyChecksMigration(m Migration) *WithoutForeignKeyChecksMigration {
+	return &WithoutForeignKeyChecksMigration{wrappedMigration{Migration: m}}
+}
+
+func (m *WithoutForeignKeyChecksMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return WithoutForeignKeyChecks(sess, mg, func() error {
+		return m.execWrapped(sess, mg)
+	})
+}
+
+func (m *WithoutForeignKeyChecksMigration) String() string {
+	return fmt.Sprintf("WithoutForeignKeyChecks %s", m.Migration)
+}
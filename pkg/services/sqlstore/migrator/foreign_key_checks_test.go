@@ -0,0 +1,46 @@
+package migrator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func deferForeignKeys(t *testing.T, sess *xorm.Session) string {
+	results, err := sess.QueryString("PRAGMA defer_foreign_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results[0]["defer_foreign_keys"]
+}
+
+func TestWithoutForeignKeyChecksMigration(t *testing.T) {
+	Convey("Running a migration without foreign key checks", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x, "CREATE TABLE org (id INTEGER PRIMARY KEY)")
+		mg := NewMigrator(x)
+		mg.SqlRewriter = func(id string, sql string) string {
+			return strings.Replace(sql, "{{table}}", "org", -1)
+		}
+
+		sess := x.NewSession()
+		defer sess.Close()
+		So(sess.Begin(), ShouldBeNil)
+		defer sess.Rollback()
+
+		Convey("rewrites the sql and restores the checks", func() {
+			m := NewWithoutForeignKeyChecksMigration(NewRawSqlMigration("INSERT INTO {{table}} (id) VALUES (1)"))
+			So(m.Exec(sess, mg), ShouldBeNil)
+			So(deferForeignKeys(t, sess), ShouldEqual, "0")
+		})
+
+		Convey("restores the checks after a failure", func() {
+			m := NewWithoutForeignKeyChecksMigration(NewRawSqlMigration("INSERT INTO missing (id) VALUES (1)"))
+			So(m.Exec(sess, mg), ShouldNotBeNil)
+			So(deferForeignKeys(t, sess), ShouldEqual, "0")
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package migrator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+// InsertReturningId inserts a row from a code migration and returns the id
+// the database generated for it in idColumn. It uses INSERT ... RETURNING
+// where the dialect supports it and the LastInsertId of the driver
+// otherwise, so the id has to be an integer.
+func InsertReturningId(sess *xorm.Session, dialect Dialect, tableName string, idColumn string, columns []string, values []interface{}) (int64, error) {
+	if len(columns) != len(values) {
+		return 0, fmt.Errorf("insert into %s has %d columns but %d values", tableName, len(columns), len(values))
+	}
+
+	cols := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, col := range columns {
+		cols[i] = dialect.Quote(col)
+		placeholders[i] = dialect.Placeholder(i + 1)
+	}
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", dialect.Quote(tableName), strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+
+	if !dialect.SupportsReturning() {
+		result, err := sess.Exec(sql, values...)
+		if err != nil {
+			return 0, err
+		}
+		return result.LastInsertId()
+	}
+
+	results, err := sess.SQL(sql+" RETURNING "+dialect.Quote(idColumn), values...).Query()
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, fmt.Errorf("insert into %s returned no %s", tableName, idColumn)
+	}
+	return strconv.ParseInt(string(results[0][idColumn]), 10, 64)
+}
@@ -0,0 +1,535 @@
+package migrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// FoldColumnsIntoJsonMigration writes the values of the source columns of
+// every row as a JSON object into the target column and then drops the
+// source columns. The target column must already exist. The JSON functions
+// of SQLite are only available if the driver was built with the json1 tag,
+// without them the objects are built row by row instead.
+type FoldColumnsIntoJsonMigration struct {
+	MigrationBase
+	tableName    string
+	targetColumn string
+	columns      []string
+	keys         map[string]string
+}
+
+// NewFoldColumnsIntoJsonMigration folds the columns into targetColumn, keyed
+// on their column names unless Key says otherwise.
+func NewFoldColumnsIntoJsonMigration(tableName string, targetColumn string, columns ...string) *FoldColumnsIntoJsonMigration {
+	return &FoldColumnsIntoJsonMigration{tableName: tableName, targetColumn: targetColumn, columns: columns, keys: map[string]string{}}
+}
+
+// Key sets the key the value of column is stored under.
+func (m *FoldColumnsIntoJsonMigration) Key(column string, key string) *FoldColumnsIntoJsonMigration {
+	m.keys[column] = key
+	return m
+}
+
+func (m *FoldColumnsIntoJsonMigration) objectKeys() []string {
+	keys := make([]string, len(m.columns))
+	for i, col := range m.columns {
+		keys[i] = col
+		if key, ok := m.keys[col]; ok {
+			keys[i] = key
+		}
+	}
+	return keys
+}
+
+func (m *FoldColumnsIntoJsonMigration) Validate(mg *Migrator) error {
+	if len(m.columns) == 0 {
+		return fmt.Errorf("folding into %s.%s needs at least one source column", m.tableName, m.targetColumn)
+	}
+
+	seen := map[string]bool{}
+	for i, key := range m.objectKeys() {
+		if strings.EqualFold(m.columns[i], m.targetColumn) {
+			return fmt.Errorf("column %s.%s cannot be folded into itself", m.tableName, m.targetColumn)
+		}
+		if seen[key] {
+			return fmt.Errorf("key %s is used for more than one column folded into %s.%s", key, m.tableName, m.targetColumn)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func (m *FoldColumnsIntoJsonMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *FoldColumnsIntoJsonMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	var err error
+	if mg.Dialect.DriverName() == SQLITE && !sqliteHasJson(sess) {
+		err = m.foldRows(sess, mg.Dialect)
+	} else {
+		err = m.fold(sess, mg.Dialect)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, col := range m.columns {
+		if err := mg.Dialect.DropColumn(sess, m.tableName, col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *FoldColumnsIntoJsonMigration) fold(sess *xorm.Session, dialect Dialect) error {
+	values := make([]string, len(m.columns))
+	for i, col := range m.columns {
+		values[i] = dialect.Quote(col)
+	}
+
+	sql := fmt.Sprintf("UPDATE %s SET %s = %s", dialect.Quote(m.tableName), dialect.Quote(m.targetColumn), dialect.JsonObjectExpr(m.objectKeys(), values))
+	_, err := sess.Exec(sql)
+	return err
+}
+
+// foldRows builds the objects in Go, the same way json_object would.
+func (m *FoldColumnsIntoJsonMigration) foldRows(sess *xorm.Session, dialect Dialect) error {
+	cols := make([]string, len(m.columns))
+	for i, col := range m.columns {
+		cols[i] = dialect.Quote(col)
+	}
+
+	quotedTable := dialect.Quote(m.tableName)
+	rows, err := sess.QueryInterface(fmt.Sprintf("SELECT rowid AS %s, %s FROM %s", dialect.Quote("_rowid"), strings.Join(cols, ", "), quotedTable))
+	if err != nil {
+		return err
+	}
+
+	updateSql := fmt.Sprintf("UPDATE %s SET %s = %s WHERE rowid = %s", quotedTable, dialect.Quote(m.targetColumn), dialect.Placeholder(1), dialect.Placeholder(2))
+	keys := m.objectKeys()
+	for _, row := range rows {
+		members := make([]string, len(keys))
+		for i, key := range keys {
+			value := row[m.columns[i]]
+			switch v := value.(type) {
+			case []byte:
+				value = string(v)
+			case time.Time:
+				value = v.Format("2006-01-02 15:04:05")
+			}
+
+			name, _ := json.Marshal(key)
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("unable to encode %s.%s as JSON: %v", m.tableName, m.columns[i], err)
+			}
+			members[i] = string(name) + ":" + string(encoded)
+		}
+
+		if _, err := sess.Exec(updateSql, "{"+strings.Join(members, ",")+"}", row["_rowid"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractJsonColumnMigration adds a column holding the value of a field of a
+// JSON column, e.g. to promote an attribute to a column that can be indexed.
+// Rows without the field get NULL, so a NOT NULL column fails the migration
+// if any row lacks the field. The value is cast to the type of the column.
+// Without the JSON functions SQLite extracts the values row by row.
+type ExtractJsonColumnMigration struct {
+	MigrationBase
+	tableName    string
+	sourceColumn string
+	column       *Column
+	path         []string
+}
+
+// NewExtractJsonColumnMigration adds col to the table, filled from the field
+// at path, the keys of nested objects, of the JSON in sourceColumn.
+func NewExtractJsonColumnMigration(tableName string, sourceColumn string, col *Column, path ...string) *ExtractJsonColumnMigration {
+	m := &ExtractJsonColumnMigration{tableName: tableName, sourceColumn: sourceColumn, column: col, path: path}
+	m.Condition = &IfColumnNotExistsCondition{TableName: tableName, ColumnName: col.Name}
+	return m
+}
+
+func (m *ExtractJsonColumnMigration) Validate(mg *Migrator) error {
+	if len(m.path) == 0 {
+		return fmt.Errorf("column %s.%s needs the path of the JSON field to extract", m.tableName, m.column.Name)
+	}
+	return nil
+}
+
+func (m *ExtractJsonColumnMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *ExtractJsonColumnMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	quotedTable, quotedCol := dialect.Quote(m.tableName), dialect.Quote(m.column.Name)
+
+	nullable := *m.column
+	nullable.Nullable = true
+	if _, err := sess.Exec(dialect.AddColumnSql(m.tableName, &nullable)); err != nil {
+		return err
+	}
+
+	var err error
+	if dialect.DriverName() == SQLITE && !sqliteHasJson(sess) {
+		err = m.extractRows(sess, dialect)
+	} else {
+		extract := dialect.JsonExtractTextExpr(dialect.Quote(m.sourceColumn), m.path)
+		_, err = sess.Exec(fmt.Sprintf("UPDATE %s SET %s = %s", quotedTable, quotedCol, dialect.CastExpr(extract, m.column)))
+	}
+	if err != nil {
+		return err
+	}
+
+	if m.column.Nullable {
+		return nil
+	}
+	missing, err := countRows(sess, dialect.CountSql(m.tableName, quotedCol+" IS NULL"))
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d rows of %s have no value at %s in %s for %s", missing, m.tableName, strings.Join(m.path, "."), m.sourceColumn, m.column.Name)
+	}
+	return dialect.ModifyColumn(sess, m.tableName, m.column)
+}
+
+// extractRows extracts the values in Go, the same way json_extract would.
+func (m *ExtractJsonColumnMigration) extractRows(sess *xorm.Session, dialect Dialect) error {
+	quotedTable := dialect.Quote(m.tableName)
+	rows, err := sess.QueryInterface(fmt.Sprintf("SELECT rowid AS %s, %s AS %s FROM %s", dialect.Quote("_rowid"), dialect.Quote(m.sourceColumn), dialect.Quote("_doc"), quotedTable))
+	if err != nil {
+		return err
+	}
+
+	updateSql := fmt.Sprintf("UPDATE %s SET %s = %s WHERE rowid = %s", quotedTable, dialect.Quote(m.column.Name), dialect.Placeholder(1), dialect.Placeholder(2))
+	for _, row := range rows {
+		var doc string
+		switch v := row["_doc"].(type) {
+		case nil:
+			continue
+		case []byte:
+			doc = string(v)
+		case string:
+			doc = v
+		default:
+			return fmt.Errorf("%s.%s holds %T, not JSON text", m.tableName, m.sourceColumn, v)
+		}
+
+		value, err := jsonFieldValue(doc, m.path)
+		if err != nil {
+			return fmt.Errorf("unable to decode %s.%s as JSON: %v", m.tableName, m.sourceColumn, err)
+		}
+		if value == nil {
+			continue
+		}
+		if _, err := sess.Exec(updateSql, value, row["_rowid"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonFieldValue returns the value at path in doc as json_extract does:
+// strings unquoted, booleans as 1 and 0, objects and arrays as JSON text and
+// nil for null or a missing path.
+func jsonFieldValue(doc string, path []string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}
+	return value, nil
+}
+
+func (m *ExtractJsonColumnMigration) String() string {
+	return fmt.Sprintf("ExtractJsonColumn %s.%s FROM %s", m.tableName, m.column.Name, m.sourceColumn)
+}
+
+// UpdateJsonColumnMigration changes the shape of the JSON documents stored in
+// a column: it sets, defaults, renames and removes fields in the order they
+// were added, each with an UPDATE of the rows it changes. Paths list the keys
+// of nested objects, fields are only set in objects that exist. Rows where the
+// column is NULL are left alone. On Postgres the documents are handled as
+// jsonb. Without the JSON functions SQLite updates the documents row by row,
+// which doesn't keep the order of keys.
+type UpdateJsonColumnMigration struct {
+	MigrationBase
+	tableName  string
+	columnName string
+	updates    []jsonUpdate
+	keyColumn  string
+	batchSize  int64
+}
+
+const (
+	jsonUpdateSet     = "set"
+	jsonUpdateDefault = "default"
+	jsonUpdateRename  = "rename"
+	jsonUpdateRemove  = "remove"
+)
+
+type jsonUpdate struct {
+	kind   string
+	path   []string
+	value  string
+	newKey string
+}
+
+func NewUpdateJsonColumnMigration(tableName string, columnName string) *UpdateJsonColumnMigration {
+	return &UpdateJsonColumnMigration{tableName: tableName, columnName: columnName}
+}
+
+// Set sets the field at path to the JSON text value, e.g. "draft" or 1.
+func (m *UpdateJsonColumnMigration) Set(value string, path ...string) *UpdateJsonColumnMigration {
+	m.updates = append(m.updates, jsonUpdate{kind: jsonUpdateSet, path: path, value: value})
+	return m
+}
+
+// Default sets the field at path to the JSON text value in the documents
+// without the field. MySQL keeps fields holding JSON null, the other engines
+// set those too.
+func (m *UpdateJsonColumnMigration) Default(value string, path ...string) *UpdateJsonColumnMigration {
+	m.updates = append(m.updates, jsonUpdate{kind: jsonUpdateDefault, path: path, value: value})
+	return m
+}
+
+// Rename moves the field at path to newKey in the same object.
+func (m *UpdateJsonColumnMigration) Rename(newKey string, path ...string) *UpdateJsonColumnMigration {
+	m.updates = append(m.updates, jsonUpdate{kind: jsonUpdateRename, path: path, newKey: newKey})
+	return m
+}
+
+func (m *UpdateJsonColumnMigration) Remove(path ...string) *UpdateJsonColumnMigration {
+	m.updates = append(m.updates, jsonUpdate{kind: jsonUpdateRemove, path: path})
+	return m
+}
+
+// Batch updates the rows in chunks of size consecutive values of an integer
+// key column, see ChunkedExec.
+func (m *UpdateJsonColumnMigration) Batch(keyColumn string, size int64) *UpdateJsonColumnMigration {
+	m.keyColumn = keyColumn
+	m.batchSize = size
+	return m
+}
+
+func (m *UpdateJsonColumnMigration) Validate(mg *Migrator) error {
+	if len(m.updates) == 0 {
+		return fmt.Errorf("update of JSON in %s.%s has nothing to update", m.tableName, m.columnName)
+	}
+	for _, update := range m.updates {
+		if len(update.path) == 0 {
+			return fmt.Errorf("%s of JSON in %s.%s needs the path of a field", update.kind, m.tableName, m.columnName)
+		}
+		if (update.kind == jsonUpdateSet || update.kind == jsonUpdateDefault) && !json.Valid([]byte(update.value)) {
+			return fmt.Errorf("value %s for %s.%s is not valid JSON", update.value, m.tableName, m.columnName)
+		}
+	}
+	if m.keyColumn != "" && m.batchSize <= 0 {
+		return fmt.Errorf("update of JSON in %s.%s has invalid batch size %d", m.tableName, m.columnName, m.batchSize)
+	}
+	return nil
+}
+
+func (m *UpdateJsonColumnMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *UpdateJsonColumnMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	if dialect.DriverName() == SQLITE && !sqliteHasJson(sess) {
+		return m.updateRows(sess, dialect)
+	}
+
+	for _, update := range m.updates {
+		set, where := m.updateSql(dialect, update)
+		sql := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s", dialect.Quote(m.tableName), dialect.Quote(m.columnName), set, where)
+
+		if m.keyColumn == "" {
+			if _, err := sess.Exec(sql); err != nil {
+				return err
+			}
+			continue
+		}
+
+		quotedKey := dialect.Quote(m.keyColumn)
+		sql += fmt.Sprintf(" AND %s >= %s AND %s < %s", quotedKey, dialect.Placeholder(1), quotedKey, dialect.Placeholder(2))
+		chunked := NewChunkedExec(m.tableName, m.keyColumn, m.batchSize)
+		err := chunked.Run(sess, mg, func(sess *xorm.Session, from int64, to int64) (int64, error) {
+			result, err := sess.Exec(sql, from, to)
+			if err != nil {
+				return 0, err
+			}
+			return result.RowsAffected()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateSql returns the new value of the column and the condition matching
+// the rows the update changes.
+func (m *UpdateJsonColumnMigration) updateSql(dialect Dialect, update jsonUpdate) (string, string) {
+	doc := dialect.Quote(m.columnName)
+	where := doc + " IS NOT NULL"
+
+	switch update.kind {
+	case jsonUpdateDefault:
+		return dialect.JsonSetExpr(doc, update.path, dialect.JsonValueExpr(update.value)), where + " AND " + dialect.JsonExtractTextExpr(doc, update.path) + " IS NULL"
+	case jsonUpdateRename:
+		newPath := append(append([]string{}, update.path[:len(update.path)-1]...), update.newKey)
+		moved := dialect.JsonSetExpr(doc, newPath, dialect.JsonExtractExpr(doc, update.path))
+		return dialect.JsonRemoveExpr(moved, update.path), where + " AND " + dialect.JsonExtractExpr(doc, update.path) + " IS NOT NULL"
+	case jsonUpdateRemove:
+		return dialect.JsonRemoveExpr(doc, update.path), where + " AND " + dialect.JsonExtractExpr(doc, update.path) + " IS NOT NULL"
+	}
+	return dialect.JsonSetExpr(doc, update.path, dialect.JsonValueExpr(update.value)), where
+}
+
+// updateRows applies the updates in Go, the way the SQLite JSON functions
+// would.
+func (m *UpdateJsonColumnMigration) updateRows(sess *xorm.Session, dialect Dialect) error {
+	quotedTable, quotedCol := dialect.Quote(m.tableName), dialect.Quote(m.columnName)
+	rows, err := sess.QueryInterface(fmt.Sprintf("SELECT rowid AS %s, %s AS %s FROM %s WHERE %s IS NOT NULL", dialect.Quote("_rowid"), quotedCol, dialect.Quote("_doc"), quotedTable, quotedCol))
+	if err != nil {
+		return err
+	}
+
+	updateSql := fmt.Sprintf("UPDATE %s SET %s = %s WHERE rowid = %s", quotedTable, quotedCol, dialect.Placeholder(1), dialect.Placeholder(2))
+	for _, row := range rows {
+		var doc string
+		switch v := row["_doc"].(type) {
+		case []byte:
+			doc = string(v)
+		case string:
+			doc = v
+		default:
+			return fmt.Errorf("%s.%s holds %T, not JSON text", m.tableName, m.columnName, v)
+		}
+
+		updated, changed, err := m.updateDocument(doc)
+		if err != nil {
+			return fmt.Errorf("unable to update JSON in %s.%s: %v", m.tableName, m.columnName, err)
+		}
+		if !changed {
+			continue
+		}
+		if _, err := sess.Exec(updateSql, updated, row["_rowid"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *UpdateJsonColumnMigration) updateDocument(doc string) (string, bool, error) {
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return "", false, err
+	}
+
+	changed := false
+	for _, update := range m.updates {
+		last := update.path[len(update.path)-1]
+		parent := jsonParent(root, update.path)
+		if parent == nil {
+			continue
+		}
+		current, exists := parent[last]
+
+		switch update.kind {
+		case jsonUpdateSet, jsonUpdateDefault:
+			if update.kind == jsonUpdateDefault && exists && current != nil {
+				continue
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(update.value), &value); err != nil {
+				return "", false, err
+			}
+			parent[last] = value
+		case jsonUpdateRename:
+			// json_extract returns NULL for JSON null, which is not moved
+			if current == nil {
+				continue
+			}
+			delete(parent, last)
+			parent[update.newKey] = current
+		case jsonUpdateRemove:
+			if !exists {
+				continue
+			}
+			delete(parent, last)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return doc, false, nil
+	}
+	encoded, err := json.Marshal(root)
+	return string(encoded), true, err
+}
+
+// jsonParent returns the object holding the last key of path, nil if there
+// is none.
+func jsonParent(root interface{}, path []string) map[string]interface{} {
+	object, ok := root.(map[string]interface{})
+	for _, key := range path[:len(path)-1] {
+		if !ok {
+			return nil
+		}
+		object, ok = object[key].(map[string]interface{})
+	}
+	if !ok {
+		return nil
+	}
+	return object
+}
+
+func (m *UpdateJsonColumnMigration) String() string {
+	return fmt.Sprintf("UpdateJsonColumn %s.%s (%d updates)", m.tableName, m.columnName, len(m.updates))
+}
+
+func sqliteHasJson(sess *xorm.Session) bool {
+	_, err := sess.Exec("SELECT json_object()")
+	return err == nil
+}
+
+func (m *FoldColumnsIntoJsonMigration) String() string {
+	return fmt.Sprintf("FoldColumnsIntoJson %s (%s) INTO %s", m.tableName, strings.Join(m.columns, ", "), m.targetColumn)
+}
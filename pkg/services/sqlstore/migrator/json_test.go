@@ -0,0 +1,69 @@
+package migrator
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateJsonColumnMigration(t *testing.T) {
+	docs := []struct {
+		doc      string
+		expected string
+	}{
+		{`{"panel":{"title":"a","type":"graph"},"legacy":1}`, `{"panel":{"title":"a","kind":"graph","version":"v2"}}`},
+		// no parent object, nothing is set
+		{`{"other":1}`, `{"other":1}`},
+		{`{"panel":{"title":null}}`, `{"panel":{"title":"untitled","version":"v2"}}`},
+		// JSON null is not moved
+		{`{"panel":{"type":null}}`, `{"panel":{"type":null,"title":"untitled","version":"v2"}}`},
+	}
+
+	Convey("Updating fields of a JSON column", t, func() {
+		x := newSqliteTestEngine(t)
+		mg := NewMigrator(x)
+		execTestSql(x, "CREATE TABLE dashboard (id INTEGER PRIMARY KEY, data TEXT)")
+		for i, doc := range docs {
+			_, err := x.Exec("INSERT INTO dashboard (id, data) VALUES (?, ?)", i, doc.doc)
+			So(err, ShouldBeNil)
+		}
+		_, err := x.Exec("INSERT INTO dashboard (id, data) VALUES (?, NULL)", len(docs))
+		So(err, ShouldBeNil)
+
+		m := NewUpdateJsonColumnMigration("dashboard", "data").
+			Set(`"v2"`, "panel", "version").
+			Default(`"untitled"`, "panel", "title").
+			Rename("kind", "panel", "type").
+			Remove("legacy")
+
+		sess := x.NewSession()
+		defer sess.Close()
+
+		shouldBeUpdated := func() {
+			results, err := x.QueryString("SELECT data FROM dashboard ORDER BY id")
+			So(err, ShouldBeNil)
+			for i, doc := range docs {
+				var updated, expected interface{}
+				So(json.Unmarshal([]byte(results[i]["data"]), &updated), ShouldBeNil)
+				So(json.Unmarshal([]byte(doc.expected), &expected), ShouldBeNil)
+				So(updated, ShouldResemble, expected)
+			}
+			So(results[len(docs)]["data"], ShouldEqual, "")
+		}
+
+		Convey("with the JSON functions", func() {
+			// SQLite may be built without them
+			if !sqliteHasJson(sess) {
+				return
+			}
+			So(m.Exec(sess, mg), ShouldBeNil)
+			shouldBeUpdated()
+		})
+
+		Convey("row by row", func() {
+			So(m.updateRows(sess, mg.Dialect), ShouldBeNil)
+			shouldBeUpdated()
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package migrator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// WithLockTimeout runs fn with statements waiting at most timeout for a lock
+// and sets the previous timeout again afterwards, also when fn fails. See
+// Dialect.SetLockTimeout for the setting of each engine.
+func WithLockTimeout(sess *xorm.Session, mg *Migrator, timeout time.Duration, fn func() error) error {
+	return withSessionSetting(sess, func() (string, error) {
+		return mg.Dialect.SetLockTimeout(sess, timeout)
+	}, fn)
+}
+
+// LockTimeoutMigration runs a migration failing after timeout if it can't get
+// a lock, e.g. DDL on a busy table that would otherwise wait for long running
+// queries and block every query queued behind it. The timeout applies to each
+// statement, not to the whole migration.
+type LockTimeoutMigration struct {
+	wrappedMigration
+	timeout time.Duration
+}
+
+// LockTimeout wraps a migration in a LockTimeoutMigration.
+func LockTimeout(m Migration, timeout time.Duration) *LockTimeoutMigration {
+	return &LockTimeoutMigration{wrappedMigration: wrappedMigration{Migration: m}, timeout: timeout}
+}
+
+func (m *LockTimeoutMigration) Validate(mg *Migrator) error {
+	if m.timeout <= 0 {
+		return fmt.Errorf("invalid lock timeout %s for %s", m.timeout, m.Migration)
+	}
+	return m.wrappedMigration.Validate(mg)
+}
+
+func (m *LockTimeoutMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return WithLockTimeout(sess, mg, m.timeout, func() error {
+		return m.execWrapped(sess, mg)
+	})
+}
+
+func (m *LockTimeoutMigration) String() string {
+	return fmt.Sprintf("LockTimeout %s %s", m.timeout, m.Migration)
+}
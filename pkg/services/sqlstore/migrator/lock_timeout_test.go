@@ -0,0 +1,62 @@
+package migrator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func busyTimeout(sess *xorm.Session) string {
+	results, err := sess.QueryString("PRAGMA busy_timeout")
+	So(err, ShouldBeNil)
+	return results[0]["timeout"]
+}
+
+func TestWithLockTimeout(t *testing.T) {
+	Convey("Running with a lock timeout", t, func() {
+		x := newSqliteTestEngine(t)
+		mg := NewMigrator(x)
+		sess := x.NewSession()
+		defer sess.Close()
+		previous := busyTimeout(sess)
+
+		Convey("sets the timeout and restores the previous one", func() {
+			err := WithLockTimeout(sess, mg, 1500*time.Microsecond, func() error {
+				So(busyTimeout(sess), ShouldEqual, "2")
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(busyTimeout(sess), ShouldEqual, previous)
+		})
+
+		Convey("restores the previous timeout after a failure", func() {
+			failed := errors.New("failed")
+			So(WithLockTimeout(sess, mg, time.Second, func() error { return failed }), ShouldEqual, failed)
+			So(busyTimeout(sess), ShouldEqual, previous)
+		})
+
+		Convey("rejects migrations without a timeout", func() {
+			So(LockTimeout(NewRawSqlMigration("SELECT 1"), 0).Validate(mg), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLockTimeoutSql(t *testing.T) {
+	Convey("Lock timeout statements", t, func() {
+		Convey("on MySQL are in whole seconds, at least one", func() {
+			So(mysqlLockTimeoutSeconds(1500*time.Millisecond), ShouldEqual, 2)
+			So(mysqlLockTimeoutSeconds(10*time.Millisecond), ShouldEqual, 1)
+			So(mysqlLockTimeoutSql("50", "31536000"), ShouldEqual, "SET SESSION innodb_lock_wait_timeout = 50, lock_wait_timeout = 31536000")
+		})
+
+		Convey("on Postgres restore the setting as a literal", func() {
+			So(postgresLockTimeoutSql("500"), ShouldEqual, "SET LOCAL lock_timeout = '500'")
+			So(postgresLockTimeoutSql("2s"), ShouldEqual, "SET LOCAL lock_timeout = '2s'")
+			So(postgresLockTimeoutSql("it's"), ShouldEqual, "SET LOCAL lock_timeout = 'it''s'")
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package migrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MigrationLogSnapshot is the migration log of a database in a portable form,
+// e.g. to compare which migrations ran in staging and production, see
+// ExportLog and CompareLogs. The log doesn't record how long migrations took,
+// MigrationMetrics reports that.
+type MigrationLogSnapshot struct {
+	Migrations []MigrationLogEntry `json:"migrations"`
+}
+
+// MigrationLogEntry is the last successful run of a migration, in UTC. The
+// checksum is the one repeatable migrations are compared by.
+type MigrationLogEntry struct {
+	Id        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Checksum  string    `json:"checksum"`
+}
+
+// ExportLog returns the migration log as a JSON snapshot. Migrations are in
+// the order they ran, so exporting the same log twice gives the same document.
+func (mg *Migrator) ExportLog() ([]byte, error) {
+	logMap, err := mg.GetMigrationLog()
+	if err != nil {
+		return nil, err
+	}
+
+	logItems := make([]MigrationLog, 0, len(logMap))
+	for _, logItem := range logMap {
+		logItems = append(logItems, logItem)
+	}
+	// timestamps have a resolution of seconds, the log id keeps the order
+	sort.Slice(logItems, func(i, j int) bool { return logItems[i].Id < logItems[j].Id })
+
+	snapshot := MigrationLogSnapshot{Migrations: make([]MigrationLogEntry, len(logItems))}
+	for i, logItem := range logItems {
+		snapshot.Migrations[i] = MigrationLogEntry{Id: logItem.MigrationId, Timestamp: logItem.Timestamp.UTC(), Checksum: logItem.Checksum()}
+	}
+	return json.MarshalIndent(snapshot, "", "  ")
+}
+
+// ImportLog reads a snapshot written by ExportLog.
+func ImportLog(data []byte) (*MigrationLogSnapshot, error) {
+	snapshot := &MigrationLogSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(snapshot.Migrations))
+	for _, entry := range snapshot.Migrations {
+		if seen[entry.Id] {
+			return nil, fmt.Errorf("migration %s is in the snapshot twice", entry.Id)
+		}
+		seen[entry.Id] = true
+	}
+	return snapshot, nil
+}
+
+const DiffChecksum = "checksum"
+
+// MigrationLogDifference is a difference between two migration logs. Kind is
+// DiffOnlyInA, DiffOnlyInB or DiffChecksum, A and B hold the timestamps of
+// the migration in each log, or its checksums if they differ.
+type MigrationLogDifference struct {
+	Id   string
+	Kind string
+	A    string
+	B    string
+}
+
+func (d MigrationLogDifference) String() string {
+	switch d.Kind {
+	case DiffOnlyInA:
+		return fmt.Sprintf("migration %s: %s, ran %s", d.Id, d.Kind, d.A)
+	case DiffOnlyInB:
+		return fmt.Sprintf("migration %s: %s, ran %s", d.Id, d.Kind, d.B)
+	}
+	return fmt.Sprintf("migration %s: %s differs, a has %s, b has %s", d.Id, d.Kind, d.A, d.B)
+}
+
+// CompareLogs compares two migration log snapshots, listing the migrations
+// that ran in only one of them and those that ran different sql. When they
+// ran is not compared.
+func CompareLogs(a *MigrationLogSnapshot, b *MigrationLogSnapshot) []MigrationLogDifference {
+	entriesB := make(map[string]MigrationLogEntry, len(b.Migrations))
+	for _, entry := range b.Migrations {
+		entriesB[entry.Id] = entry
+	}
+
+	differences := []MigrationLogDifference{}
+	inA := make(map[string]bool, len(a.Migrations))
+	for _, entryA := range a.Migrations {
+		inA[entryA.Id] = true
+		entryB, ok := entriesB[entryA.Id]
+		switch {
+		case !ok:
+			differences = append(differences, MigrationLogDifference{Id: entryA.Id, Kind: DiffOnlyInA, A: entryA.Timestamp.Format(time.RFC3339)})
+		case entryA.Checksum != entryB.Checksum:
+			differences = append(differences, MigrationLogDifference{Id: entryA.Id, Kind: DiffChecksum, A: entryA.Checksum, B: entryB.Checksum})
+		}
+	}
+
+	for _, entryB := range b.Migrations {
+		if !inA[entryB.Id] {
+			differences = append(differences, MigrationLogDifference{Id: entryB.Id, Kind: DiffOnlyInB, B: entryB.Timestamp.Format(time.RFC3339)})
+		}
+	}
+	return differences
+}
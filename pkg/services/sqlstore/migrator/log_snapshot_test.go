@@ -0,0 +1,71 @@
+package migrator
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareLogs(t *testing.T) {
+	Convey("Comparing migration logs", t, func() {
+		ran := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+		entry := func(id string, checksum string) MigrationLogEntry {
+			return MigrationLogEntry{Id: id, Timestamp: ran, Checksum: checksum}
+		}
+		compare := func(a []MigrationLogEntry, b []MigrationLogEntry) []MigrationLogDifference {
+			return CompareLogs(&MigrationLogSnapshot{Migrations: a}, &MigrationLogSnapshot{Migrations: b})
+		}
+
+		Convey("ignores timestamps", func() {
+			differences := compare(
+				[]MigrationLogEntry{entry("create user table", "1")},
+				[]MigrationLogEntry{{Id: "create user table", Timestamp: ran.Add(time.Hour), Checksum: "1"}},
+			)
+			So(differences, ShouldResemble, []MigrationLogDifference{})
+		})
+
+		Convey("reports migrations only in a", func() {
+			differences := compare(
+				[]MigrationLogEntry{entry("create user table", "1"), entry("add index", "2")},
+				[]MigrationLogEntry{entry("create user table", "1")},
+			)
+			So(differences, ShouldResemble, []MigrationLogDifference{
+				{Id: "add index", Kind: DiffOnlyInA, A: ran.Format(time.RFC3339)},
+			})
+		})
+
+		Convey("reports migrations only in b", func() {
+			differences := compare(
+				[]MigrationLogEntry{entry("create user table", "1")},
+				[]MigrationLogEntry{entry("create user table", "1"), entry("add index", "2")},
+			)
+			So(differences, ShouldResemble, []MigrationLogDifference{
+				{Id: "add index", Kind: DiffOnlyInB, B: ran.Format(time.RFC3339)},
+			})
+		})
+
+		Convey("reports checksum mismatches", func() {
+			differences := compare(
+				[]MigrationLogEntry{entry("create user table", "1")},
+				[]MigrationLogEntry{entry("create user table", "2")},
+			)
+			So(differences, ShouldResemble, []MigrationLogDifference{
+				{Id: "create user table", Kind: DiffChecksum, A: "1", B: "2"},
+			})
+		})
+	})
+}
+
+func TestImportLog(t *testing.T) {
+	Convey("Importing a migration log", t, func() {
+		Convey("rejects migrations listed twice", func() {
+			data := []byte(`{"migrations": [
+				{"id": "create user table", "timestamp": "2019-06-01T12:00:00Z", "checksum": "1"},
+				{"id": "create user table", "timestamp": "2019-06-02T12:00:00Z", "checksum": "2"}
+			]}`)
+			_, err := ImportLog(data)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,155 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+// MergeTablesMigration moves the rows of a table into another one and drops
+// it, e.g. when consolidating an old table into its replacement. colMap maps
+// the target columns to the source columns, like CopyTableDataMigration. Rows
+// whose key is already in the target table fail the migration with their
+// count, unless OnConflict says to skip them or to update the target rows. The
+// target table must have as many rows as expected afterwards, otherwise the
+// migration fails before the source table is dropped. Everything happens in
+// the migration's transaction, the drop comes last since MySQL commits it.
+type MergeTablesMigration struct {
+	MigrationBase
+	sourceTable string
+	targetTable string
+	sourceCols  []string
+	targetCols  []string
+	onConflict  string
+	keyCols     []string
+}
+
+func NewMergeTablesMigration(targetTable string, sourceTable string, colMap map[string]string) *MergeTablesMigration {
+	m := &MergeTablesMigration{sourceTable: sourceTable, targetTable: targetTable, onConflict: ConflictsFail}
+	for key, value := range colMap {
+		m.targetCols = append(m.targetCols, key)
+		m.sourceCols = append(m.sourceCols, value)
+	}
+	return m
+}
+
+// OnConflict sets what to do with source rows whose values in the given target
+// columns, e.g. those of a unique index, match a target row, one of the
+// Conflicts* constants. Without key columns conflicts are left to the
+// constraints of the target table.
+func (m *MergeTablesMigration) OnConflict(action string, keyCols ...string) *MergeTablesMigration {
+	m.onConflict = action
+	m.keyCols = keyCols
+	return m
+}
+
+func (m *MergeTablesMigration) Validate(mg *Migrator) error {
+	if len(m.targetCols) == 0 {
+		return fmt.Errorf("merging %s into %s needs columns to copy", m.sourceTable, m.targetTable)
+	}
+	switch m.onConflict {
+	case ConflictsFail, ConflictsSkip, ConflictsUpdate:
+	default:
+		return fmt.Errorf("unknown action %q for conflicts merging %s into %s", m.onConflict, m.sourceTable, m.targetTable)
+	}
+	for _, key := range m.keyCols {
+		if m.sourceCol(key) == "" {
+			return fmt.Errorf("key column %s is not copied to %s", key, m.targetTable)
+		}
+	}
+	return nil
+}
+
+// sourceCol returns the source column copied to the target column.
+func (m *MergeTablesMigration) sourceCol(targetCol string) string {
+	for i, col := range m.targetCols {
+		if col == targetCol {
+			return m.sourceCols[i]
+		}
+	}
+	return ""
+}
+
+func (m *MergeTablesMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *MergeTablesMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	quote := dialect.Quote
+
+	targetCount, err := countRows(sess, dialect.CountSql(m.targetTable, ""))
+	if err != nil {
+		return err
+	}
+	sourceCount, err := countRows(sess, dialect.CountSql(m.sourceTable, ""))
+	if err != nil {
+		return err
+	}
+
+	// matches the target row of a source row, both tables referred to by name
+	on := make([]string, len(m.keyCols))
+	for i, key := range m.keyCols {
+		on[i] = quote(m.targetTable) + "." + quote(key) + " = " + quote(m.sourceTable) + "." + quote(m.sourceCol(key))
+	}
+	conflicting := fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", quote(m.targetTable), strings.Join(on, " AND "))
+
+	var conflicts int64
+	if len(m.keyCols) > 0 {
+		if conflicts, err = countRows(sess, dialect.CountSql(m.sourceTable, conflicting)); err != nil {
+			return err
+		}
+	}
+	if conflicts > 0 && m.onConflict == ConflictsFail {
+		return fmt.Errorf("%d rows of %s have the same %s as rows of %s", conflicts, m.sourceTable, strings.Join(m.keyCols, ", "), m.targetTable)
+	}
+
+	if conflicts > 0 && m.onConflict == ConflictsUpdate {
+		for i, col := range m.targetCols {
+			if m.isKey(col) {
+				continue
+			}
+			sql := dialect.UpdateFromSql(m.targetTable, col, m.sourceTable, strings.Join(on, " AND "), quote(m.sourceTable)+"."+quote(m.sourceCols[i]), "")
+			if _, err := sess.Exec(sql); err != nil {
+				return err
+			}
+		}
+	}
+
+	sourceExprs := make([]string, len(m.sourceCols))
+	for i, col := range m.sourceCols {
+		sourceExprs[i] = quote(m.sourceTable) + "." + quote(col)
+	}
+	sql := copyTableDataSql(dialect, m.sourceTable, m.targetTable, sourceExprs, m.targetCols)
+	if conflicts > 0 {
+		sql += " WHERE NOT " + conflicting
+	}
+	if _, err := sess.Exec(sql); err != nil {
+		return err
+	}
+
+	count, err := countRows(sess, dialect.CountSql(m.targetTable, ""))
+	if err != nil {
+		return err
+	}
+	if expected := targetCount + sourceCount - conflicts; count != expected {
+		return fmt.Errorf("expected %d rows in %s after merging %s, found %d", expected, m.targetTable, m.sourceTable, count)
+	}
+
+	_, err = sess.Exec(dialect.DropTable(m.sourceTable))
+	return err
+}
+
+func (m *MergeTablesMigration) isKey(targetCol string) bool {
+	for _, key := range m.keyCols {
+		if key == targetCol {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MergeTablesMigration) String() string {
+	return fmt.Sprintf("MergeTables %s -> %s (%d columns)", m.sourceTable, m.targetTable, len(m.targetCols))
+}
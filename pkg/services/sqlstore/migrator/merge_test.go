@@ -0,0 +1,73 @@
+package migrator
+
+import (
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func tagUses(t *testing.T, x *xorm.Engine) map[string]string {
+	results, err := x.QueryString("SELECT term, uses FROM dashboard_tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uses := map[string]string{}
+	for _, row := range results {
+		uses[row["term"]] = row["uses"]
+	}
+	return uses
+}
+
+func tableExists(t *testing.T, x *xorm.Engine, tableName string) bool {
+	return isFulfilled(t, x, &IfTableExistsCondition{TableName: tableName})
+}
+
+func TestMergeTablesMigration(t *testing.T) {
+	Convey("Merging two tables", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard_tag (id INTEGER PRIMARY KEY, term TEXT UNIQUE, uses INTEGER)",
+			"CREATE TABLE old_tag (id INTEGER PRIMARY KEY, term TEXT, uses INTEGER)",
+			"INSERT INTO dashboard_tag (term, uses) VALUES ('prod', 1)",
+			"INSERT INTO old_tag (term, uses) VALUES ('prod', 2), ('dev', 3)",
+		)
+		merge := NewMergeTablesMigration("dashboard_tag", "old_tag", map[string]string{
+			"term": "term",
+			"uses": "uses",
+		})
+
+		Convey("fails on conflicts and keeps the source table", func() {
+			mg.AddMigration("merge tags", merge.OnConflict(ConflictsFail, "term"))
+			So(mg.Start(), ShouldNotBeNil)
+			So(tagUses(t, x), ShouldResemble, map[string]string{"prod": "1"})
+			So(tableExists(t, x, "old_tag"), ShouldBeTrue)
+		})
+
+		Convey("skips conflicting rows", func() {
+			mg.AddMigration("merge tags", merge.OnConflict(ConflictsSkip, "term"))
+			So(mg.Start(), ShouldBeNil)
+			So(tagUses(t, x), ShouldResemble, map[string]string{"prod": "1", "dev": "3"})
+			So(tableExists(t, x, "old_tag"), ShouldBeFalse)
+		})
+
+		Convey("updates conflicting rows", func() {
+			mg.AddMigration("merge tags", merge.OnConflict(ConflictsUpdate, "term"))
+			So(mg.Start(), ShouldBeNil)
+			So(tagUses(t, x), ShouldResemble, map[string]string{"prod": "2", "dev": "3"})
+			So(tableExists(t, x, "old_tag"), ShouldBeFalse)
+		})
+
+		Convey("keeps the source table when the row counts don't match", func() {
+			// loses a merged row, so the target ends up with fewer rows than expected
+			execTestSql(x, "CREATE TRIGGER lose_dev AFTER INSERT ON dashboard_tag WHEN NEW.term = 'dev' BEGIN DELETE FROM dashboard_tag WHERE id = NEW.id; END")
+
+			// without a transaction the source table would be gone for good
+			sess := x.NewSession()
+			defer sess.Close()
+			So(merge.OnConflict(ConflictsSkip, "term").Exec(sess, mg), ShouldNotBeNil)
+			So(tableExists(t, x, "old_tag"), ShouldBeTrue)
+		})
+	})
+}
@@ -1,7 +1,12 @@
 package migrator
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/go-xorm/xorm"
 )
 
 type MigrationBase struct {
@@ -17,10 +22,22 @@ func (m *MigrationBase) SetId(id string) {
 	m.id = id
 }
 
+func (m *MigrationBase) Before(dialect Dialect) string {
+	return ""
+}
+
+func (m *MigrationBase) After(dialect Dialect) string {
+	return ""
+}
+
 func (m *MigrationBase) GetCondition() MigrationCondition {
 	return m.Condition
 }
 
+func (m *MigrationBase) String() string {
+	return m.id
+}
+
 type RawSqlMigration struct {
 	MigrationBase
 
@@ -36,19 +53,22 @@ func NewRawSqlMigration(sql string) *RawSqlMigration {
 }
 
 func (m *RawSqlMigration) Sql(dialect Dialect) string {
-	if m.sql != nil {
-		if val := m.sql[dialect.DriverName()]; val != "" {
-			return val
-		}
-
-		if val := m.sql["default"]; val != "" {
-			return val
-		}
+	if val := dialectSql(m.sql).forDialect(dialect); val != "" {
+		return val
 	}
 
 	return dialect.NoOpSql()
 }
 
+func (m *RawSqlMigration) String() string {
+	dialects := make([]string, 0, len(m.sql))
+	for dialect := range m.sql {
+		dialects = append(dialects, dialect)
+	}
+	sort.Strings(dialects)
+	return fmt.Sprintf("RawSql (%s)", strings.Join(dialects, ", "))
+}
+
 func (m *RawSqlMigration) Set(dialect string, sql string) *RawSqlMigration {
 	if m.sql == nil {
 		m.sql = make(map[string]string)
@@ -78,10 +98,70 @@ func (m *RawSqlMigration) Mssql(sql string) *RawSqlMigration {
 	return m.Set(MSSQL, sql)
 }
 
+// joinStatements renders the statements of a multi statement migration as a
+// single script, for logging.
+func joinStatements(statements []string) string {
+	trimmed := make([]string, 0, len(statements))
+	for _, sql := range statements {
+		trimmed = append(trimmed, strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	}
+	return strings.Join(trimmed, ";\n")
+}
+
+// dialectSql holds sql by driver name, with a "default" fallback.
+type dialectSql map[string]string
+
+func (s dialectSql) forDialect(dialect Dialect) string {
+	if val := s[dialect.DriverName()]; val != "" {
+		return val
+	}
+	return s["default"]
+}
+
+// onlineDDLSql returns the online DDL clause for the change, or an empty
+// string if none was requested or the change doesn't support it.
+func onlineDDLSql(dialect Dialect, change string, col *Column, ddl *OnlineDDL) string {
+	if ddl == nil {
+		return ""
+	}
+	sql, err := dialect.OnlineDDLSql(change, col, ddl)
+	if err != nil {
+		return ""
+	}
+	return sql
+}
+
+// validateOnlineDDL warns about requested online DDL the change doesn't
+// support, the migration then falls back to the defaults of the engine.
+func validateOnlineDDL(mg *Migrator, m Migration, change string, col *Column, ddl *OnlineDDL) {
+	if ddl == nil {
+		return
+	}
+	if _, err := mg.Dialect.OnlineDDLSql(change, col, ddl); err != nil {
+		mg.Logger.Warn("Online DDL not supported, using default algorithm and lock", "id", m.Id(), "migration", m.String(), "error", err)
+	}
+}
+
+// warnLegacyIntegerColumns warns about columns declaring a display width or
+// ZEROFILL, which MySQL deprecated and the other dialects ignore.
+func warnLegacyIntegerColumns(mg *Migrator, m Migration, cols ...*Column) {
+	for _, col := range cols {
+		if col.DisplayWidth == 0 && !col.Zerofill {
+			continue
+		}
+		if mg.Dialect.DriverName() == MYSQL {
+			mg.Logger.Warn("Integer display width and ZEROFILL are deprecated since MySQL 8.0.17", "id", m.Id(), "column", col.Name)
+		} else {
+			mg.Logger.Warn("Integer display width and ZEROFILL are MySQL only, ignoring", "id", m.Id(), "column", col.Name)
+		}
+	}
+}
+
 type AddColumnMigration struct {
 	MigrationBase
 	tableName string
 	column    *Column
+	onlineDDL *OnlineDDL
 }
 
 func NewAddColumnMigration(table Table, col *Column) *AddColumnMigration {
@@ -100,18 +180,247 @@ func (m *AddColumnMigration) Column(col *Column) *AddColumnMigration {
 	return m
 }
 
+// Online requests MySQL online DDL, see OnlineDDL.
+func (m *AddColumnMigration) Online(algorithm string, lock string) *AddColumnMigration {
+	m.onlineDDL = &OnlineDDL{Algorithm: algorithm, Lock: lock}
+	return m
+}
+
 func (m *AddColumnMigration) Sql(dialect Dialect) string {
-	return dialect.AddColumnSql(m.tableName, m.column)
+	sql := dialect.AddColumnSql(m.tableName, m.column)
+	if clause := onlineDDLSql(dialect, DDLAddColumn, m.column, m.onlineDDL); clause != "" {
+		sql = strings.TrimSpace(sql) + clause
+	}
+	return sql
+}
+
+func (m *AddColumnMigration) Validate(mg *Migrator) error {
+	validateOnlineDDL(mg, m, DDLAddColumn, m.column, m.onlineDDL)
+	warnLegacyIntegerColumns(mg, m, m.column)
+	return nil
+}
+
+// Down drops the column again, SQLite rebuilds the table.
+func (m *AddColumnMigration) Down(sess *xorm.Session, mg *Migrator) error {
+	return mg.Dialect.DropColumn(sess, m.tableName, m.column.Name)
+}
+
+func (m *AddColumnMigration) String() string {
+	return fmt.Sprintf("AddColumn %s.%s %s", m.tableName, m.column.Name, m.column.Type)
+}
+
+// ModifyColumnMigration changes the type, nullability and default of a
+// column. Making a VARCHAR longer is cheap on MySQL and Postgres: MySQL
+// widens it in place, without copying the table, if the length prefix of the
+// values keeps its size, the migration then requests ALGORITHM=INPLACE and
+// LOCK=NONE unless Online asks otherwise. Postgres doesn't rewrite the table
+// for a longer VARCHAR.
+type ModifyColumnMigration struct {
+	MigrationBase
+	tableName      string
+	column         *Column
+	references     []columnReference
+	checkNarrowing bool
+	onlineDDL      *OnlineDDL
+}
+
+type columnReference struct {
+	tableName  string
+	column     *Column
+	foreignKey *ForeignKey
+}
+
+func NewModifyColumnMigration(table Table, col *Column) *ModifyColumnMigration {
+	return &ModifyColumnMigration{tableName: table.Name, column: col}
+}
+
+// Cascade declares a column referencing the modified column, usually a
+// primary key, that gets changed to the new type as well. If the reference is
+// enforced by a foreign key it is dropped before and recreated after the type
+// changes so the engine never sees a key with mismatched column types.
+func (m *ModifyColumnMigration) Cascade(tableName string, col *Column, fk *ForeignKey) *ModifyColumnMigration {
+	m.references = append(m.references, columnReference{tableName: tableName, column: col, foreignKey: fk})
+	return m
+}
+
+// CheckNarrowing makes the migration fail before changing anything if there
+// are values that don't fit the new type, instead of MySQL silently truncating
+// them or Postgres failing with an opaque error.
+func (m *ModifyColumnMigration) CheckNarrowing() *ModifyColumnMigration {
+	m.checkNarrowing = true
+	return m
+}
+
+// Online requests MySQL online DDL for the modified and cascaded columns, see
+// OnlineDDL.
+func (m *ModifyColumnMigration) Online(algorithm string, lock string) *ModifyColumnMigration {
+	m.onlineDDL = &OnlineDDL{Algorithm: algorithm, Lock: lock}
+	return m
+}
+
+func (m *ModifyColumnMigration) Validate(mg *Migrator) error {
+	validateOnlineDDL(mg, m, DDLModifyColumn, m.column, m.onlineDDL)
+	warnLegacyIntegerColumns(mg, m, m.column)
+	return nil
+}
+
+func (m *ModifyColumnMigration) Sql(dialect Dialect) string {
+	statements := dialect.ModifyColumnSql(m.tableName, m.column)
+	if len(m.references) > 0 || len(statements) == 0 {
+		return CodeMigrationSql
+	}
+	return joinStatements(statements)
+}
+
+func (m *ModifyColumnMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	if m.checkNarrowing {
+		if err := checkNarrowing(sess, mg.Dialect, m.tableName, m.column); err != nil {
+			return err
+		}
+		for _, ref := range m.references {
+			if err := checkNarrowing(sess, mg.Dialect, ref.tableName, ref.column); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, ref := range m.references {
+		if ref.foreignKey != nil {
+			if err := mg.Dialect.DropForeignKey(sess, ref.tableName, ref.foreignKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := m.modifyColumn(sess, mg.Dialect, m.tableName, m.column); err != nil {
+		return err
+	}
+
+	for _, ref := range m.references {
+		if err := m.modifyColumn(sess, mg.Dialect, ref.tableName, ref.column); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range m.references {
+		if ref.foreignKey != nil {
+			if err := mg.Dialect.AddForeignKey(sess, ref.tableName, ref.foreignKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *ModifyColumnMigration) modifyColumn(sess *xorm.Session, dialect Dialect, tableName string, col *Column) error {
+	change, err := dialect.ModifyColumnChange(sess, tableName, col)
+	if err != nil {
+		return err
+	}
+	ddl := m.onlineDDL
+	if ddl == nil && change == DDLWidenVarchar {
+		ddl = &OnlineDDL{Algorithm: AlgorithmInplace, Lock: LockNone}
+	}
+
+	clause := onlineDDLSql(dialect, change, col, ddl)
+	if clause == "" {
+		return dialect.ModifyColumn(sess, tableName, col)
+	}
+
+	for _, sql := range dialect.ModifyColumnSql(tableName, col) {
+		if _, err := sess.Exec(strings.TrimSpace(sql) + clause); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const narrowingExamples = 5
+
+func checkNarrowing(sess *xorm.Session, dialect Dialect, tableName string, col *Column) error {
+	condition := dialect.OutOfRangeExpr(col)
+	if condition == "" {
+		return nil
+	}
+
+	quote := dialect.Quote
+	count, err := countRows(sess, dialect.CountSql(tableName, condition))
+	if err != nil || count == 0 {
+		return err
+	}
+
+	examples, err := sess.SQL(fmt.Sprintf("SELECT %s AS value FROM %s WHERE %s%s", quote(col.Name), quote(tableName), condition, dialect.Limit(narrowingExamples))).Query()
+	if err != nil {
+		return err
+	}
+	values := make([]string, 0, len(examples))
+	for _, row := range examples {
+		values = append(values, string(row["value"]))
+	}
+
+	return fmt.Errorf("changing %s.%s to %s would lose data in %d rows, e.g. %s", tableName, col.Name, col.Type, count, strings.Join(values, ", "))
+}
+
+func (m *ModifyColumnMigration) String() string {
+	if len(m.references) > 0 {
+		return fmt.Sprintf("ModifyColumn %s.%s %s (cascades to %d columns)", m.tableName, m.column.Name, m.column.Type, len(m.references))
+	}
+	return fmt.Sprintf("ModifyColumn %s.%s %s", m.tableName, m.column.Name, m.column.Type)
+}
+
+// ReorderColumnsMigration moves the columns to the front of the table in the
+// given order, the other columns follow in their current order. Most tools
+// don't care about the column order, only use it where one does, e.g. to get
+// back a canonical order after adding columns over the years. It is a full
+// rebuild of the table: MySQL copies the table and SQLite recreates it and
+// copies the rows, which takes long and needs space for a second copy on
+// large tables. Postgres can't reorder columns, there the migration does
+// nothing and a warning is logged.
+type ReorderColumnsMigration struct {
+	MigrationBase
+	tableName string
+	columns   []string
+}
+
+func NewReorderColumnsMigration(tableName string, columns ...string) *ReorderColumnsMigration {
+	return &ReorderColumnsMigration{tableName: tableName, columns: columns}
+}
+
+func (m *ReorderColumnsMigration) Validate(mg *Migrator) error {
+	if len(m.columns) == 0 {
+		return fmt.Errorf("reordering the columns of %s needs the columns to move", m.tableName)
+	}
+	return nil
+}
+
+func (m *ReorderColumnsMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *ReorderColumnsMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	err := mg.Dialect.ReorderColumns(sess, m.tableName, m.columns)
+	if _, ok := err.(*NotSupportedError); ok {
+		mg.Logger.Warn("Reordering columns not supported, skipping", "id", m.Id(), "migration", m.String(), "error", err)
+		return nil
+	}
+	return err
+}
+
+func (m *ReorderColumnsMigration) String() string {
+	return fmt.Sprintf("ReorderColumns %s (%s)", m.tableName, strings.Join(m.columns, ", "))
 }
 
 type AddIndexMigration struct {
 	MigrationBase
 	tableName string
 	index     *Index
+	columns   []*Column
+	onlineDDL *OnlineDDL
 }
 
 func NewAddIndexMigration(table Table, index *Index) *AddIndexMigration {
-	m := &AddIndexMigration{tableName: table.Name, index: index}
+	m := &AddIndexMigration{tableName: table.Name, index: index, columns: table.Columns}
 	m.Condition = &IfIndexNotExistsCondition{TableName: table.Name, IndexName: index.XName(table.Name)}
 	return m
 }
@@ -121,14 +430,102 @@ func (m *AddIndexMigration) Table(tableName string) *AddIndexMigration {
 	return m
 }
 
+// StorageParam sets a storage parameter such as fillfactor for the index.
+// Only Postgres uses storage parameters, other dialects ignore them. Names are
+// passed through as is, so an unknown parameter fails when the index is created.
+func (m *AddIndexMigration) StorageParam(key string, value string) *AddIndexMigration {
+	if m.index.StorageParams == nil {
+		m.index.StorageParams = make(map[string]string)
+	}
+	m.index.StorageParams[key] = value
+	return m
+}
+
+// NullsNotDistinct makes the unique index treat NULLs as equal, see
+// Index.NullsNotDistinct.
+func (m *AddIndexMigration) NullsNotDistinct() *AddIndexMigration {
+	m.index.NullsNotDistinct = true
+	return m
+}
+
+// MinRows creates the index only once the table has more than minRows rows,
+// small tables don't benefit from it. Until then the migration is not
+// recorded in the migration log and is checked again on every run, so an
+// install starting out with an empty table gets the index on the first run
+// after the table has grown. See DeferringCondition.
+func (m *AddIndexMigration) MinRows(minRows int64) *AddIndexMigration {
+	m.Condition = &indexRowCountCondition{
+		index: IfIndexNotExistsCondition{TableName: m.tableName, IndexName: m.index.XName(m.tableName)},
+		rows:  RowCountCondition{TableName: m.tableName, MinRows: minRows},
+	}
+	return m
+}
+
+// Online requests MySQL online DDL, see OnlineDDL.
+func (m *AddIndexMigration) Online(algorithm string, lock string) *AddIndexMigration {
+	m.onlineDDL = &OnlineDDL{Algorithm: algorithm, Lock: lock}
+	return m
+}
+
 func (m *AddIndexMigration) Sql(dialect Dialect) string {
-	return dialect.CreateIndexSql(m.tableName, m.index)
+	sql := dialect.CreateIndexSql(m.tableName, m.index)
+	if clause := onlineDDLSql(dialect, DDLAddIndex, nil, m.onlineDDL); clause != "" {
+		sql = strings.TrimSuffix(sql, ";") + clause
+	}
+	return sql
+}
+
+func (m *AddIndexMigration) Validate(mg *Migrator) error {
+	validateOnlineDDL(mg, m, DDLAddIndex, nil, m.onlineDDL)
+
+	if m.index.NullsNotDistinct {
+		if m.index.Type != UniqueIndex {
+			return fmt.Errorf("index %s is not unique, nulls not distinct only applies to unique indexes", m.index.XName(m.tableName))
+		}
+		if _, err := mg.Dialect.NullsNotDistinctStr(); err != nil {
+			return err
+		}
+	}
+
+	if max := mg.Dialect.MaxIndexColumns(); len(m.index.Cols) > max {
+		return fmt.Errorf("index %s has %d columns, %s supports at most %d", m.index.XName(m.tableName), len(m.index.Cols), mg.Dialect.DriverName(), max)
+	}
+
+	// the key length can only be estimated when the table columns are known
+	maxLength := mg.Dialect.MaxIndexKeyLength()
+	if maxLength == 0 {
+		return nil
+	}
+
+	length := 0
+	for _, name := range m.index.Cols {
+		for _, col := range m.columns {
+			if col.Name == name {
+				length += mg.Dialect.IndexKeyLength(col)
+			}
+		}
+	}
+	if length > maxLength {
+		mg.Logger.Warn("Index key is likely to exceed the maximum key length", "id", m.Id(), "index", m.index.XName(m.tableName), "bytes", length, "max", maxLength)
+	}
+
+	return nil
+}
+
+func (m *AddIndexMigration) Down(sess *xorm.Session, mg *Migrator) error {
+	_, err := sess.Exec(mg.Dialect.DropIndexSql(m.tableName, m.index))
+	return err
+}
+
+func (m *AddIndexMigration) String() string {
+	return fmt.Sprintf("AddIndex %s ON %s (%s)", m.index.XName(m.tableName), m.tableName, strings.Join(m.index.Cols, ", "))
 }
 
 type DropIndexMigration struct {
 	MigrationBase
 	tableName string
 	index     *Index
+	onlineDDL *OnlineDDL
 }
 
 func NewDropIndexMigration(table Table, index *Index) *DropIndexMigration {
@@ -141,7 +538,221 @@ func (m *DropIndexMigration) Sql(dialect Dialect) string {
 	if m.index.Name == "" {
 		m.index.Name = strings.Join(m.index.Cols, "_")
 	}
-	return dialect.DropIndexSql(m.tableName, m.index)
+	return dialect.DropIndexSql(m.tableName, m.index) + onlineDDLSql(dialect, DDLDropIndex, nil, m.onlineDDL)
+}
+
+// Online requests MySQL online DDL, see OnlineDDL.
+func (m *DropIndexMigration) Online(algorithm string, lock string) *DropIndexMigration {
+	m.onlineDDL = &OnlineDDL{Algorithm: algorithm, Lock: lock}
+	return m
+}
+
+func (m *DropIndexMigration) Validate(mg *Migrator) error {
+	validateOnlineDDL(mg, m, DDLDropIndex, nil, m.onlineDDL)
+	return nil
+}
+
+func (m *DropIndexMigration) String() string {
+	return fmt.Sprintf("DropIndex %s ON %s", m.index.XName(m.tableName), m.tableName)
+}
+
+// optionalFeatureMigration is implemented by migrations of a feature only some
+// dialects have. The others execute NoOpSql instead, with a warning.
+type optionalFeatureMigration interface {
+	Migration
+	featureSql(dialect Dialect) (string, error)
+}
+
+func optionalFeatureSql(m optionalFeatureMigration, dialect Dialect) string {
+	sql, err := m.featureSql(dialect)
+	if err != nil {
+		return dialect.NoOpSql()
+	}
+	return sql
+}
+
+// SetIndexVisibilityMigration makes an index invisible to the MySQL optimizer,
+// or visible again with Visible(true), to try out dropping an index without
+// losing it. Other dialects have no invisible indexes, there the migration
+// does nothing and a warning is logged.
+type SetIndexVisibilityMigration struct {
+	MigrationBase
+	tableName string
+	index     *Index
+	visible   bool
+}
+
+func NewSetIndexVisibilityMigration(table Table, index *Index) *SetIndexVisibilityMigration {
+	m := &SetIndexVisibilityMigration{tableName: table.Name, index: index}
+	m.Condition = &IfIndexExistsCondition{TableName: table.Name, IndexName: index.XName(table.Name)}
+	return m
+}
+
+func (m *SetIndexVisibilityMigration) Visible(visible bool) *SetIndexVisibilityMigration {
+	m.visible = visible
+	return m
+}
+
+func (m *SetIndexVisibilityMigration) featureSql(dialect Dialect) (string, error) {
+	return dialect.IndexVisibilitySql(m.tableName, m.index, m.visible)
+}
+
+func (m *SetIndexVisibilityMigration) Sql(dialect Dialect) string {
+	return optionalFeatureSql(m, dialect)
+}
+
+func (m *SetIndexVisibilityMigration) String() string {
+	visibility := "invisible"
+	if m.visible {
+		visibility = "visible"
+	}
+	return fmt.Sprintf("SetIndexVisibility %s ON %s %s", m.index.XName(m.tableName), m.tableName, visibility)
+}
+
+// ChangeIndexUniquenessMigration recreates an index as unique, or as a plain
+// index with Unique(false). The index is the existing one, engines can't
+// change uniqueness in place so the new index is created before the old one
+// is dropped. Going unique first counts the duplicate keys and fails with the
+// count, so the migration doesn't fail halfway through creating the index.
+type ChangeIndexUniquenessMigration struct {
+	MigrationBase
+	tableName string
+	index     *Index
+	unique    bool
+}
+
+func NewChangeIndexUniquenessMigration(table Table, index *Index) *ChangeIndexUniquenessMigration {
+	m := &ChangeIndexUniquenessMigration{tableName: table.Name, index: index, unique: true}
+	m.Condition = &IfIndexExistsCondition{TableName: table.Name, IndexName: index.XName(table.Name)}
+	return m
+}
+
+func (m *ChangeIndexUniquenessMigration) Unique(unique bool) *ChangeIndexUniquenessMigration {
+	m.unique = unique
+	return m
+}
+
+// target returns the index to create, unprefixed names get the prefix of the
+// new index type.
+func (m *ChangeIndexUniquenessMigration) target() *Index {
+	target := *m.index
+	target.Type = IndexType
+	if m.unique {
+		target.Type = UniqueIndex
+	}
+	return &target
+}
+
+func (m *ChangeIndexUniquenessMigration) Validate(mg *Migrator) error {
+	if m.index.NullsNotDistinct {
+		if !m.unique {
+			return fmt.Errorf("index %s is not unique, nulls not distinct only applies to unique indexes", m.target().XName(m.tableName))
+		}
+		if _, err := mg.Dialect.NullsNotDistinctStr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ChangeIndexUniquenessMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *ChangeIndexUniquenessMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	target := m.target()
+
+	if m.unique {
+		duplicates, err := countRows(sess, dialect.DuplicateKeysSql(m.tableName, target))
+		if err != nil {
+			return err
+		}
+		if duplicates > 0 {
+			return fmt.Errorf("%d values of (%s) occur more than once in %s, index %s cannot be made unique", duplicates, strings.Join(target.Cols, ", "), m.tableName, m.index.XName(m.tableName))
+		}
+	}
+
+	drop := dialect.DropIndexSql(m.tableName, m.index)
+	create := dialect.CreateIndexSql(m.tableName, target)
+	statements := []string{create, drop}
+	// prefixed names don't change with the type of the index
+	if target.XName(m.tableName) == m.index.XName(m.tableName) {
+		statements = []string{drop, create}
+	}
+	for _, sql := range statements {
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ChangeIndexUniquenessMigration) String() string {
+	uniqueness := "unique"
+	if !m.unique {
+		uniqueness = "not unique"
+	}
+	return fmt.Sprintf("ChangeIndexUniqueness %s ON %s %s", m.index.XName(m.tableName), m.tableName, uniqueness)
+}
+
+// DeduplicateUniqueIndexMigration adds a unique index to a table that may
+// have duplicate keys, deleting all but the first row of each key by the
+// order of Keep, by the key column otherwise, in the same transaction. The
+// key column defaults to id, it is only used on MySQL where rows have no
+// row identifier. Deleting rows other tables reference fails the
+// migration, or cascades to them depending on the foreign key.
+type DeduplicateUniqueIndexMigration struct {
+	MigrationBase
+	tableName string
+	index     *Index
+	orderBy   string
+	keyColumn string
+}
+
+func NewDeduplicateUniqueIndexMigration(table Table, index *Index) *DeduplicateUniqueIndexMigration {
+	m := &DeduplicateUniqueIndexMigration{tableName: table.Name, index: index, keyColumn: "id"}
+	m.Condition = &IfIndexNotExistsCondition{TableName: table.Name, IndexName: index.XName(table.Name)}
+	return m
+}
+
+// Keep sets the ORDER BY clause choosing the row kept of each key, e.g.
+// "updated DESC" keeps the most recently updated row.
+func (m *DeduplicateUniqueIndexMigration) Keep(orderBy string) *DeduplicateUniqueIndexMigration {
+	m.orderBy = orderBy
+	return m
+}
+
+func (m *DeduplicateUniqueIndexMigration) KeyColumn(keyColumn string) *DeduplicateUniqueIndexMigration {
+	m.keyColumn = keyColumn
+	return m
+}
+
+func (m *DeduplicateUniqueIndexMigration) Validate(mg *Migrator) error {
+	if m.index.Type != UniqueIndex {
+		return fmt.Errorf("index %s is not unique, there are no duplicates to delete", m.index.XName(m.tableName))
+	}
+	if m.index.NullsNotDistinct {
+		if _, err := mg.Dialect.NullsNotDistinctStr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DeduplicateUniqueIndexMigration) SqlStatements(dialect Dialect) []string {
+	return []string{
+		dialect.DeleteDuplicatesSql(m.tableName, m.index, m.orderBy, m.keyColumn),
+		dialect.CreateIndexSql(m.tableName, m.index),
+	}
+}
+
+func (m *DeduplicateUniqueIndexMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.SqlStatements(dialect))
+}
+
+func (m *DeduplicateUniqueIndexMigration) String() string {
+	return fmt.Sprintf("DeduplicateUniqueIndex %s ON %s (%s)", m.index.XName(m.tableName), m.tableName, strings.Join(m.index.Cols, ", "))
 }
 
 type AddTableMigration struct {
@@ -158,10 +769,76 @@ func NewAddTableMigration(table Table) *AddTableMigration {
 	return &AddTableMigration{table: table}
 }
 
+// StorageParam sets a storage parameter such as fillfactor for the table.
+// Only Postgres uses storage parameters, other dialects ignore them. Names are
+// passed through as is, so an unknown parameter fails when the table is created.
+func (m *AddTableMigration) StorageParam(key string, value string) *AddTableMigration {
+	if m.table.StorageParams == nil {
+		m.table.StorageParams = make(map[string]string)
+	}
+	m.table.StorageParams[key] = value
+	return m
+}
+
+// PartitionBy creates a partitioned table, see Table.PartitionBy. The
+// partitions are added with AddPartitionMigration.
+func (m *AddTableMigration) PartitionBy(expr string) *AddTableMigration {
+	m.table.PartitionBy = expr
+	return m
+}
+
+func (m *AddTableMigration) Validate(mg *Migrator) error {
+	warnLegacyIntegerColumns(mg, m, m.table.Columns...)
+	if err := validateTableLimits(mg.Dialect, &m.table); err != nil {
+		return err
+	}
+	if m.table.PartitionBy == "" {
+		return nil
+	}
+	_, err := mg.Dialect.PartitionByStr(m.table.PartitionBy)
+	return err
+}
+
+// validateTableLimits checks the number of columns and the estimated row size
+// of a table against the limits of the dialect, which otherwise fail creating
+// the table with an error that doesn't tell which column to change.
+func validateTableLimits(dialect Dialect, table *Table) error {
+	if max := dialect.MaxColumns(); max > 0 && len(table.Columns) > max {
+		return fmt.Errorf("table %s has %d columns, %s supports at most %d", table.Name, len(table.Columns), dialect.DriverName(), max)
+	}
+
+	max := dialect.MaxRowSize()
+	if max == 0 {
+		return nil
+	}
+
+	size := 0
+	var widest *Column
+	for _, col := range table.Columns {
+		size += dialect.ColumnRowSize(col)
+		if widest == nil || dialect.ColumnRowSize(col) > dialect.ColumnRowSize(widest) {
+			widest = col
+		}
+	}
+	if size > max {
+		return fmt.Errorf("rows of table %s may take %d bytes, %s supports at most %d, switch wide columns such as %s to TEXT", table.Name, size, dialect.DriverName(), max, widest.Name)
+	}
+	return nil
+}
+
 func (m *AddTableMigration) Sql(d Dialect) string {
 	return d.CreateTableSql(&m.table)
 }
 
+func (m *AddTableMigration) Down(sess *xorm.Session, mg *Migrator) error {
+	_, err := sess.Exec(mg.Dialect.DropTable(m.table.Name))
+	return err
+}
+
+func (m *AddTableMigration) String() string {
+	return fmt.Sprintf("AddTable %s (%d columns)", m.table.Name, len(m.table.Columns))
+}
+
 type DropTableMigration struct {
 	MigrationBase
 	tableName string
@@ -175,6 +852,77 @@ func (m *DropTableMigration) Sql(d Dialect) string {
 	return d.DropTable(m.tableName)
 }
 
+func (m *DropTableMigration) String() string {
+	return fmt.Sprintf("DropTable %s", m.tableName)
+}
+
+// SetTableLoggedMigration makes a Postgres table UNLOGGED, or LOGGED again
+// with Logged(true), to speed up loading a lot of rows into it. Writes to an
+// unlogged table skip the write-ahead log, so after a crash the table is
+// truncated and it isn't replicated. Only use it for rows that can be
+// loaded again, and set the table back to LOGGED once the load is done. Other
+// dialects have no unlogged tables, there the migration does nothing and a
+// warning is logged.
+type SetTableLoggedMigration struct {
+	MigrationBase
+	tableName string
+	logged    bool
+}
+
+func NewSetTableLoggedMigration(tableName string) *SetTableLoggedMigration {
+	return &SetTableLoggedMigration{tableName: tableName}
+}
+
+func (m *SetTableLoggedMigration) Logged(logged bool) *SetTableLoggedMigration {
+	m.logged = logged
+	return m
+}
+
+func (m *SetTableLoggedMigration) featureSql(dialect Dialect) (string, error) {
+	return dialect.TableLoggedSql(m.tableName, m.logged)
+}
+
+func (m *SetTableLoggedMigration) Sql(dialect Dialect) string {
+	return optionalFeatureSql(m, dialect)
+}
+
+func (m *SetTableLoggedMigration) String() string {
+	logging := "unlogged"
+	if m.logged {
+		logging = "logged"
+	}
+	return fmt.Sprintf("SetTableLogged %s %s", m.tableName, logging)
+}
+
+// ClusterTableMigration rewrites a Postgres table with its rows in the order of
+// an index, so range scans over the index read fewer pages. The order is not
+// kept for rows written afterwards, so the table has to be clustered again
+// from time to time. CLUSTER locks the table against reads and writes while it
+// is rewritten and needs space for a second copy. On MySQL the rows are
+// always stored in primary key order, pick the primary key accordingly when
+// adding the table. Other dialects skip the migration with a warning.
+type ClusterTableMigration struct {
+	MigrationBase
+	tableName string
+	index     *Index
+}
+
+func NewClusterTableMigration(table Table, index *Index) *ClusterTableMigration {
+	return &ClusterTableMigration{tableName: table.Name, index: index}
+}
+
+func (m *ClusterTableMigration) featureSql(dialect Dialect) (string, error) {
+	return dialect.ClusterTableSql(m.tableName, m.index)
+}
+
+func (m *ClusterTableMigration) Sql(dialect Dialect) string {
+	return optionalFeatureSql(m, dialect)
+}
+
+func (m *ClusterTableMigration) String() string {
+	return fmt.Sprintf("ClusterTable %s USING %s", m.tableName, m.index.XName(m.tableName))
+}
+
 type RenameTableMigration struct {
 	MigrationBase
 	oldName string
@@ -195,6 +943,15 @@ func (m *RenameTableMigration) Sql(d Dialect) string {
 	return d.RenameTable(m.oldName, m.newName)
 }
 
+func (m *RenameTableMigration) Down(sess *xorm.Session, mg *Migrator) error {
+	_, err := sess.Exec(mg.Dialect.RenameTable(m.newName, m.oldName))
+	return err
+}
+
+func (m *RenameTableMigration) String() string {
+	return fmt.Sprintf("RenameTable %s -> %s", m.oldName, m.newName)
+}
+
 type CopyTableDataMigration struct {
 	MigrationBase
 	sourceTable string
@@ -202,6 +959,10 @@ type CopyTableDataMigration struct {
 	sourceCols  []string
 	targetCols  []string
 	//colMap      map[string]string
+	zeroDateTimes map[string]string
+	casts         map[string]*Column
+	expectedCount *int64
+	sourceFilter  *string
 }
 
 func NewCopyTableDataMigration(targetTable string, sourceTable string, colMap map[string]string) *CopyTableDataMigration {
@@ -213,8 +974,297 @@ func NewCopyTableDataMigration(targetTable string, sourceTable string, colMap ma
 	return m
 }
 
+// MapZeroDateTimes replaces MySQL zero dates ('0000-00-00 00:00:00') in the
+// given source columns with the replacement expression while copying, e.g.
+// NULL or a sentinel like '1970-01-01 00:00:00'.
+func (m *CopyTableDataMigration) MapZeroDateTimes(replacement string, sourceCols ...string) *CopyTableDataMigration {
+	if m.zeroDateTimes == nil {
+		m.zeroDateTimes = make(map[string]string)
+	}
+	for _, col := range sourceCols {
+		m.zeroDateTimes[col] = replacement
+	}
+	return m
+}
+
+// WithCasts converts the values copied into the given target columns to their
+// declared types with an explicit CAST, rather than relying on the implicit
+// conversions of the engine: Postgres rejects many of them while MySQL and
+// SQLite convert loosely.
+func (m *CopyTableDataMigration) WithCasts(targetCols ...*Column) *CopyTableDataMigration {
+	if m.casts == nil {
+		m.casts = make(map[string]*Column)
+	}
+	for _, col := range targetCols {
+		m.casts[col.Name] = col
+	}
+	return m
+}
+
+func (m *CopyTableDataMigration) Validate(mg *Migrator) error {
+	for name := range m.casts {
+		found := false
+		for _, col := range m.targetCols {
+			found = found || col == name
+		}
+		if !found {
+			return fmt.Errorf("cast column %s is not copied to %s", name, m.targetTable)
+		}
+	}
+	return nil
+}
+
+// ExpectCount fails the migration unless the target table has count rows
+// after copying.
+func (m *CopyTableDataMigration) ExpectCount(count int64) *CopyTableDataMigration {
+	m.expectedCount = &count
+	return m
+}
+
+// ExpectSourceCount fails the migration unless the target table has as many
+// rows after copying as there are rows in the source table matching where,
+// or rows in total if where is empty.
+func (m *CopyTableDataMigration) ExpectSourceCount(where string) *CopyTableDataMigration {
+	m.sourceFilter = &where
+	return m
+}
+
+func (m *CopyTableDataMigration) Verify(sess *xorm.Session, mg *Migrator) error {
+	if m.expectedCount == nil && m.sourceFilter == nil {
+		return nil
+	}
+
+	count, err := countRows(sess, mg.Dialect.CountSql(m.targetTable, ""))
+	if err != nil {
+		return err
+	}
+
+	if m.expectedCount != nil && count != *m.expectedCount {
+		return fmt.Errorf("expected %d rows in %s after copying, found %d", *m.expectedCount, m.targetTable, count)
+	}
+
+	if m.sourceFilter != nil {
+		sourceCount, err := countRows(sess, mg.Dialect.CountSql(m.sourceTable, *m.sourceFilter))
+		if err != nil {
+			return err
+		}
+		if count != sourceCount {
+			return fmt.Errorf("expected %d rows in %s after copying from %s, found %d", sourceCount, m.targetTable, m.sourceTable, count)
+		}
+	}
+
+	return nil
+}
+
+func countRows(sess *xorm.Session, sql string) (int64, error) {
+	results, err := sess.SQL(sql).Query()
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(results[0]["count"]), 10, 64)
+}
+
 func (m *CopyTableDataMigration) Sql(d Dialect) string {
-	return d.CopyTableData(m.sourceTable, m.targetTable, m.sourceCols, m.targetCols)
+	if len(m.zeroDateTimes) == 0 && len(m.casts) == 0 {
+		return d.CopyTableData(m.sourceTable, m.targetTable, m.sourceCols, m.targetCols)
+	}
+
+	sourceExprs := make([]string, 0, len(m.sourceCols))
+	for i, col := range m.sourceCols {
+		expr := d.Quote(col)
+		if replacement, ok := m.zeroDateTimes[col]; ok {
+			expr = d.ZeroDateTimeExpr(expr, replacement)
+		}
+		if target, ok := m.casts[m.targetCols[i]]; ok {
+			expr = d.CastExpr(expr, target)
+		}
+		sourceExprs = append(sourceExprs, expr)
+	}
+
+	return copyTableDataSql(d, m.sourceTable, m.targetTable, sourceExprs, m.targetCols)
+}
+
+// copyTableDataSql is CopyTableData for arbitrary select expressions.
+func copyTableDataSql(d Dialect, sourceTable string, targetTable string, sourceExprs []string, targetCols []string) string {
+	quotedTargetCols := make([]string, 0, len(targetCols))
+	for _, col := range targetCols {
+		quotedTargetCols = append(quotedTargetCols, d.Quote(col))
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", d.Quote(targetTable), strings.Join(quotedTargetCols, "\n, "), strings.Join(sourceExprs, "\n, "), d.Quote(sourceTable))
+}
+
+func (m *CopyTableDataMigration) String() string {
+	return fmt.Sprintf("CopyTableData %s -> %s (%d columns)", m.sourceTable, m.targetTable, len(m.targetCols))
+}
+
+// CreateTableAsMigration creates a table from the rows of a query with CREATE
+// TABLE ... AS SELECT, which is faster than creating the table and copying the
+// rows for large rebuilds. The columns and their types come from the query,
+// the query can be set per dialect. CREATE TABLE ... AS copies no
+// constraints, defaults or indexes: the primary key and indexes of the table
+// are added afterwards, SQLite rebuilds the table for the primary key, other
+// constraints have to be added by later migrations. MySQL servers enforcing
+// GTID consistency reject CREATE TABLE ... AS SELECT before MySQL 8.0.21.
+type CreateTableAsMigration struct {
+	MigrationBase
+	table Table
+	query map[string]string
+}
+
+func NewCreateTableAsMigration(table Table) *CreateTableAsMigration {
+	m := &CreateTableAsMigration{table: table, query: make(map[string]string)}
+	m.Condition = &IfTableNotExistsCondition{TableName: table.Name}
+	return m
+}
+
+func (m *CreateTableAsMigration) As(query string) *CreateTableAsMigration {
+	m.query["default"] = query
+	return m
+}
+
+func (m *CreateTableAsMigration) Sqlite(query string) *CreateTableAsMigration {
+	m.query[SQLITE] = query
+	return m
+}
+
+func (m *CreateTableAsMigration) Mysql(query string) *CreateTableAsMigration {
+	m.query[MYSQL] = query
+	return m
+}
+
+func (m *CreateTableAsMigration) Postgres(query string) *CreateTableAsMigration {
+	m.query[POSTGRES] = query
+	return m
+}
+
+func (m *CreateTableAsMigration) Validate(mg *Migrator) error {
+	if dialectSql(m.query).forDialect(mg.Dialect) == "" {
+		return fmt.Errorf("table %s has no query for %s", m.table.Name, mg.Dialect.DriverName())
+	}
+	return nil
+}
+
+func (m *CreateTableAsMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *CreateTableAsMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	query := dialectSql(m.query).forDialect(dialect)
+	if _, err := sess.Exec(fmt.Sprintf("CREATE TABLE %s AS %s", dialect.Quote(m.table.Name), query)); err != nil {
+		return err
+	}
+
+	if len(m.table.PrimaryKeys) > 0 {
+		if err := dialect.AddPrimaryKey(sess, m.table.Name, m.table.PrimaryKeys); err != nil {
+			return err
+		}
+	}
+	for _, index := range m.table.Indices {
+		if _, err := sess.Exec(dialect.CreateIndexSql(m.table.Name, index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *CreateTableAsMigration) String() string {
+	return fmt.Sprintf("CreateTableAs %s", m.table.Name)
+}
+
+// ReplaceTableMigration rebuilds a table without downtime: it creates the
+// new definition as <table>_new, copies the data, swaps the tables by renaming
+// <table> to <table>_bak and <table>_new to <table>, then drops the backup.
+// SQLite drops <table> instead of renaming it, see Sqlite3.SwapTableSql.
+// On Postgres and SQLite all of this happens in the migration's transaction,
+// MySQL commits each DDL statement but swaps the two tables atomically.
+// Tables other tables reference or views select from are rejected, see
+// Validate.
+type ReplaceTableMigration struct {
+	MigrationBase
+	table      Table
+	sourceCols []string
+	targetCols []string
+}
+
+func NewReplaceTableMigration(table Table, colMap map[string]string) *ReplaceTableMigration {
+	m := &ReplaceTableMigration{table: table}
+	for key, value := range colMap {
+		m.targetCols = append(m.targetCols, key)
+		m.sourceCols = append(m.sourceCols, value)
+	}
+	return m
+}
+
+// Validate rejects tables that other tables reference or views select from.
+// On Postgres and MySQL these would follow the table to <table>_bak, whose
+// drop then fails, and MySQL has committed the swap by then.
+func (m *ReplaceTableMigration) Validate(mg *Migrator) error {
+	return mg.inTransaction(func(sess *xorm.Session) error {
+		dependents, err := mg.Dialect.TableDependents(sess, m.table.Name)
+		if err != nil {
+			return err
+		}
+		if len(dependents) > 0 {
+			return fmt.Errorf("unable to replace table %s, %s depend on it", m.table.Name, strings.Join(dependents, ", "))
+		}
+		return nil
+	})
+}
+
+func (m *ReplaceTableMigration) SqlStatements(d Dialect) []string {
+	tableName := m.table.Name
+	newTable := NewAddTableMigration(m.table).table
+	newTable.Name = tableName + "_new"
+	backupName := tableName + "_bak"
+
+	// index names are kept, so they can only be created before the swap where
+	// they don't collide with the indexes of the table being replaced
+	indexSql := []string{}
+	indexTable := tableName
+	if d.TableScopedIndexNames() {
+		indexTable = newTable.Name
+	}
+	for _, index := range m.table.Indices {
+		renamed := *index
+		renamed.Name = index.XName(tableName)
+		indexSql = append(indexSql, d.CreateIndexSql(indexTable, &renamed))
+	}
+
+	statements := []string{
+		d.DropTable(newTable.Name),
+		d.CreateTableSql(&newTable),
+	}
+	if d.TableScopedIndexNames() {
+		statements = append(statements, indexSql...)
+	}
+	statements = append(statements, d.CopyTableData(tableName, newTable.Name, m.sourceCols, m.targetCols))
+	for _, col := range m.table.Columns {
+		if col.IsAutoIncrement {
+			if sql := d.SyncAutoIncrementSql(newTable.Name, col); sql != "" {
+				statements = append(statements, sql)
+			}
+		}
+	}
+	statements = append(statements, d.SwapTableSql(tableName, newTable.Name, backupName)...)
+	statements = append(statements, d.DropTable(backupName))
+	if !d.TableScopedIndexNames() {
+		statements = append(statements, indexSql...)
+	}
+
+	return statements
+}
+
+func (m *ReplaceTableMigration) Sql(d Dialect) string {
+	return joinStatements(m.SqlStatements(d))
+}
+
+func (m *ReplaceTableMigration) String() string {
+	return fmt.Sprintf("ReplaceTable %s (%d columns)", m.table.Name, len(m.table.Columns))
 }
 
 type TableCharsetMigration struct {
@@ -230,3 +1280,7 @@ func NewTableCharsetMigration(tableName string, columns []*Column) *TableCharset
 func (m *TableCharsetMigration) Sql(d Dialect) string {
 	return d.UpdateTableSql(m.tableName, m.columns)
 }
+
+func (m *TableCharsetMigration) String() string {
+	return fmt.Sprintf("TableCharset %s (%d columns)", m.tableName, len(m.columns))
+}
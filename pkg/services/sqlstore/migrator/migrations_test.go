@@ -0,0 +1,260 @@
+package migrator
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReversibleMigrations(t *testing.T) {
+	Convey("Undoing reversible migrations", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+			"INSERT INTO dashboard (title) VALUES ('a')",
+		)
+		mg := NewMigrator(x)
+
+		// applied only succeeds once the migration is applied
+		upAndDown := func(migration ReversibleMigration, applied string) {
+			sess := x.NewSession()
+			defer sess.Close()
+
+			So(mg.execMigration(migration, mg.statements(migration), sess), ShouldBeNil)
+			_, err := sess.QueryString(applied)
+			So(err, ShouldBeNil)
+
+			So(migration.Down(sess, mg), ShouldBeNil)
+			_, err = sess.QueryString(applied)
+			So(err, ShouldNotBeNil)
+		}
+
+		shouldBeUnchanged := func() {
+			results, err := x.QueryString("SELECT * FROM dashboard")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"id": "1", "title": "a"}})
+		}
+
+		Convey("add column", func() {
+			upAndDown(NewAddColumnMigration(Table{Name: "dashboard"}, &Column{Name: "uid", Type: DB_NVarchar, Length: 40, Nullable: true}), "SELECT uid FROM dashboard")
+			shouldBeUnchanged()
+		})
+
+		Convey("rename table", func() {
+			upAndDown(NewRenameTableMigration("dashboard", "dashboard_v1"), "SELECT id FROM dashboard_v1")
+			shouldBeUnchanged()
+		})
+	})
+}
+
+func TestReplaceTableMigration(t *testing.T) {
+	Convey("Replacing a table", t, func() {
+		table := Table{
+			Name: "dashboard",
+			Columns: []*Column{
+				{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+				{Name: "title", Type: DB_NVarchar, Length: 255, Nullable: false},
+			},
+			Indices: []*Index{
+				{Cols: []string{"title"}, Type: UniqueIndex, NullsNotDistinct: true, StorageParams: map[string]string{"fillfactor": "70"}},
+			},
+		}
+		replace := NewReplaceTableMigration(table, map[string]string{"id": "id", "title": "title"})
+
+		Convey("keeps the options of its indexes", func() {
+			dialect := NewPostgresDialect(nil)
+			dialect.serverVersion = 150000
+			sql := replace.Sql(dialect)
+			So(sql, ShouldContainSubstring, `CREATE UNIQUE INDEX "UQE_dashboard_title" ON "dashboard" ("title") NULLS NOT DISTINCT WITH (fillfactor=70)`)
+		})
+
+		Convey("on SQLite", func() {
+			x, mg := newSqliteTestMigrator(t)
+			execTestSql(x,
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT)",
+				"CREATE TABLE dashboard_tag (id INTEGER PRIMARY KEY, dashboard_id INTEGER REFERENCES dashboard (id) ON DELETE CASCADE)",
+				"CREATE VIEW dashboard_title AS SELECT title FROM dashboard",
+				"INSERT INTO dashboard (title) VALUES ('a')",
+				"INSERT INTO dashboard_tag (dashboard_id) VALUES (1)",
+			)
+			mg.AddMigration("replace dashboard", replace)
+
+			Convey("rejects tables referenced while foreign keys are enforced", func() {
+				execTestSql(x, "PRAGMA foreign_keys = ON")
+				err := mg.Start()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "dashboard_tag depend on it")
+			})
+
+			Convey("keeps views and unenforced foreign keys working", func() {
+				So(replace.Sql(mg.Dialect), ShouldContainSubstring, "PRAGMA legacy_alter_table = ON;\nALTER TABLE `dashboard_new` RENAME TO `dashboard`")
+				So(mg.Start(), ShouldBeNil)
+
+				results, err := x.QueryString("SELECT title FROM dashboard_title")
+				So(err, ShouldBeNil)
+				So(results, ShouldResemble, []map[string]string{{"title": "a"}})
+
+				count, err := x.Table("dashboard_tag").Count()
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestModifyColumnCascade(t *testing.T) {
+	Convey("Modifying a column other columns reference", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE org (id INTEGER PRIMARY KEY, name TEXT)",
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, org_id INTEGER NOT NULL, CONSTRAINT FK_dashboard_org_id FOREIGN KEY (org_id) REFERENCES org (id))",
+			"INSERT INTO org (id, name) VALUES (1, 'main')",
+			"INSERT INTO dashboard (org_id) VALUES (1), (1)",
+		)
+		fk := &ForeignKey{Cols: []string{"org_id"}, RefTable: "org", RefCols: []string{"id"}}
+		modify := NewModifyColumnMigration(Table{Name: "org"}, &Column{Name: "id", Type: DB_BigInt, IsPrimaryKey: true}).
+			Cascade("dashboard", &Column{Name: "org_id", Type: DB_BigInt, Nullable: false}, fk)
+
+		Convey("changes the referencing column and recreates its foreign key", func() {
+			mg.AddMigration("org id to bigint", modify)
+			So(mg.Start(), ShouldBeNil)
+
+			sess := x.NewSession()
+			defer sess.Close()
+			// SQLite declares both as INTEGER, the rebuilt tables quote the names
+			for tableName, def := range map[string]string{"org": "`id` INTEGER PRIMARY KEY", "dashboard": "`org_id` INTEGER NOT NULL"} {
+				tableDef, err := sqliteLoadTableDef(sess, tableName)
+				So(err, ShouldBeNil)
+				So(strings.Join(tableDef.Defs, ", "), ShouldContainSubstring, def)
+			}
+
+			constraints, err := mg.Dialect.ListConstraints(sess, "dashboard")
+			So(err, ShouldBeNil)
+			foreignKeys := []string{}
+			for _, c := range constraints {
+				if c.Type == "FOREIGN KEY" {
+					foreignKeys = append(foreignKeys, c.Name+" "+c.RefTable)
+				}
+			}
+			So(foreignKeys, ShouldResemble, []string{"FK_dashboard_org_id org"})
+
+			count, err := x.Table("dashboard").Where("org_id = 1").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("describes the cascade", func() {
+			So(modify.String(), ShouldEqual, "ModifyColumn org.id BIGINT (cascades to 1 columns)")
+			So(modify.Sql(mg.Dialect), ShouldEqual, CodeMigrationSql)
+		})
+	})
+}
+
+func TestSetIndexVisibilityMigration(t *testing.T) {
+	Convey("Setting the visibility of an index", t, func() {
+		table := Table{Name: "dashboard"}
+		index := &Index{Cols: []string{"title"}}
+		invisible := NewSetIndexVisibilityMigration(table, index)
+
+		Convey("alters the index on MySQL", func() {
+			So(invisible.Sql(NewMysqlDialect(nil)), ShouldEqual, "ALTER TABLE `dashboard` ALTER INDEX `IDX_dashboard_title` INVISIBLE")
+		})
+
+		Convey("does nothing on SQLite", func() {
+			x, mg := newSqliteTestMigrator(t)
+			execTestSql(x,
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+				"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+			)
+			So(invisible.Sql(mg.Dialect), ShouldEqual, mg.Dialect.NoOpSql())
+
+			mg.AddMigration("hide title index", invisible)
+			So(mg.Start(), ShouldBeNil)
+			So(migrationLogRows(x, "hide title index"), ShouldResemble, []map[string]string{{"success": "1", "error": ""}})
+		})
+	})
+}
+
+func TestSetTableLoggedMigration(t *testing.T) {
+	Convey("Setting a table unlogged", t, func() {
+		unlogged := NewSetTableLoggedMigration("dashboard")
+
+		Convey("alters the table on Postgres", func() {
+			So(unlogged.Sql(NewPostgresDialect(nil)), ShouldEqual, `ALTER TABLE "dashboard" SET UNLOGGED`)
+			So(unlogged.Logged(true).Sql(NewPostgresDialect(nil)), ShouldEqual, `ALTER TABLE "dashboard" SET LOGGED`)
+		})
+
+		Convey("does nothing on SQLite", func() {
+			x, mg := newSqliteTestMigrator(t)
+			execTestSql(x, "CREATE TABLE dashboard (id INTEGER PRIMARY KEY)")
+			So(unlogged.Sql(mg.Dialect), ShouldEqual, mg.Dialect.NoOpSql())
+
+			mg.AddMigration("unlog dashboard", unlogged)
+			So(mg.Start(), ShouldBeNil)
+			So(migrationLogRows(x, "unlog dashboard"), ShouldResemble, []map[string]string{{"success": "1", "error": ""}})
+		})
+	})
+}
+
+func TestClusterTableMigration(t *testing.T) {
+	Convey("Clustering a table", t, func() {
+		cluster := NewClusterTableMigration(Table{Name: "dashboard"}, &Index{Cols: []string{"org_id"}})
+
+		Convey("clusters it on the index on Postgres", func() {
+			So(cluster.Sql(NewPostgresDialect(nil)), ShouldEqual, `CLUSTER "dashboard" USING "IDX_dashboard_org_id"`)
+		})
+
+		Convey("does nothing on SQLite", func() {
+			x, mg := newSqliteTestMigrator(t)
+			execTestSql(x, "CREATE TABLE dashboard (id INTEGER PRIMARY KEY, org_id INTEGER)")
+			So(cluster.Sql(mg.Dialect), ShouldEqual, mg.Dialect.NoOpSql())
+
+			mg.AddMigration("cluster dashboard", cluster)
+			So(mg.Start(), ShouldBeNil)
+			So(migrationLogRows(x, "cluster dashboard"), ShouldResemble, []map[string]string{{"success": "1", "error": ""}})
+		})
+	})
+}
+
+func TestDeduplicateUniqueIndexMigration(t *testing.T) {
+	Convey("Adding a unique index to a table with duplicates", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, org_id INTEGER, uid TEXT, updated INTEGER)",
+			"INSERT INTO dashboard (id, org_id, uid, updated) VALUES (1, 1, 'a', 3), (2, 1, 'a', 5), (3, 2, 'a', 1), (4, 1, 'b', 1), (5, 1, NULL, 1), (6, 1, NULL, 2)",
+		)
+		table := Table{Name: "dashboard"}
+		index := &Index{Cols: []string{"org_id", "uid"}, Type: UniqueIndex}
+		ids := func() []map[string]string {
+			return queryRows(x, "SELECT id FROM dashboard ORDER BY id")
+		}
+
+		Convey("keeps the first row of each key and creates the index", func() {
+			mg.AddMigration("add uid index", NewDeduplicateUniqueIndexMigration(table, index))
+			So(mg.Start(), ShouldBeNil)
+			// NULLs are distinct, so rows with a NULL uid are no duplicates
+			So(ids(), ShouldResemble, []map[string]string{{"id": "1"}, {"id": "3"}, {"id": "4"}, {"id": "5"}, {"id": "6"}})
+
+			_, err := x.Exec("INSERT INTO dashboard (id, org_id, uid) VALUES (7, 1, 'a')")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("keeps the row Keep orders first", func() {
+			mg.AddMigration("add uid index", NewDeduplicateUniqueIndexMigration(table, index).Keep("updated DESC"))
+			So(mg.Start(), ShouldBeNil)
+			So(ids(), ShouldResemble, []map[string]string{{"id": "2"}, {"id": "3"}, {"id": "4"}, {"id": "5"}, {"id": "6"}})
+		})
+
+		Convey("is skipped when the index exists", func() {
+			execTestSql(x, "CREATE INDEX UQE_dashboard_org_id_uid ON dashboard (org_id, uid)")
+			mg.AddMigration("add uid index", NewDeduplicateUniqueIndexMigration(table, index))
+			So(mg.Start(), ShouldBeNil)
+			So(ids(), ShouldHaveLength, 6)
+		})
+
+		Convey("refuses indexes that aren't unique", func() {
+			So(NewDeduplicateUniqueIndexMigration(table, &Index{Cols: []string{"uid"}}).Validate(mg), ShouldNotBeNil)
+		})
+	})
+}
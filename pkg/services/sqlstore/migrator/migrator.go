@@ -1,6 +1,10 @@
 package migrator
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -15,8 +19,68 @@ type Migrator struct {
 	Dialect    Dialect
 	migrations []Migration
 	Logger     log.Logger
+
+	// IsolationLevel is the transaction isolation level migrations are run
+	// with, one of the Isolation* constants. Empty uses the engine default.
+	// MySQL honors all levels, Postgres runs READ UNCOMMITTED as READ
+	// COMMITTED and SQLite always runs serializable transactions. MySQL runs
+	// the migrations on a connection of their own to set the level on it.
+	IsolationLevel string
+
+	// Schema is the schema migrations are run in, each schema has its own
+	// migration log. Empty uses the default schema of the connection. Only
+	// Postgres supports running in another schema.
+	Schema string
+
+	// SqlRewriter, if set, is called with every statement of SQL migrations
+	// before it is executed, e.g. to add engine hints. The rewritten
+	// statements are what gets recorded in the migration log. Code migrations
+	// execute their statements themselves and are not rewritten.
+	SqlRewriter SqlRewriter
+
+	// ExplainDataMigrations logs the query plan of every statement of SQL
+	// migrations reading or writing rows, such as table copies, before it is
+	// executed. It is meant for finding out why a data migration is slow and
+	// is off by default. Plans are estimates, EXPLAIN ANALYZE is not used
+	// since it would execute the statement twice.
+	ExplainDataMigrations bool
+
+	// Metrics, if set, is told how long migrations took, see
+	// MigrationMetrics.
+	Metrics MigrationMetrics
+
+	// SkipRecorder, if set, is called with the reason of every migration
+	// skipped by its condition, see ExplainingCondition, e.g. to record it in
+	// a table next to the migration log. It runs in the transaction of the
+	// migration, failing fails the migration. Dry runs don't call it.
+	SkipRecorder SkipRecorder
+
+	// sessionIsolationSql is executed before every transaction of a migrator
+	// running on an isolated engine, see onIsolatedEngine.
+	sessionIsolationSql string
+}
+
+type SqlRewriter func(migrationId string, sql string) string
+
+type SkipRecorder func(sess *xorm.Session, migrationId string, reason string) error
+
+// MigrationMetrics receives the durations of migration runs, e.g. to record
+// them in histograms. The package doesn't depend on a metrics library, the
+// host implements the interface with its own.
+type MigrationMetrics interface {
+	// MigrationExecuted is called for every pending migration once its
+	// transaction has committed or rolled back. Migrations skipped by their
+	// condition count as successful, deferred migrations are not reported.
+	MigrationExecuted(migrationId string, duration time.Duration, success bool)
+	// MigrationsCompleted is called when Start returns, with the time it took
+	// to run all pending migrations.
+	MigrationsCompleted(duration time.Duration, success bool)
 }
 
+// errMigrationDeferred is returned by exec when a deferring condition leaves
+// the migration pending, it is not recorded in the migration log.
+var errMigrationDeferred = errors.New("migration deferred")
+
 type MigrationLog struct {
 	Id          int64
 	MigrationId string
@@ -26,6 +90,23 @@ type MigrationLog struct {
 	Timestamp   time.Time
 }
 
+// Checksum is the checksum of the sql the migration ran, repeatable
+// migrations run again when theirs differs.
+func (l MigrationLog) Checksum() string {
+	return sqlChecksum(l.Sql)
+}
+
+// MigrationError is returned by Start when a migration fails to execute.
+type MigrationError struct {
+	Migration Migration
+	Sql       string
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration %q (%s) failed: %v", e.Migration.Id(), e.Migration, e.Err)
+}
+
 func NewMigrator(engine *xorm.Engine) *Migrator {
 	mg := &Migrator{}
 	mg.x = engine
@@ -35,6 +116,16 @@ func NewMigrator(engine *xorm.Engine) *Migrator {
 	return mg
 }
 
+// ForSchema returns a migrator running the same migrations in the given
+// schema, so a migration set registered once can be applied to several
+// schemas.
+func (mg *Migrator) ForSchema(schema string) *Migrator {
+	schemaMigrator := *mg
+	schemaMigrator.Schema = schema
+	schemaMigrator.Logger = mg.Logger.New("schema", schema)
+	return &schemaMigrator
+}
+
 func (mg *Migrator) MigrationsCount() int {
 	return len(mg.migrations)
 }
@@ -48,16 +139,17 @@ func (mg *Migrator) GetMigrationLog() (map[string]MigrationLog, error) {
 	logMap := make(map[string]MigrationLog)
 	logItems := make([]MigrationLog, 0)
 
-	exists, err := mg.x.IsTableExist(new(MigrationLog))
-	if err != nil {
-		return nil, err
-	}
-
-	if !exists {
-		return logMap, nil
-	}
+	// read in a session, the schema is set per transaction
+	err := mg.inTransaction(func(sess *xorm.Session) error {
+		sql, args := mg.Dialect.TableCheckSql("migration_log")
+		results, err := sess.SQL(sql, args...).Query()
+		if err != nil || len(results) == 0 {
+			return err
+		}
 
-	if err = mg.x.Find(&logItems); err != nil {
+		return sess.Find(&logItems)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -65,28 +157,131 @@ func (mg *Migrator) GetMigrationLog() (map[string]MigrationLog, error) {
 		if !logItem.Success {
 			continue
 		}
+		// repeatable migrations are logged on every run, keep the last one
+		if previous, ok := logMap[logItem.MigrationId]; ok && previous.Id > logItem.Id {
+			continue
+		}
 		logMap[logItem.MigrationId] = logItem
 	}
 
 	return logMap, nil
 }
 
-func (mg *Migrator) Start() error {
+// MigrationStatus summarizes the registered migrations against the migration
+// log, e.g. for a health endpoint telling whether migrations are complete.
+type MigrationStatus struct {
+	Applied       int       `json:"applied"`
+	Pending       int       `json:"pending"`
+	LastAppliedId string    `json:"lastAppliedId"`
+	LastAppliedAt time.Time `json:"lastAppliedAt"`
+	// Drift is set when the log records migrations that are not registered,
+	// e.g. when the database was migrated by a newer version.
+	Drift bool `json:"drift"`
+}
+
+func (mg *Migrator) Status() (*MigrationStatus, error) {
+	logMap, err := mg.GetMigrationLog()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{}
+	registered := make(map[string]bool, len(mg.migrations))
+	for _, m := range mg.migrations {
+		registered[m.Id()] = true
+		if mg.pending(m, logMap) {
+			status.Pending++
+		} else {
+			status.Applied++
+		}
+	}
+
+	// timestamps have a resolution of seconds, the log id keeps the order
+	var lastLogId int64
+	for id, logItem := range logMap {
+		if !registered[id] {
+			status.Drift = true
+		}
+		if logItem.Id > lastLogId {
+			lastLogId = logItem.Id
+			status.LastAppliedId = id
+			status.LastAppliedAt = logItem.Timestamp
+		}
+	}
+
+	return status, nil
+}
+
+func (mg *Migrator) Start() (err error) {
 	mg.Logger.Info("Starting DB migration")
 
+	if mg.Metrics != nil {
+		started := time.Now()
+		defer func() {
+			mg.Metrics.MigrationsCompleted(time.Since(started), err == nil)
+		}()
+	}
+
+	if mg.IsolationLevel != "" {
+		if _, err := mg.Dialect.SetTransactionIsolationSql(mg.IsolationLevel); err != nil {
+			return err
+		}
+		sessionIsolationSql, err := mg.Dialect.SetSessionIsolationSql(mg.IsolationLevel)
+		if err != nil {
+			return err
+		}
+		if sessionIsolationSql != "" {
+			engine, err := isolatedEngine(mg.x)
+			if err != nil {
+				return err
+			}
+			defer engine.Close()
+			return mg.onIsolatedEngine(engine, sessionIsolationSql).start()
+		}
+	}
+
+	return mg.start()
+}
+
+// start runs the pending migrations, see Start.
+func (mg *Migrator) start() error {
+	if mg.Schema != "" {
+		if _, err := mg.Dialect.SetSchemaSql(mg.Schema); err != nil {
+			return err
+		}
+	}
+
+	fingerprint := mg.fingerprint()
+	matches, err := mg.fingerprintMatches(fingerprint)
+	if err != nil {
+		return err
+	}
+	if matches {
+		mg.Logger.Debug("Skipping migrations: Fingerprint unchanged", "migrations", fingerprint.MigrationsCount)
+		return nil
+	}
+
 	logMap, err := mg.GetMigrationLog()
 	if err != nil {
 		return err
 	}
 
+	if err := mg.validate(logMap); err != nil {
+		return err
+	}
+
+	// deferred migrations are still pending, so the fingerprint would be wrong
+	deferred := false
 	for _, m := range mg.migrations {
-		_, exists := logMap[m.Id()]
-		if exists {
-			mg.Logger.Debug("Skipping migration: Already executed", "id", m.Id())
+		if !mg.pending(m, logMap) {
+			mg.Logger.Debug("Skipping migration: Already executed", "id", m.Id(), "migration", m.String())
 			continue
 		}
+		if _, exists := logMap[m.Id()]; exists {
+			mg.Logger.Info("Repeating migration: Checksum changed", "id", m.Id(), "migration", m.String())
+		}
 
-		sql := m.Sql(mg.Dialect)
+		sql, statements := mg.logSql(m)
 
 		record := MigrationLog{
 			MigrationId: m.Id(),
@@ -94,29 +289,184 @@ func (mg *Migrator) Start() error {
 			Timestamp:   time.Now(),
 		}
 
+		started := time.Now()
+		migrationDeferred := false
+		err := mg.execBatches(m)
+		if err == nil {
+			err = mg.inTransaction(func(sess *xorm.Session) error {
+				err := mg.exec(m, statements, sess)
+				if err == errMigrationDeferred {
+					deferred = true
+					migrationDeferred = true
+					return nil
+				}
+				if err != nil {
+					mg.Logger.Error("Exec failed", "id", m.Id(), "migration", m.String(), "error", err, "sql", sql)
+					record.Error = err.Error()
+					sess.Insert(&record)
+					return err
+				}
+				record.Success = true
+				sess.Insert(&record)
+				return nil
+			})
+		}
+
+		if mg.Metrics != nil && !migrationDeferred {
+			mg.Metrics.MigrationExecuted(m.Id(), time.Since(started), err == nil)
+		}
+		if err != nil {
+			return &MigrationError{Migration: m, Sql: sql, Err: err}
+		}
+	}
+
+	if deferred {
+		return nil
+	}
+	return mg.storeFingerprint(fingerprint)
+}
+
+// execBatches runs the batches of a batched migration whose condition is
+// fulfilled, each in a transaction of its own, see BatchedMigration.
+func (mg *Migrator) execBatches(m Migration) error {
+	batched, ok := m.(BatchedMigration)
+	if !ok {
+		return nil
+	}
+
+	fulfilled := true
+	if condition := m.GetCondition(); condition != nil {
 		err := mg.inTransaction(func(sess *xorm.Session) error {
-			err := mg.exec(m, sess)
+			sql, args := condition.Sql(mg.Dialect)
+			if sql == "" {
+				return nil
+			}
+			results, err := sess.SQL(sql, args...).Query()
 			if err != nil {
-				mg.Logger.Error("Exec failed", "error", err, "sql", sql)
-				record.Error = err.Error()
-				sess.Insert(&record)
 				return err
 			}
-			record.Success = true
-			sess.Insert(&record)
+			fulfilled = condition.IsFulfilled(results)
 			return nil
 		})
-
 		if err != nil {
+			mg.Logger.Error("Executing migration condition failed", "id", m.Id(), "error", err)
 			return err
 		}
 	}
+	if !fulfilled {
+		// exec skips or defers the migration
+		return nil
+	}
+
+	mg.Logger.Info("Executing migration batches", "id", m.Id(), "migration", m.String())
+	if err := batched.ExecBatches(mg); err != nil {
+		mg.Logger.Error("Executing migration batches failed", "id", m.Id(), "migration", m.String(), "error", err)
+		return err
+	}
+	return nil
+}
+
+// pending tells whether a migration has to run, that is it is not in the
+// migration log or it is repeatable and its checksum changed since it ran.
+func (mg *Migrator) pending(m Migration, logMap map[string]MigrationLog) bool {
+	logItem, exists := logMap[m.Id()]
+	if !exists {
+		return true
+	}
+	if _, ok := m.(*RepeatableMigration); !ok {
+		return false
+	}
+	sql, _ := mg.logSql(m)
+	return sqlChecksum(sql) != logItem.Checksum()
+}
+
+// logSql returns the sql recorded in the migration log for a migration and,
+// unless it is a code migration, the statements to execute.
+func (mg *Migrator) logSql(m Migration) (string, []string) {
+	sql := m.Sql(mg.Dialect)
+	if _, ok := m.(CodeMigration); ok {
+		return mg.withHooks(m, sql), nil
+	}
+
+	statements := mg.statements(m)
+	if mg.SqlRewriter != nil {
+		sql = joinStatements(statements)
+		if len(statements) == 1 {
+			sql = statements[0]
+		}
+	}
+	return mg.withHooks(m, sql), statements
+}
+
+// hooks returns the Before and After sql of a migration, rewritten by the
+// SqlRewriter if there is one.
+func (mg *Migrator) hooks(m Migration) (string, string) {
+	before, after := m.Before(mg.Dialect), m.After(mg.Dialect)
+	if mg.SqlRewriter != nil {
+		if before != "" {
+			before = mg.SqlRewriter(m.Id(), before)
+		}
+		if after != "" {
+			after = mg.SqlRewriter(m.Id(), after)
+		}
+	}
+	return before, after
+}
+
+// withHooks adds the hooks of a migration to its logged sql, so changing them
+// changes the checksum. Migrations without hooks log their sql unchanged.
+func (mg *Migrator) withHooks(m Migration, sql string) string {
+	before, after := mg.hooks(m)
+	if before == "" && after == "" {
+		return sql
+	}
+
+	statements := []string{}
+	for _, s := range []string{before, sql, after} {
+		if s != "" {
+			statements = append(statements, s)
+		}
+	}
+	return joinStatements(statements)
+}
+
+func (mg *Migrator) validate(logMap map[string]MigrationLog) error {
+	for _, m := range mg.migrations {
+		if !mg.pending(m, logMap) {
+			continue
+		}
+
+		if validatingMigration, ok := m.(ValidatingMigration); ok {
+			if err := validatingMigration.Validate(mg); err != nil {
+				mg.Logger.Error("Migration validation failed", "id", m.Id(), "migration", m.String(), "error", err)
+				return &MigrationError{Migration: m, Err: err}
+			}
+		}
+	}
 
 	return nil
 }
 
-func (mg *Migrator) exec(m Migration, sess *xorm.Session) error {
-	mg.Logger.Info("Executing migration", "id", m.Id())
+// statements returns the statements of an SQL migration, rewritten by the
+// SqlRewriter if there is one.
+func (mg *Migrator) statements(m Migration) []string {
+	var statements []string
+	if multiStatementMigration, ok := m.(MultiStatementMigration); ok {
+		statements = append(statements, multiStatementMigration.SqlStatements(mg.Dialect)...)
+	} else {
+		statements = []string{m.Sql(mg.Dialect)}
+	}
+
+	if mg.SqlRewriter != nil {
+		for i, sql := range statements {
+			statements[i] = mg.SqlRewriter(m.Id(), sql)
+		}
+	}
+	return statements
+}
+
+func (mg *Migrator) exec(m Migration, statements []string, sess *xorm.Session) error {
+	mg.Logger.Info("Executing migration", "id", m.Id(), "migration", m.String())
 
 	condition := m.GetCondition()
 	if condition != nil {
@@ -131,28 +481,127 @@ func (mg *Migrator) exec(m Migration, sess *xorm.Session) error {
 			}
 
 			if !condition.IsFulfilled(results) {
-				mg.Logger.Warn("Skipping migration: Already executed, but not recorded in migration log", "id", m.Id())
+				reason := ""
+				if explainingCondition, ok := condition.(ExplainingCondition); ok {
+					reason = explainingCondition.Reason(results)
+				}
+				if deferringCondition, ok := condition.(DeferringCondition); ok && deferringCondition.Defers(results) {
+					mg.Logger.Info("Deferring migration: Condition not fulfilled yet", "id", m.Id(), "migration", m.String(), "reason", reason)
+					return errMigrationDeferred
+				}
+				mg.Logger.Warn("Skipping migration: Already executed, but not recorded in migration log", "id", m.Id(), "migration", m.String(), "reason", reason)
+				if mg.SkipRecorder != nil {
+					return mg.SkipRecorder(sess, m.Id(), reason)
+				}
 				return nil
 			}
 		}
 	}
 
-	var err error
+	before, after := mg.hooks(m)
+	err := mg.execHook(m, "before", before, sess)
+	if err == nil {
+		err = mg.execMigration(m, statements, sess)
+	}
+	if err == nil {
+		err = mg.execHook(m, "after", after, sess)
+	}
+
+	if err != nil {
+		mg.Logger.Error("Executing migration failed", "id", m.Id(), "migration", m.String(), "error", err)
+		return err
+	}
+
+	if verifyingMigration, ok := m.(VerifyingMigration); ok {
+		if err := verifyingMigration.Verify(sess, mg); err != nil {
+			mg.Logger.Error("Migration verification failed", "id", m.Id(), "migration", m.String(), "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (mg *Migrator) execMigration(m Migration, statements []string, sess *xorm.Session) error {
 	if codeMigration, ok := m.(CodeMigration); ok {
 		mg.Logger.Debug("Executing code migration", "id", m.Id())
-		err = codeMigration.Exec(sess, mg)
-	} else {
-		sql := m.Sql(mg.Dialect)
+		return codeMigration.Exec(sess, mg)
+	}
+
+	if optionalMigration, ok := m.(optionalFeatureMigration); ok {
+		if _, err := optionalMigration.featureSql(mg.Dialect); err != nil {
+			mg.Logger.Warn("Skipping migration: Not supported", "id", m.Id(), "migration", m.String(), "error", err)
+		}
+	}
+
+	for _, sql := range statements {
+		if mg.ExplainDataMigrations && isDataStatement(sql) {
+			mg.explain(m, sql, sess)
+		}
+
 		mg.Logger.Debug("Executing sql migration", "id", m.Id(), "sql", sql)
-		_, err = sess.Exec(sql)
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mg *Migrator) execHook(m Migration, hook string, sql string, sess *xorm.Session) error {
+	if sql == "" {
+		return nil
 	}
+	mg.Logger.Debug("Executing migration hook", "id", m.Id(), "hook", hook, "sql", sql)
+	_, err := sess.Exec(sql)
+	return err
+}
 
+var dataStatementKeywords = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "WITH"}
+
+func isDataStatement(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, keyword := range dataStatementKeywords {
+		if strings.EqualFold(fields[0], keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// explain logs the query plan of sql, failing to get one does not fail the
+// migration.
+func (mg *Migrator) explain(m Migration, sql string, sess *xorm.Session) {
+	results, err := sess.QueryString(mg.Dialect.ExplainSql(strings.TrimSuffix(strings.TrimSpace(sql), ";")))
 	if err != nil {
-		mg.Logger.Error("Executing migration failed", "id", m.Id(), "error", err)
-		return err
+		mg.Logger.Warn("Explaining migration sql failed", "id", m.Id(), "sql", sql, "error", err)
+		return
 	}
 
-	return nil
+	lines := make([]string, 0, len(results))
+	for _, row := range results {
+		if len(row) == 1 {
+			for _, value := range row {
+				lines = append(lines, value)
+			}
+			continue
+		}
+
+		keys := make([]string, 0, len(row))
+		for key := range row {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = key + "=" + row[key]
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+
+	mg.Logger.Info("Query plan of migration sql", "id", m.Id(), "sql", sql, "plan", strings.Join(lines, "\n"))
 }
 
 type dbTransactionFunc func(sess *xorm.Session) error
@@ -163,10 +612,21 @@ func (mg *Migrator) inTransaction(callback dbTransactionFunc) error {
 	sess := mg.x.NewSession()
 	defer sess.Close()
 
+	if mg.sessionIsolationSql != "" {
+		if _, err = sess.Exec(mg.sessionIsolationSql); err != nil {
+			return err
+		}
+	}
+
 	if err = sess.Begin(); err != nil {
 		return err
 	}
 
+	if err = mg.prepareSession(sess); err != nil {
+		sess.Rollback()
+		return err
+	}
+
 	err = callback(sess)
 
 	if err != nil {
@@ -178,3 +638,65 @@ func (mg *Migrator) inTransaction(callback dbTransactionFunc) error {
 
 	return nil
 }
+
+// isolatedEngine opens an engine of a single connection to the database of x
+// for dialects setting the isolation level on the connection. The connections
+// of x are shared with the rest of the application, which has to keep its
+// level, and a session only keeps its connection within a transaction, so the
+// level set before starting one is only guaranteed to apply with a single
+// connection. The engine logs like x, pool settings such as the maximum
+// lifetime of connections are not carried over.
+func isolatedEngine(x *xorm.Engine) (*xorm.Engine, error) {
+	engine, err := xorm.NewEngine(x.DriverName(), x.DataSourceName())
+	if err != nil {
+		return nil, err
+	}
+	engine.SetMaxOpenConns(1)
+	engine.SetLogger(x.Logger())
+	engine.ShowSQL(x.Logger().IsShowSQL())
+	engine.SetTableMapper(x.TableMapper)
+	engine.SetColumnMapper(x.ColumnMapper)
+	engine.TZLocation = x.TZLocation
+	engine.DatabaseTZ = x.DatabaseTZ
+	return engine, nil
+}
+
+// onIsolatedEngine returns a copy of the migrator running on an engine of
+// isolatedEngine, executing sessionIsolationSql before every transaction. The
+// migrator itself and its dialect stay on the shared engine.
+func (mg *Migrator) onIsolatedEngine(engine *xorm.Engine, sessionIsolationSql string) *Migrator {
+	isolated := *mg
+	isolated.x = engine
+	isolated.Dialect = NewDialect(engine)
+	isolated.sessionIsolationSql = sessionIsolationSql
+	return &isolated
+}
+
+// prepareSession sets the isolation level and schema of a transaction that
+// has just been started.
+func (mg *Migrator) prepareSession(sess *xorm.Session) error {
+	statements := []string{}
+
+	if mg.IsolationLevel != "" {
+		isolationStatements, err := mg.Dialect.SetTransactionIsolationSql(mg.IsolationLevel)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, isolationStatements...)
+	}
+
+	if mg.Schema != "" {
+		sql, err := mg.Dialect.SetSchemaSql(mg.Schema)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, sql)
+	}
+
+	for _, sql := range statements {
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package migrator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xorm/xorm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newSqliteTestMigrator(t *testing.T) (*xorm.Engine, *Migrator) {
+	x := newSqliteTestEngine(t)
+	if _, err := x.Exec("CREATE TABLE migration_log (id INTEGER PRIMARY KEY AUTOINCREMENT, migration_id TEXT, sql TEXT, success INTEGER, error TEXT, timestamp DATETIME)"); err != nil {
+		t.Fatal(err)
+	}
+	return x, NewMigrator(x)
+}
+
+type hookedMigration struct {
+	*RawSqlMigration
+	before string
+	after  string
+}
+
+func (m *hookedMigration) Before(dialect Dialect) string {
+	return m.before
+}
+
+func (m *hookedMigration) After(dialect Dialect) string {
+	return m.after
+}
+
+func newHookedMigration(sql string) *hookedMigration {
+	return &hookedMigration{
+		RawSqlMigration: NewRawSqlMigration(sql),
+		before:          "INSERT INTO events (name) VALUES ('before')",
+		after:           "INSERT INTO events (name) VALUES ('after')",
+	}
+}
+
+func hookEvents(t *testing.T, x *xorm.Engine) []string {
+	results, err := x.QueryString("SELECT name FROM events ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []string{}
+	for _, row := range results {
+		events = append(events, row["name"])
+	}
+	return events
+}
+
+func TestMigrationHooks(t *testing.T) {
+	Convey("Migration hooks", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x, "CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)")
+
+		Convey("run around the migration", func() {
+			mg.AddMigration("hooked", newHookedMigration("INSERT INTO events (name) VALUES ('migration')"))
+			So(mg.Start(), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{"before", "migration", "after"})
+		})
+
+		Convey("a failing migration skips After and rolls back Before", func() {
+			mg.AddMigration("hooked", newHookedMigration("INSERT INTO missing (name) VALUES ('migration')"))
+			So(mg.Start(), ShouldNotBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{})
+		})
+
+		Convey("a skipped migration runs no hooks", func() {
+			m := newHookedMigration("INSERT INTO events (name) VALUES ('migration')")
+			m.Condition = &IfTableExistsCondition{TableName: "missing"}
+			mg.AddMigration("hooked", m)
+			So(mg.Start(), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{})
+			So(migrationLogRows(x, "hooked"), ShouldResemble, []map[string]string{{"success": "1", "error": ""}})
+		})
+
+		Convey("a deferred migration runs no hooks", func() {
+			m := newHookedMigration("INSERT INTO events (name) VALUES ('migration')")
+			m.Condition = &RowCountCondition{TableName: "events", MinRows: 10}
+			mg.AddMigration("hooked", m)
+			So(mg.Start(), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{})
+		})
+	})
+}
+
+func TestSkipRecorder(t *testing.T) {
+	Convey("Recording skip reasons", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x, "CREATE TABLE skip_reason (migration_id TEXT, reason TEXT)")
+		mg.SkipRecorder = func(sess *xorm.Session, migrationId string, reason string) error {
+			_, err := sess.Exec("INSERT INTO skip_reason (migration_id, reason) VALUES (?, ?)", migrationId, reason)
+			return err
+		}
+		skipped := NewRawSqlMigration("CREATE TABLE missing_copy (id INTEGER)")
+		skipped.Condition = &IfTableExistsCondition{TableName: "missing"}
+
+		Convey("records why a migration was skipped in its transaction", func() {
+			mg.AddMigration("skipped", skipped)
+			mg.AddMigration("executed", NewRawSqlMigration("CREATE TABLE executed (id INTEGER)"))
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT migration_id, reason FROM skip_reason"), ShouldResemble, []map[string]string{
+				{"migration_id": "skipped", "reason": "table missing does not exist"},
+			})
+		})
+
+		Convey("fails the migration when recording fails", func() {
+			execTestSql(x, "DROP TABLE skip_reason")
+			mg.AddMigration("skipped", skipped)
+			So(mg.Start(), ShouldNotBeNil)
+			So(migrationLogRows(x, "skipped"), ShouldBeEmpty)
+		})
+
+		Convey("isn't called by dry runs", func() {
+			mg.AddMigration("skipped", skipped)
+			So(mg.DryRun(), ShouldBeNil)
+			So(queryRows(x, "SELECT reason FROM skip_reason"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestWithHooksLogSql(t *testing.T) {
+	Convey("Logged sql of hooked migrations", t, func() {
+		_, mg := newSqliteTestMigrator(t)
+		sql := "INSERT INTO events (name) VALUES ('migration')"
+
+		Convey("is unchanged without hooks", func() {
+			logged, _ := mg.logSql(&hookedMigration{RawSqlMigration: NewRawSqlMigration(sql)})
+			So(logged, ShouldEqual, sql)
+		})
+
+		Convey("includes the hooks", func() {
+			hooked := newHookedMigration(sql)
+			logged, _ := mg.logSql(hooked)
+			So(logged, ShouldEqual, joinStatements([]string{hooked.before, sql, hooked.after}))
+			So(sqlChecksum(logged), ShouldNotEqual, sqlChecksum(sql))
+
+			Convey("and changes when a hook is removed", func() {
+				hooked.after = ""
+				afterRemoved, _ := mg.logSql(hooked)
+				So(afterRemoved, ShouldNotEqual, logged)
+			})
+		})
+	})
+}
+
+func TestTransactionIsolation(t *testing.T) {
+	Convey("Transaction isolation levels", t, func() {
+		Convey("are set within the transaction on Postgres", func() {
+			dialect := NewPostgresDialect(nil)
+			statements, err := dialect.SetTransactionIsolationSql("read_committed")
+			So(err, ShouldBeNil)
+			So(statements, ShouldResemble, []string{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED"})
+
+			sql, err := dialect.SetSessionIsolationSql("read_committed")
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, "")
+		})
+
+		Convey("are set on the connection on MySQL", func() {
+			dialect := NewMysqlDialect(nil)
+			statements, err := dialect.SetTransactionIsolationSql(IsolationRepeatableRead)
+			So(err, ShouldBeNil)
+			So(statements, ShouldBeEmpty)
+
+			sql, err := dialect.SetSessionIsolationSql(IsolationRepeatableRead)
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+		})
+
+		Convey("are not set on SQLite", func() {
+			x, mg := newSqliteTestMigrator(t)
+			statements, err := mg.Dialect.SetTransactionIsolationSql(IsolationSerializable)
+			So(err, ShouldBeNil)
+			So(statements, ShouldBeEmpty)
+
+			mg.IsolationLevel = IsolationSerializable
+			mg.AddMigration("create events", NewRawSqlMigration("CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)"))
+			So(mg.Start(), ShouldBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{})
+		})
+
+		Convey("fail when unknown", func() {
+			for _, dialect := range []Dialect{NewPostgresDialect(nil), NewMysqlDialect(nil), NewSqlite3Dialect(nil)} {
+				_, err := dialect.SetTransactionIsolationSql("snapshot")
+				So(err, ShouldNotBeNil)
+				_, err = dialect.SetSessionIsolationSql("snapshot")
+				So(err, ShouldNotBeNil)
+			}
+
+			_, mg := newSqliteTestMigrator(t)
+			mg.IsolationLevel = "snapshot"
+			So(mg.Start(), ShouldNotBeNil)
+		})
+
+		Convey("set on the connection are set before the transaction is started", func() {
+			x, mg := newSqliteTestMigrator(t)
+			execTestSql(x, "CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)")
+			mg.sessionIsolationSql = "INSERT INTO events (name) VALUES ('isolation')"
+
+			err := mg.inTransaction(func(sess *xorm.Session) error {
+				_, err := sess.Exec("INSERT INTO missing (name) VALUES ('migration')")
+				return err
+			})
+			So(err, ShouldNotBeNil)
+			So(hookEvents(t, x), ShouldResemble, []string{"isolation"})
+		})
+
+		Convey("set on the connection run the migrations on an engine of a single connection", func() {
+			dir, err := ioutil.TempDir("", "migrator")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			x, err := xorm.NewEngine(SQLITE, filepath.Join(dir, "grafana.db"))
+			So(err, ShouldBeNil)
+			defer x.Close()
+			execTestSql(x,
+				"CREATE TABLE migration_log (id INTEGER PRIMARY KEY AUTOINCREMENT, migration_id TEXT, sql TEXT, success INTEGER, error TEXT, timestamp DATETIME)",
+				"CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)",
+			)
+			mg := NewMigrator(x)
+			mg.AddMigration("insert event", NewRawSqlMigration("INSERT INTO events (name) VALUES ('migration')"))
+
+			engine, err := isolatedEngine(x)
+			So(err, ShouldBeNil)
+			defer engine.Close()
+			So(engine.DB().Stats().MaxOpenConnections, ShouldEqual, 1)
+
+			// what MySQL runs with SET SESSION TRANSACTION ISOLATION LEVEL
+			isolated := mg.onIsolatedEngine(engine, "INSERT INTO events (name) VALUES ('isolation')")
+			So(isolated.Dialect.(*Sqlite3).engine, ShouldEqual, engine)
+			So(isolated.start(), ShouldBeNil)
+			// every transaction sets it, the one of the migration included
+			events := hookEvents(t, x)
+			So(events, ShouldHaveLength, 5)
+			So(events[2:4], ShouldResemble, []string{"isolation", "migration"})
+
+			So(mg.x, ShouldEqual, x)
+			So(mg.Dialect.(*Sqlite3).engine, ShouldEqual, x)
+			So(mg.sessionIsolationSql, ShouldEqual, "")
+		})
+	})
+}
+
+func TestMigrationStatus(t *testing.T) {
+	Convey("Summarizing the migration status", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		mg.AddMigration("create dashboard", NewRawSqlMigration("CREATE TABLE dashboard (id INTEGER PRIMARY KEY)"))
+		mg.AddMigration("create tag", NewRawSqlMigration("CREATE TABLE tag (id INTEGER PRIMARY KEY)"))
+
+		Convey("counts every migration as pending before the first run", func() {
+			status, err := mg.Status()
+			So(err, ShouldBeNil)
+			So(*status, ShouldResemble, MigrationStatus{Pending: 2})
+		})
+
+		Convey("reports the last applied migration", func() {
+			So(mg.Start(), ShouldBeNil)
+			mg.AddMigration("create star", NewRawSqlMigration("CREATE TABLE star (id INTEGER PRIMARY KEY)"))
+
+			status, err := mg.Status()
+			So(err, ShouldBeNil)
+			So(status.Applied, ShouldEqual, 2)
+			So(status.Pending, ShouldEqual, 1)
+			So(status.LastAppliedId, ShouldEqual, "create tag")
+			So(status.LastAppliedAt.IsZero(), ShouldBeFalse)
+			So(status.Drift, ShouldBeFalse)
+		})
+
+		Convey("reports drift for logged migrations that aren't registered", func() {
+			So(mg.Start(), ShouldBeNil)
+			execTestSql(x, "INSERT INTO migration_log (migration_id, sql, success, error, timestamp) VALUES ('added by a newer version', '', 1, '', '2026-01-01 00:00:00')")
+
+			status, err := mg.Status()
+			So(err, ShouldBeNil)
+			So(status.Applied, ShouldEqual, 2)
+			So(status.LastAppliedId, ShouldEqual, "added by a newer version")
+			So(status.Drift, ShouldBeTrue)
+		})
+	})
+}
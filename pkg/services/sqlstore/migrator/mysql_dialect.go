@@ -2,8 +2,12 @@ package migrator
 
 import (
 	"fmt"
+	"io"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/VividCortex/mysqlerr"
 	"github.com/go-sql-driver/mysql"
@@ -26,6 +30,9 @@ func (db *Mysql) SupportEngine() bool {
 	return true
 }
 
+// Quote uses backticks, which quote identifiers whether or not the server
+// runs with the ANSI_QUOTES SQL mode. Double quotes would start string
+// literals without it.
 func (db *Mysql) Quote(name string) string {
 	return "`" + name + "`"
 }
@@ -41,6 +48,68 @@ func (db *Mysql) BooleanStr(value bool) string {
 	return "0"
 }
 
+func (db *Mysql) Random() string {
+	return "RAND()"
+}
+
+func (db *Mysql) JsonObjectExpr(keys []string, values []string) string {
+	return "JSON_OBJECT(" + jsonObjectArgs(keys, values) + ")"
+}
+
+// JsonExtractTextExpr unquotes the extracted value, which leaves JSON null
+// as the string null rather than NULL.
+func (db *Mysql) JsonExtractTextExpr(expr string, path []string) string {
+	return "JSON_UNQUOTE(" + db.JsonExtractExpr(expr, path) + ")"
+}
+
+func (db *Mysql) JsonExtractExpr(expr string, path []string) string {
+	return "JSON_EXTRACT(" + expr + ", " + mysqlJsonPathLiteral(path) + ")"
+}
+
+func (db *Mysql) JsonValueExpr(value string) string {
+	return "CAST(" + mysqlStringLiteral(value) + " AS JSON)"
+}
+
+func (db *Mysql) JsonSetExpr(expr string, path []string, value string) string {
+	return "JSON_SET(" + expr + ", " + mysqlJsonPathLiteral(path) + ", " + value + ")"
+}
+
+func (db *Mysql) JsonRemoveExpr(expr string, path []string) string {
+	return "JSON_REMOVE(" + expr + ", " + mysqlJsonPathLiteral(path) + ")"
+}
+
+// mysqlJsonPathLiteral doubles the backslashes of the path literal, which
+// escape in MySQL string literals.
+func mysqlJsonPathLiteral(path []string) string {
+	return strings.Replace(jsonPathLiteral(path), `\`, `\\`, -1)
+}
+
+func (db *Mysql) ZeroDateTimeExpr(expr string, replacement string) string {
+	// compare as text, zero dates are invalid date values in strict mode
+	return fmt.Sprintf("CASE WHEN CAST(%s AS CHAR) LIKE '0000-00-00%%' THEN %s ELSE %s END", expr, replacement, expr)
+}
+
+// Default replaces zero date defaults, which strict mode (NO_ZERO_DATE)
+// rejects, with NULL or the smallest valid value of the column type.
+func (db *Mysql) Default(col *Column) string {
+	if !strings.HasPrefix(strings.Trim(col.Default, "'"), "0000-00-00") {
+		return col.Default
+	}
+
+	switch {
+	case col.Nullable:
+		return "NULL"
+	case col.Type == DB_Date:
+		return "'1000-01-01'"
+	case col.Type == DB_TimeStamp:
+		return "'1970-01-01 00:00:01'"
+	case col.Type == DB_DateTime:
+		return "'1000-01-01 00:00:00'"
+	default:
+		return col.Default
+	}
+}
+
 func (db *Mysql) SqlType(c *Column) string {
 	var res string
 	switch c.Type {
@@ -57,8 +126,8 @@ func (db *Mysql) SqlType(c *Column) string {
 		c.IsPrimaryKey = true
 		c.Nullable = false
 		res = DB_BigInt
-	case DB_Bytea:
-		res = DB_Blob
+	case DB_Blob, DB_Bytea:
+		return mysqlBlobType(c.Length)
 	case DB_TimeStampz:
 		res = DB_Char
 		c.Length = 64
@@ -76,11 +145,18 @@ func (db *Mysql) SqlType(c *Column) string {
 		hasLen1 = true
 	}
 
-	if hasLen2 {
+	integer := mysqlIntegerTypes[res]
+	if integer && c.DisplayWidth > 0 {
+		res += "(" + strconv.Itoa(c.DisplayWidth) + ")"
+	} else if hasLen2 {
 		res += "(" + strconv.Itoa(c.Length) + "," + strconv.Itoa(c.Length2) + ")"
 	} else if hasLen1 {
 		res += "(" + strconv.Itoa(c.Length) + ")"
 	}
+	// ZEROFILL implies UNSIGNED, which MySQL reports with it
+	if integer && c.Zerofill {
+		res += " UNSIGNED ZEROFILL"
+	}
 
 	switch c.Type {
 	case DB_Char, DB_Varchar, DB_NVarchar, DB_TinyText, DB_Text, DB_MediumText, DB_LongText:
@@ -90,6 +166,346 @@ func (db *Mysql) SqlType(c *Column) string {
 	return res
 }
 
+var mysqlIntegerTypes = map[string]bool{DB_TinyInt: true, DB_SmallInt: true, DB_MediumInt: true, DB_Int: true, DB_Integer: true, DB_BigInt: true}
+
+// mysqlBlobType returns the smallest blob type holding length bytes, the
+// length of a BLOB column is its capacity rather than a limit.
+func mysqlBlobType(length int) string {
+	switch {
+	case length > 16777215:
+		return DB_LongBlob
+	case length > 65535:
+		return DB_MediumBlob
+	default:
+		return DB_Blob
+	}
+}
+
+// mysqlTypeSynonyms maps type names to the names MySQL reports for them.
+var mysqlTypeSynonyms = map[string]string{
+	"INTEGER":          DB_Int,
+	"INTEGER UNSIGNED": "INT UNSIGNED",
+	"BOOL":             "TINYINT(1)",
+	"BOOLEAN":          "TINYINT(1)",
+	"DEC":              DB_Decimal,
+	"FIXED":            DB_Decimal,
+	DB_Numeric:         DB_Decimal,
+	"DOUBLE PRECISION": DB_Double,
+	DB_Real:            DB_Double,
+	DB_NVarchar:        DB_Varchar,
+	"NATIONAL VARCHAR": DB_Varchar,
+	"NCHAR":            DB_Char,
+	"NATIONAL CHAR":    DB_Char,
+}
+
+// integer display widths, e.g. the 11 of INT(11), don't change the type
+var mysqlIntWidthPattern = regexp.MustCompile(`^((TINYINT|SMALLINT|MEDIUMINT|INT|BIGINT)( UNSIGNED)?( ZEROFILL)?)\(\d+\)$`)
+
+func mysqlCanonicalType(sqlType string) string {
+	canonical := canonicalType(sqlType, mysqlTypeSynonyms)
+	switch canonical {
+	// TINYINT(1) is how MySQL reports booleans
+	case "TINYINT(1)":
+		return canonical
+	case DB_Decimal:
+		return "DECIMAL(10,0)"
+	}
+	return mysqlIntWidthPattern.ReplaceAllString(canonical, "$1")
+}
+
+func (db *Mysql) TypesEquivalent(declared string, introspected string) bool {
+	return mysqlCanonicalType(declared) == mysqlCanonicalType(introspected)
+}
+
+func (db *Mysql) ModifyColumnSql(tableName string, col *Column) []string {
+	sql := "ALTER TABLE " + db.Quote(tableName) + " MODIFY " + col.StringNoPk(db)
+	// MODIFY replaces the whole column definition, so keep auto increment
+	if col.IsAutoIncrement {
+		sql += db.AutoIncrStr()
+	}
+	return []string{strings.TrimSpace(sql)}
+}
+
+func (db *Mysql) DropForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error {
+	_, err := sess.Exec("ALTER TABLE " + db.Quote(tableName) + " DROP FOREIGN KEY " + db.Quote(fk.XName(tableName)))
+	return err
+}
+
+// ReplacePrimaryKey fails before altering the table if an auto increment
+// column would be left without an index, MySQL requires one starting with it.
+func (db *Mysql) ReplacePrimaryKey(sess *xorm.Session, tableName string, oldCols []string, index *Index) error {
+	table, err := db.DescribeTable(sess, tableName)
+	if err != nil {
+		return err
+	}
+	indexes, err := db.ListIndexes(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range table.Columns {
+		if !col.IsAutoIncrement {
+			continue
+		}
+		indexed := strings.EqualFold(index.Cols[0], col.Name)
+		for _, other := range indexes {
+			if !strings.EqualFold(other.Name, index.Name) && len(other.Cols) > 0 && strings.EqualFold(other.Cols[0], col.Name) {
+				indexed = true
+			}
+		}
+		if !indexed {
+			return fmt.Errorf("auto increment column %s.%s needs an index of its own before the primary key can be replaced", tableName, col.Name)
+		}
+	}
+	return db.BaseDialect.ReplacePrimaryKey(sess, tableName, oldCols, index)
+}
+
+func (db *Mysql) DeferrableStr(fk *ForeignKey) (string, error) {
+	if fk.Deferrable || fk.InitiallyDeferred {
+		return "", db.notSupported("deferrable foreign key")
+	}
+	return "", nil
+}
+
+// OrphanedRowsCondition reads a self referencing table through a derived
+// table, MySQL doesn't allow subqueries of the table an UPDATE or DELETE
+// changes. DISTINCT keeps the derived table from being merged into the
+// statement.
+func (db *Mysql) OrphanedRowsCondition(tableName string, fk *ForeignKey) string {
+	if !strings.EqualFold(tableName, fk.RefTable) {
+		return db.BaseDialect.OrphanedRowsCondition(tableName, fk)
+	}
+	refSource := fmt.Sprintf("(SELECT DISTINCT %s FROM %s)", db.QuoteColList(fk.RefCols), db.Quote(fk.RefTable))
+	return db.orphanedRowsCondition(tableName, fk, refSource)
+}
+
+// IndexVisibilitySql hides or shows an index to the optimizer, which needs
+// MySQL 8.0. Invisible indexes are still maintained and enforce uniqueness.
+func (db *Mysql) IndexVisibilitySql(tableName string, index *Index, visible bool) (string, error) {
+	visibility := "INVISIBLE"
+	if visible {
+		visibility = "VISIBLE"
+	}
+	return fmt.Sprintf("ALTER TABLE %s ALTER INDEX %s %s", db.Quote(tableName), db.Quote(index.XName(tableName)), visibility), nil
+}
+
+// PartitionByStr renders the expression as is. MySQL needs the definitions
+// of the first partitions of RANGE and LIST partitioned tables in the
+// expression, e.g. RANGE (id) (PARTITION p0 VALUES LESS THAN (1000)).
+func (db *Mysql) PartitionByStr(expr string) (string, error) {
+	return " PARTITION BY " + expr, nil
+}
+
+func (db *Mysql) AddPartitionSql(tableName string, partitionName string, bound *PartitionBound) (string, error) {
+	values := fmt.Sprintf("LESS THAN (%s)", bound.To)
+	if len(bound.In) > 0 {
+		values = fmt.Sprintf("IN (%s)", strings.Join(bound.In, ", "))
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD PARTITION (PARTITION %s VALUES %s)", db.Quote(tableName), db.Quote(partitionName), values), nil
+}
+
+func (db *Mysql) MaxIndexColumns() int {
+	return 16
+}
+
+// MaxIndexKeyLength is the InnoDB limit for the DYNAMIC and COMPRESSED row
+// formats, tables using COMPACT or REDUNDANT are limited to 767 bytes.
+func (db *Mysql) MaxIndexKeyLength() int {
+	return 3072
+}
+
+func (db *Mysql) IndexKeyLength(col *Column) int {
+	switch col.Type {
+	case DB_Char, DB_Varchar, DB_NVarchar:
+		// text columns use the utf8mb4 charset, up to 4 bytes per character
+		return col.Length * 4
+	case DB_TinyInt, DB_Bool:
+		return 1
+	case DB_SmallInt:
+		return 2
+	case DB_MediumInt:
+		return 3
+	case DB_Int, DB_Integer, DB_Serial:
+		return 4
+	case DB_BigInt, DB_BigSerial, DB_DateTime, DB_TimeStamp:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// MaxColumns is the InnoDB limit, the server allows 4096.
+func (db *Mysql) MaxColumns() int {
+	return 1017
+}
+
+// MaxRowSize is the limit of the server, which fails CREATE TABLE with Row
+// size too large beyond it.
+func (db *Mysql) MaxRowSize() int {
+	return 65535
+}
+
+// ColumnRowSize returns the worst case size of the column in a row. TEXT and
+// BLOB values are stored apart from the row and only count with their length
+// and pointer.
+func (db *Mysql) ColumnRowSize(col *Column) int {
+	switch col.Type {
+	case DB_Varchar, DB_NVarchar:
+		if col.Length*4 > 255 {
+			return col.Length*4 + 2
+		}
+		return col.Length*4 + 1
+	case DB_TinyText, DB_TinyBlob:
+		return 9
+	case DB_Text:
+		return 10
+	case DB_MediumText, DB_MediumBlob:
+		return 11
+	case DB_LongText, DB_LongBlob:
+		return 12
+	case DB_Blob, DB_Bytea:
+		return db.ColumnRowSize(&Column{Type: mysqlBlobType(col.Length)})
+	case DB_Binary, DB_VarBinary:
+		return col.Length + 2
+	case DB_Date, DB_Time:
+		return 3
+	case DB_DateTime, DB_TimeStamp:
+		return 8
+	case DB_Float, DB_Real:
+		return 4
+	case DB_Double:
+		return 8
+	case DB_Decimal, DB_Numeric:
+		return col.Length/2 + 1
+	}
+	return db.IndexKeyLength(col)
+}
+
+// SetTransactionIsolationSql returns no statements, MySQL rejects SET
+// TRANSACTION within a transaction. The level is set on the connection before
+// the transaction is started instead, see SetSessionIsolationSql.
+func (db *Mysql) SetTransactionIsolationSql(level string) ([]string, error) {
+	_, err := normalizeIsolationLevel(level)
+	return nil, err
+}
+
+func (db *Mysql) SetSessionIsolationSql(level string) (string, error) {
+	level, err := normalizeIsolationLevel(level)
+	if err != nil {
+		return "", err
+	}
+	return "SET SESSION TRANSACTION ISOLATION LEVEL " + level, nil
+}
+
+var mysqlLockRanks = map[string]int{LockNone: 0, LockShared: 1, LockExclusive: 2}
+
+// OnlineDDLSql checks the requested algorithm and lock against the least
+// disruptive ones InnoDB supports for the change, see
+// https://dev.mysql.com/doc/refman/5.7/en/innodb-online-ddl-operations.html
+func (db *Mysql) OnlineDDLSql(change string, col *Column, ddl *OnlineDDL) (string, error) {
+	algorithm, lock := AlgorithmInplace, LockNone
+	switch change {
+	case DDLAddColumn:
+		if col != nil && col.IsAutoIncrement {
+			lock = LockShared
+		}
+	case DDLModifyColumn:
+		// changing the data type of a column copies the table
+		algorithm, lock = AlgorithmCopy, LockShared
+	case DDLWidenVarchar:
+	case DDLAddIndex, DDLDropIndex:
+	default:
+		return "", fmt.Errorf("online DDL is not supported for %s", change)
+	}
+
+	requestedAlgorithm := strings.ToUpper(ddl.Algorithm)
+	requestedLock := strings.ToUpper(ddl.Lock)
+
+	if requestedAlgorithm == AlgorithmInplace && algorithm != AlgorithmInplace {
+		return "", fmt.Errorf("%s does not support ALGORITHM=%s", change, requestedAlgorithm)
+	}
+	if rank, ok := mysqlLockRanks[requestedLock]; ok && rank < mysqlLockRanks[lock] {
+		return "", fmt.Errorf("%s does not support LOCK=%s", change, requestedLock)
+	}
+
+	options := []string{}
+	if requestedAlgorithm != "" {
+		options = append(options, "ALGORITHM="+requestedAlgorithm)
+	}
+	if requestedLock != "" {
+		options = append(options, "LOCK="+requestedLock)
+	}
+	if len(options) == 0 {
+		return "", nil
+	}
+
+	// CREATE and DROP INDEX take space separated options, ALTER TABLE a list
+	if change == DDLAddIndex || change == DDLDropIndex {
+		return " " + strings.Join(options, " "), nil
+	}
+	return ", " + strings.Join(options, ", "), nil
+}
+
+// ModifyColumnChange detects VARCHAR columns that only get longer, which
+// InnoDB does in place without copying the table as long as the length
+// prefix of the values keeps its size.
+func (db *Mysql) ModifyColumnChange(sess *xorm.Session, tableName string, col *Column) (string, error) {
+	if col.Type != DB_Varchar && col.Type != DB_NVarchar {
+		return DDLModifyColumn, nil
+	}
+
+	quote := db.Quote
+	sql := "SELECT " + quote("DATA_TYPE") + " AS type, " + quote("CHARACTER_MAXIMUM_LENGTH") + " AS length, " + quote("IS_NULLABLE") + " AS nullable, " + quote("CHARACTER_SET_NAME") + " AS charset, " + quote("COLLATION_NAME") + " AS collation" +
+		" FROM " + quote("INFORMATION_SCHEMA") + "." + quote("COLUMNS") + " WHERE " + quote("TABLE_SCHEMA") + " = DATABASE() AND " + quote("TABLE_NAME") + "=? AND " + quote("COLUMN_NAME") + "=?"
+	results, err := sess.SQL(sql, tableName, col.Name).Query()
+	if err != nil || len(results) == 0 {
+		return DDLModifyColumn, err
+	}
+
+	row := results[0]
+	length, err := strconv.Atoi(string(row["length"]))
+	if err != nil {
+		return DDLModifyColumn, nil
+	}
+	current := &Column{Name: col.Name, Type: strings.ToUpper(string(row["type"])), Length: length, Nullable: introspectedBool(row["nullable"])}
+	if mysqlVarcharWidenedInplace(current, string(row["charset"]), string(row["collation"]), col) {
+		return DDLWidenVarchar, nil
+	}
+	return DDLModifyColumn, nil
+}
+
+// mysqlVarcharWidenedInplace tells whether changing the current column to
+// col only makes a VARCHAR longer. Values of up to 255 bytes have a one byte
+// length prefix, longer ones two, so the change must not cross 255 bytes.
+// SqlType declares the utf8mb4 charset and collation, a column with another
+// one gets converted and copied.
+func mysqlVarcharWidenedInplace(current *Column, charset string, collation string, col *Column) bool {
+	const bytesPerChar = 4
+	if current.Type != DB_Varchar || (col.Type != DB_Varchar && col.Type != DB_NVarchar) {
+		return false
+	}
+	if charset != "utf8mb4" || collation != "utf8mb4_unicode_ci" {
+		return false
+	}
+	if current.Nullable != col.Nullable || col.Length < current.Length {
+		return false
+	}
+	return (current.Length*bytesPerChar <= 255) == (col.Length*bytesPerChar <= 255)
+}
+
+func (db *Mysql) NullSafeEquals(a string, b string) string {
+	return a + " <=> " + b
+}
+
+// SwapTableSql uses a multi table RENAME TABLE, which MySQL performs atomically.
+func (db *Mysql) SwapTableSql(tableName string, newTableName string, backupTableName string) []string {
+	return []string{fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", db.Quote(tableName), db.Quote(backupTableName), db.Quote(newTableName), db.Quote(tableName))}
+}
+
+func (db *Mysql) TableScopedIndexNames() bool {
+	return true
+}
+
 func (db *Mysql) UpdateTableSql(tableName string, columns []*Column) string {
 	var statements = []string{}
 
@@ -102,18 +518,511 @@ func (db *Mysql) UpdateTableSql(tableName string, columns []*Column) string {
 	return "ALTER TABLE " + db.Quote(tableName) + " " + strings.Join(statements, ", ") + ";"
 }
 
+// LikeEscapeStr doubles the backslash, which escapes characters in MySQL
+// string literals unless NO_BACKSLASH_ESCAPES is set.
+func (db *Mysql) LikeEscapeStr() string {
+	return `ESCAPE '\\'`
+}
+
+// AutoIncrementStartSql sets the counter of the table, InnoDB doesn't move
+// it below the largest id plus one.
+func (db *Mysql) AutoIncrementStartSql(tableName string, col *Column, value int64) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", db.Quote(tableName), value)}
+}
+
+func (db *Mysql) TableCheckSql(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	sql := "SELECT 1 FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("TABLES") + " WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=?"
+	return sql, args
+}
+
 func (db *Mysql) IndexCheckSql(tableName, indexName string) (string, []interface{}) {
 	args := []interface{}{tableName, indexName}
 	sql := "SELECT 1 FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("STATISTICS") + " WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=? AND " + db.Quote("INDEX_NAME") + "=?"
 	return sql, args
 }
 
+func (db *Mysql) ViewDefinitionSql(viewName string) (string, []interface{}) {
+	args := []interface{}{viewName}
+	sql := "SELECT " + db.Quote("VIEW_DEFINITION") + " AS " + db.Quote("definition") + " FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("VIEWS") + " WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=?"
+	return sql, args
+}
+
+// TableSizeSql reads the statistics of the table, which InnoDB estimates from
+// a sample of pages: the row count may be off by half. MySQL 8.0 caches them
+// for information_schema_stats_expiry, a day by default.
+func (db *Mysql) TableSizeSql(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	sql := "SELECT " + db.Quote("TABLE_ROWS") + " AS row_count, " + db.Quote("DATA_LENGTH") + " + " + db.Quote("INDEX_LENGTH") + " AS byte_size FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("TABLES") +
+		" WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=?"
+	return sql, args
+}
+
 func (db *Mysql) ColumnCheckSql(tableName, columnName string) (string, []interface{}) {
 	args := []interface{}{tableName, columnName}
 	sql := "SELECT 1 FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("COLUMNS") + " WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=? AND " + db.Quote("COLUMN_NAME") + "=?"
 	return sql, args
 }
 
+func (db *Mysql) UpdateFromSql(tableName string, columnName string, sourceTable string, on string, expr string, where string) string {
+	quote := db.Quote
+	sql := fmt.Sprintf("UPDATE %s JOIN %s ON (%s) SET %s.%s = %s", quote(tableName), quote(sourceTable), on, quote(tableName), quote(columnName), expr)
+	if where != "" {
+		sql += " WHERE (" + where + ")"
+	}
+	return sql
+}
+
+// CastExpr uses the types CAST accepts, which are fewer than the column
+// types. Floating point values are not cast, CAST only supports them since
+// MySQL 8.0.17.
+func (db *Mysql) CastExpr(expr string, col *Column) string {
+	var castType string
+	switch col.Type {
+	case DB_Bit, DB_TinyInt, DB_SmallInt, DB_MediumInt, DB_Int, DB_Integer, DB_BigInt, DB_Bool, DB_Serial, DB_BigSerial:
+		castType = "SIGNED"
+	case DB_Char, DB_Varchar, DB_NVarchar:
+		castType = "CHAR"
+		if col.Length > 0 {
+			castType += "(" + strconv.Itoa(col.Length) + ")"
+		}
+	case DB_TinyText, DB_Text, DB_MediumText, DB_LongText, DB_Enum, DB_Set, DB_Uuid, DB_TimeStampz:
+		castType = "CHAR"
+	case DB_Date:
+		castType = DB_Date
+	case DB_DateTime, DB_TimeStamp:
+		castType = DB_DateTime
+	case DB_Time:
+		castType = DB_Time
+	case DB_Decimal, DB_Numeric:
+		castType = DB_Decimal
+		if col.Length2 > 0 {
+			castType += "(" + strconv.Itoa(col.Length) + "," + strconv.Itoa(col.Length2) + ")"
+		} else if col.Length > 0 {
+			castType += "(" + strconv.Itoa(col.Length) + ")"
+		}
+	case DB_Binary, DB_VarBinary, DB_TinyBlob, DB_Blob, DB_MediumBlob, DB_LongBlob, DB_Bytea:
+		castType = DB_Binary
+	default:
+		return expr
+	}
+	return fmt.Sprintf("CAST(%s AS %s)", expr, castType)
+}
+
+// ConstraintExistsSql finds unique, primary key, foreign key and, from MySQL
+// 8.0.16, check constraints.
+func (db *Mysql) ConstraintExistsSql(tableName, constraintName string) (string, []interface{}) {
+	args := []interface{}{tableName, constraintName}
+	sql := "SELECT 1 FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("TABLE_CONSTRAINTS") + " WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=? AND " + db.Quote("CONSTRAINT_NAME") + "=?"
+	return sql, args
+}
+
+func (db *Mysql) ListTables(sess *xorm.Session) ([]string, error) {
+	quote := db.Quote
+	return tableNames(sess, "SELECT "+quote("TABLE_NAME")+" AS name FROM "+quote("INFORMATION_SCHEMA")+"."+quote("TABLES")+" WHERE "+quote("TABLE_SCHEMA")+" = DATABASE() AND "+quote("TABLE_TYPE")+" = 'BASE TABLE' ORDER BY "+quote("TABLE_NAME"))
+}
+
+func (db *Mysql) DescribeTable(sess *xorm.Session, tableName string) (*Table, error) {
+	quote := db.Quote
+	sql := "SELECT " + quote("COLUMN_NAME") + " AS name, " + quote("COLUMN_TYPE") + " AS type, " + quote("IS_NULLABLE") + " AS nullable, " + quote("COLUMN_DEFAULT") + " AS dflt, " + quote("COLUMN_KEY") + " AS col_key, " + quote("EXTRA") + " AS extra, " + quote("COLUMN_COMMENT") + " AS comment" +
+		" FROM " + quote("INFORMATION_SCHEMA") + "." + quote("COLUMNS") + " WHERE " + quote("TABLE_SCHEMA") + " = DATABASE() AND " + quote("TABLE_NAME") + "=? ORDER BY " + quote("ORDINAL_POSITION")
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	table := &Table{Name: tableName}
+	for _, row := range results {
+		col := &Column{
+			Name:            string(row["name"]),
+			Type:            string(row["type"]),
+			Nullable:        introspectedBool(row["nullable"]),
+			Default:         string(row["dflt"]),
+			IsPrimaryKey:    string(row["col_key"]) == "PRI",
+			IsAutoIncrement: strings.Contains(strings.ToLower(string(row["extra"])), "auto_increment"),
+			Comment:         string(row["comment"]),
+		}
+		if col.IsPrimaryKey {
+			table.PrimaryKeys = append(table.PrimaryKeys, col.Name)
+		}
+		table.Columns = append(table.Columns, col)
+	}
+
+	sql = "SELECT " + quote("TABLE_COMMENT") + " AS comment FROM " + quote("INFORMATION_SCHEMA") + "." + quote("TABLES") + " WHERE " + quote("TABLE_SCHEMA") + " = DATABASE() AND " + quote("TABLE_NAME") + "=?"
+	results, err = sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > 0 {
+		table.Comment = string(results[0]["comment"])
+	}
+	return table, nil
+}
+
+func (db *Mysql) ListIndexes(sess *xorm.Session, tableName string) ([]*Index, error) {
+	quote := db.Quote
+	sql := "SELECT " + quote("INDEX_NAME") + " AS index_name, " + quote("NON_UNIQUE") + " = 0 AS is_unique, " + quote("COLUMN_NAME") + " AS column_name" +
+		" FROM " + quote("INFORMATION_SCHEMA") + "." + quote("STATISTICS") + " WHERE " + quote("TABLE_SCHEMA") + " = DATABASE() AND " + quote("TABLE_NAME") + "=? AND " + quote("INDEX_NAME") + " <> 'PRIMARY'" +
+		" ORDER BY " + quote("INDEX_NAME") + ", " + quote("SEQ_IN_INDEX")
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	return collectIndexes(results), nil
+}
+
+func (db *Mysql) ListConstraints(sess *xorm.Session, tableName string) ([]*Constraint, error) {
+	quote := db.Quote
+	sql := "SELECT tc." + quote("CONSTRAINT_NAME") + " AS name, tc." + quote("CONSTRAINT_TYPE") + " AS type, k." + quote("COLUMN_NAME") + " AS column_name, k." + quote("REFERENCED_TABLE_NAME") + " AS ref_table, k." + quote("REFERENCED_COLUMN_NAME") + " AS ref_column" +
+		" FROM " + quote("INFORMATION_SCHEMA") + "." + quote("TABLE_CONSTRAINTS") + " tc LEFT JOIN " + quote("INFORMATION_SCHEMA") + "." + quote("KEY_COLUMN_USAGE") + " k" +
+		" ON k." + quote("CONSTRAINT_SCHEMA") + " = tc." + quote("CONSTRAINT_SCHEMA") + " AND k." + quote("TABLE_NAME") + " = tc." + quote("TABLE_NAME") + " AND k." + quote("CONSTRAINT_NAME") + " = tc." + quote("CONSTRAINT_NAME") +
+		" WHERE tc." + quote("TABLE_SCHEMA") + " = DATABASE() AND tc." + quote("TABLE_NAME") + "=? ORDER BY tc." + quote("CONSTRAINT_NAME") + ", k." + quote("ORDINAL_POSITION")
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	return collectConstraints(results), nil
+}
+
+// TableDependents reads foreign keys from KEY_COLUMN_USAGE. Views are found
+// by the quoted table name in their definitions, which MySQL stores with
+// backticks, VIEW_TABLE_USAGE needs MySQL 8.0.13.
+func (db *Mysql) TableDependents(sess *xorm.Session, tableName string) ([]string, error) {
+	quote := db.Quote
+	sql := "SELECT " + quote("TABLE_NAME") + " AS name FROM " + quote("INFORMATION_SCHEMA") + "." + quote("KEY_COLUMN_USAGE") +
+		" WHERE " + quote("REFERENCED_TABLE_SCHEMA") + " = DATABASE() AND " + quote("REFERENCED_TABLE_NAME") + "=? AND " + quote("TABLE_NAME") + " <> ?" +
+		" UNION SELECT " + quote("TABLE_NAME") + " AS name FROM " + quote("INFORMATION_SCHEMA") + "." + quote("VIEWS") +
+		" WHERE " + quote("TABLE_SCHEMA") + " = DATABASE() AND " + quote("VIEW_DEFINITION") + " LIKE ? " + db.LikeEscapeStr() +
+		" ORDER BY name"
+	pattern := "%" + db.EscapeLike("`"+strings.Replace(tableName, "`", "``", -1)+"`") + "%"
+	return tableNames(sess, sql, tableName, tableName, pattern)
+}
+
+// ReorderColumns moves the columns with MODIFY ... FIRST and AFTER, taking
+// their definitions from SHOW CREATE TABLE. MySQL copies the table to change
+// the order.
+func (db *Mysql) ReorderColumns(sess *xorm.Session, tableName string, columns []string) error {
+	results, err := sess.Query("SHOW CREATE TABLE " + db.Quote(tableName))
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	names, defs := mysqlColumnDefs(string(results[0]["Create Table"]))
+	order, changed, err := columnOrder(tableName, names, columns)
+	if err != nil || !changed {
+		return err
+	}
+
+	clauses := make([]string, len(order))
+	for i, name := range order {
+		position := " FIRST"
+		if i > 0 {
+			position = " AFTER " + db.Quote(order[i-1])
+		}
+		clauses[i] = "MODIFY " + defs[name] + position
+	}
+	_, err = sess.Exec("ALTER TABLE " + db.Quote(tableName) + " " + strings.Join(clauses, ", "))
+	return err
+}
+
+// mysqlColumnDefs returns the names and definitions of the columns of a SHOW
+// CREATE TABLE statement, which puts every column on its own line.
+func mysqlColumnDefs(create string) ([]string, map[string]string) {
+	names := []string{}
+	defs := map[string]string{}
+	for _, line := range strings.Split(create, "\n") {
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if !strings.HasPrefix(def, "`") && !strings.HasPrefix(def, `"`) {
+			continue
+		}
+		name := mysqlLeadingName(def)
+		names = append(names, name)
+		defs[name] = def
+	}
+	return names, defs
+}
+
+var mysqlIndexKeywords = []string{"KEY ", "UNIQUE KEY ", "FULLTEXT KEY ", "SPATIAL KEY "}
+
+// mysqlIndexDefs returns the names and definitions of the secondary indexes
+// of a SHOW CREATE TABLE statement.
+func mysqlIndexDefs(create string) ([]string, map[string]string) {
+	names := []string{}
+	defs := map[string]string{}
+	for _, line := range strings.Split(create, "\n") {
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		for _, keyword := range mysqlIndexKeywords {
+			if strings.HasPrefix(def, keyword+"`") || strings.HasPrefix(def, keyword+`"`) {
+				name := mysqlLeadingName(def[len(keyword):])
+				names = append(names, name)
+				defs[name] = def
+				break
+			}
+		}
+	}
+	return names, defs
+}
+
+// mysqlLeadingName returns the quoted name def starts with. SHOW CREATE TABLE
+// quotes names with double quotes rather than backticks if the session runs
+// with the ANSI_QUOTES SQL mode.
+func mysqlLeadingName(def string) string {
+	quote := def[0]
+	end := 1
+	for end < len(def) {
+		if def[end] == quote {
+			if end+1 < len(def) && def[end+1] == quote {
+				end += 2
+				continue
+			}
+			break
+		}
+		end++
+	}
+	return strings.Replace(def[1:end], string(quote)+string(quote), string(quote), -1)
+}
+
+// IndexDefinitions takes the definitions from SHOW CREATE TABLE. Unique
+// constraints are unique indexes on MySQL and are included. An index a foreign
+// key needs can't be dropped.
+func (db *Mysql) IndexDefinitions(sess *xorm.Session, tableName string) ([]*IndexDefinition, error) {
+	results, err := sess.Query("SHOW CREATE TABLE " + db.Quote(tableName))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	names, defs := mysqlIndexDefs(string(results[0]["Create Table"]))
+	definitions := make([]*IndexDefinition, len(names))
+	for i, name := range names {
+		definitions[i] = &IndexDefinition{
+			Name:      name,
+			CreateSql: "ALTER TABLE " + db.Quote(tableName) + " ADD " + defs[name],
+			DropSql:   "ALTER TABLE " + db.Quote(tableName) + " DROP INDEX " + db.Quote(name),
+		}
+	}
+	return definitions, nil
+}
+
+// ForeignKeyChecksSql sets FOREIGN_KEY_CHECKS, which MySQL keeps for the
+// connection until it is set again. Rows written without the checks are not
+// checked later.
+func (db *Mysql) ForeignKeyChecksSql(enabled bool) string {
+	if enabled {
+		return "SET FOREIGN_KEY_CHECKS=1"
+	}
+	return "SET FOREIGN_KEY_CHECKS=0"
+}
+
+// SetLockTimeout sets both innodb_lock_wait_timeout, for row locks, and
+// lock_wait_timeout, for the metadata locks DDL waits for. Both are in whole
+// seconds, at least one, and kept for the connection until set again.
+func (db *Mysql) SetLockTimeout(sess *xorm.Session, timeout time.Duration) (string, error) {
+	results, err := sess.Query("SELECT @@SESSION.innodb_lock_wait_timeout AS innodb_lock_wait_timeout, @@SESSION.lock_wait_timeout AS lock_wait_timeout")
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("lock wait timeouts not found")
+	}
+
+	seconds := strconv.FormatInt(mysqlLockTimeoutSeconds(timeout), 10)
+	if _, err := sess.Exec(mysqlLockTimeoutSql(seconds, seconds)); err != nil {
+		return "", err
+	}
+	return mysqlLockTimeoutSql(string(results[0]["innodb_lock_wait_timeout"]), string(results[0]["lock_wait_timeout"])), nil
+}
+
+// mysqlLockTimeoutSeconds rounds the timeout up to whole seconds.
+func mysqlLockTimeoutSeconds(timeout time.Duration) int64 {
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+func mysqlLockTimeoutSql(innodbLockWaitTimeout string, lockWaitTimeout string) string {
+	return fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %s, lock_wait_timeout = %s", innodbLockWaitTimeout, lockWaitTimeout)
+}
+
+// SupportsTransactionalDDL is false, MySQL commits the transaction before and
+// after DDL statements, which also releases its savepoints.
+func (db *Mysql) SupportsTransactionalDDL() bool {
+	return false
+}
+
+// mysqlBulkLoads numbers the readers registered with the driver for BulkLoad.
+var mysqlBulkLoads int64
+
+// mysqlClientLocalFilesDisabled is ER_CLIENT_LOCAL_FILES_DISABLED of MySQL 8,
+// which the vendored error list predates.
+const mysqlClientLocalFilesDisabled = 3948
+
+// BulkLoad streams the rows with LOAD DATA LOCAL INFILE, falling back to
+// batched inserts when the server has local_infile disabled.
+func (db *Mysql) BulkLoad(sess *xorm.Session, tableName string, data *DelimitedData, r io.Reader) (int64, error) {
+	if len(data.Columns) == 0 {
+		return 0, fmt.Errorf("bulk load into %s needs the columns of the rows", tableName)
+	}
+
+	name := fmt.Sprintf("migrator_bulk_load_%d", atomic.AddInt64(&mysqlBulkLoads, 1))
+	read := false
+	mysql.RegisterReaderHandler(name, func() io.Reader {
+		read = true
+		return r
+	})
+	defer mysql.DeregisterReaderHandler(name)
+
+	// values are read into variables to turn the Null marker into NULL
+	vars := make([]string, len(data.Columns))
+	set := make([]string, len(data.Columns))
+	for i, col := range data.Columns {
+		vars[i] = fmt.Sprintf("@c%d", i)
+		set[i] = fmt.Sprintf("%s = NULLIF(%s, %s)", db.Quote(col), vars[i], mysqlStringLiteral(data.null()))
+	}
+	ignore := ""
+	if data.Header {
+		ignore = " IGNORE 1 LINES"
+	}
+
+	sql := fmt.Sprintf("LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4 FIELDS TERMINATED BY %s OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '' LINES TERMINATED BY '\\n'%s (%s) SET %s",
+		name, db.Quote(tableName), mysqlStringLiteral(string(data.comma())), ignore, strings.Join(vars, ", "), strings.Join(set, ", "))
+	result, err := sess.Exec(sql)
+	if err != nil {
+		if driverErr, ok := err.(*mysql.MySQLError); ok && !read &&
+			(driverErr.Number == mysqlerr.ER_NOT_ALLOWED_COMMAND || driverErr.Number == mysqlClientLocalFilesDisabled) {
+			return db.BaseDialect.BulkLoad(sess, tableName, data, r)
+		}
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// mysqlStringLiteral quotes s as a string literal, escaping backslashes as
+// MySQL does unless NO_BACKSLASH_ESCAPES is set.
+func mysqlStringLiteral(s string) string {
+	return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", "''", -1) + "'"
+}
+
+// DropConstraint looks up the type of the constraint since MySQL has a
+// separate DROP syntax for each kind of constraint.
+func (db *Mysql) DropConstraint(sess *xorm.Session, tableName string, constraintName string) error {
+	constraintType, err := db.constraintType(sess, tableName, constraintName)
+	if err != nil {
+		return err
+	}
+
+	var drop string
+	switch constraintType {
+	case "PRIMARY KEY":
+		drop = "DROP PRIMARY KEY"
+	case "UNIQUE":
+		drop = "DROP INDEX " + db.Quote(constraintName)
+	case "FOREIGN KEY":
+		drop = "DROP FOREIGN KEY " + db.Quote(constraintName)
+	case "CHECK":
+		drop = "DROP CHECK " + db.Quote(constraintName)
+	default:
+		return fmt.Errorf("unsupported constraint type %s for constraint %s", constraintType, constraintName)
+	}
+
+	_, err = sess.Exec("ALTER TABLE " + db.Quote(tableName) + " " + drop)
+	return err
+}
+
+// RenameConstraint looks up the definition of the constraint, MySQL can only
+// rename indexes so other constraints are dropped and added again under the
+// new name. The name of a primary key is always PRIMARY.
+func (db *Mysql) RenameConstraint(sess *xorm.Session, tableName string, oldName string, newName string) error {
+	constraintType, err := db.constraintType(sess, tableName, oldName)
+	if err != nil {
+		return err
+	}
+
+	alter := "ALTER TABLE " + db.Quote(tableName) + " "
+	switch constraintType {
+	case "UNIQUE":
+		alter += "RENAME INDEX " + db.Quote(oldName) + " TO " + db.Quote(newName)
+	case "FOREIGN KEY":
+		fk, err := db.loadForeignKey(sess, tableName, oldName)
+		if err != nil {
+			return err
+		}
+		fk.Name = newName
+		def, err := db.foreignKeyDef(tableName, fk)
+		if err != nil {
+			return err
+		}
+		alter += "DROP FOREIGN KEY " + db.Quote(oldName) + ", ADD " + def
+	case "CHECK":
+		sql := "SELECT " + db.Quote("CHECK_CLAUSE") + " AS check_clause FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("CHECK_CONSTRAINTS") + " WHERE " + db.Quote("CONSTRAINT_SCHEMA") + " = DATABASE() AND " + db.Quote("CONSTRAINT_NAME") + "=?"
+		results, err := sess.SQL(sql, oldName).Query()
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("check constraint %s not found on table %s", oldName, tableName)
+		}
+		alter += "DROP CHECK " + db.Quote(oldName) + ", ADD CONSTRAINT " + db.Quote(newName) + " CHECK (" + string(results[0]["check_clause"]) + ")"
+	default:
+		return fmt.Errorf("unable to rename constraint %s of type %s", oldName, constraintType)
+	}
+
+	_, err = sess.Exec(alter)
+	return err
+}
+
+func (db *Mysql) constraintType(sess *xorm.Session, tableName string, constraintName string) (string, error) {
+	sql := "SELECT " + db.Quote("CONSTRAINT_TYPE") + " AS constraint_type FROM " + db.Quote("INFORMATION_SCHEMA") + "." + db.Quote("TABLE_CONSTRAINTS") + " WHERE " + db.Quote("TABLE_SCHEMA") + " = DATABASE() AND " + db.Quote("TABLE_NAME") + "=? AND " + db.Quote("CONSTRAINT_NAME") + "=?"
+	results, err := sess.SQL(sql, tableName, constraintName).Query()
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("constraint %s not found on table %s", constraintName, tableName)
+	}
+	return string(results[0]["constraint_type"]), nil
+}
+
+func (db *Mysql) loadForeignKey(sess *xorm.Session, tableName string, name string) (*ForeignKey, error) {
+	quote := db.Quote
+	sql := "SELECT k." + quote("COLUMN_NAME") + " AS column_name, k." + quote("REFERENCED_TABLE_NAME") + " AS ref_table, k." + quote("REFERENCED_COLUMN_NAME") + " AS ref_column, r." + quote("DELETE_RULE") + " AS delete_rule, r." + quote("UPDATE_RULE") + " AS update_rule" +
+		" FROM " + quote("INFORMATION_SCHEMA") + "." + quote("KEY_COLUMN_USAGE") + " k JOIN " + quote("INFORMATION_SCHEMA") + "." + quote("REFERENTIAL_CONSTRAINTS") + " r" +
+		" ON r." + quote("CONSTRAINT_SCHEMA") + " = k." + quote("CONSTRAINT_SCHEMA") + " AND r." + quote("CONSTRAINT_NAME") + " = k." + quote("CONSTRAINT_NAME") +
+		" WHERE k." + quote("TABLE_SCHEMA") + " = DATABASE() AND k." + quote("TABLE_NAME") + "=? AND k." + quote("CONSTRAINT_NAME") + "=?" +
+		" ORDER BY k." + quote("ORDINAL_POSITION")
+	results, err := sess.SQL(sql, tableName, name).Query()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("foreign key %s not found on table %s", name, tableName)
+	}
+
+	fk := &ForeignKey{Name: name, RefTable: string(results[0]["ref_table"])}
+	// RESTRICT and NO ACTION are the same in InnoDB and the default
+	if rule := string(results[0]["delete_rule"]); rule != "RESTRICT" && rule != "NO ACTION" {
+		fk.OnDelete = rule
+	}
+	if rule := string(results[0]["update_rule"]); rule != "RESTRICT" && rule != "NO ACTION" {
+		fk.OnUpdate = rule
+	}
+	for _, row := range results {
+		fk.Cols = append(fk.Cols, string(row["column_name"]))
+		fk.RefCols = append(fk.RefCols, string(row["ref_column"]))
+	}
+	return fk, nil
+}
+
 func (db *Mysql) CleanDB() error {
 	tables, _ := db.engine.DBMetas()
 	sess := db.engine.NewSession()
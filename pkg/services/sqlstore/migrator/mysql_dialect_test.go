@@ -0,0 +1,203 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMysqlVarcharWidenedInplace(t *testing.T) {
+	Convey("Widening a VARCHAR in place on MySQL", t, func() {
+		for _, tc := range []struct {
+			name      string
+			current   *Column
+			charset   string
+			collation string
+			col       *Column
+			inplace   bool
+		}{
+			{
+				name:    "longer within one byte length prefix",
+				current: &Column{Type: DB_Varchar, Length: 20},
+				col:     &Column{Type: DB_NVarchar, Length: 63},
+				inplace: true,
+			},
+			{
+				name:    "longer within two byte length prefix",
+				current: &Column{Type: DB_Varchar, Length: 190},
+				col:     &Column{Type: DB_NVarchar, Length: 255},
+				inplace: true,
+			},
+			{
+				name:    "same length",
+				current: &Column{Type: DB_Varchar, Length: 255},
+				col:     &Column{Type: DB_Varchar, Length: 255},
+				inplace: true,
+			},
+			{
+				name:    "crossing 255 bytes",
+				current: &Column{Type: DB_Varchar, Length: 63},
+				col:     &Column{Type: DB_NVarchar, Length: 64},
+			},
+			{
+				name:    "shorter",
+				current: &Column{Type: DB_Varchar, Length: 255},
+				col:     &Column{Type: DB_NVarchar, Length: 190},
+			},
+			{
+				name:    "nullability changes",
+				current: &Column{Type: DB_Varchar, Length: 100, Nullable: true},
+				col:     &Column{Type: DB_NVarchar, Length: 200},
+			},
+			{
+				name:    "type changes",
+				current: &Column{Type: DB_Char, Length: 100},
+				col:     &Column{Type: DB_NVarchar, Length: 200},
+			},
+			{
+				name:      "charset changes",
+				current:   &Column{Type: DB_Varchar, Length: 100},
+				charset:   "utf8",
+				collation: "utf8_general_ci",
+				col:       &Column{Type: DB_NVarchar, Length: 200},
+			},
+		} {
+			charset, collation := tc.charset, tc.collation
+			if charset == "" {
+				charset, collation = "utf8mb4", "utf8mb4_unicode_ci"
+			}
+			Convey(tc.name, func() {
+				So(mysqlVarcharWidenedInplace(tc.current, charset, collation, tc.col), ShouldEqual, tc.inplace)
+			})
+		}
+	})
+}
+
+func TestMysqlWidenVarcharOnlineDDL(t *testing.T) {
+	Convey("Online DDL hints for widening a VARCHAR on MySQL", t, func() {
+		dialect := NewMysqlDialect(nil)
+		col := &Column{Name: "title", Type: DB_NVarchar, Length: 255}
+
+		Convey("allow in place widening", func() {
+			clause, err := dialect.OnlineDDLSql(DDLWidenVarchar, col, &OnlineDDL{Algorithm: AlgorithmInplace, Lock: LockNone})
+			So(err, ShouldBeNil)
+			So(clause, ShouldEqual, ", ALGORITHM=INPLACE, LOCK=NONE")
+		})
+
+		Convey("reject in place modification of the column type", func() {
+			_, err := dialect.OnlineDDLSql(DDLModifyColumn, col, &OnlineDDL{Algorithm: AlgorithmInplace})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMysqlColumnDefs(t *testing.T) {
+	Convey("Parsing SHOW CREATE TABLE on MySQL", t, func() {
+		Convey("finds column definitions", func() {
+			create := "CREATE TABLE `dashboard` (\n" +
+				"  `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+				"  `we``ird` varchar(40) DEFAULT 'a,b',\n" +
+				"  `title` varchar(255) NOT NULL COMMENT 'shown in lists',\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  KEY `IDX_dashboard_title` (`title`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+			names, defs := mysqlColumnDefs(create)
+			So(names, ShouldResemble, []string{"id", "we`ird", "title"})
+			So(defs["we`ird"], ShouldEqual, "`we``ird` varchar(40) DEFAULT 'a,b'")
+			So(defs["title"], ShouldEqual, "`title` varchar(255) NOT NULL COMMENT 'shown in lists'")
+		})
+	})
+}
+
+func TestMysqlIndexDefs(t *testing.T) {
+	Convey("Parsing SHOW CREATE TABLE on MySQL", t, func() {
+		Convey("finds index definitions", func() {
+			create := "CREATE TABLE `dashboard` (\n" +
+				"  `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+				"  `org_id` bigint NOT NULL,\n" +
+				"  `title` varchar(255) NOT NULL,\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  UNIQUE KEY `UQE_dashboard_org_id_title` (`org_id`,`title`),\n" +
+				"  KEY `IDX_dashboard_title` (`title`(100) DESC),\n" +
+				"  FULLTEXT KEY `ft_title` (`title`),\n" +
+				"  CONSTRAINT `fk_org` FOREIGN KEY (`org_id`) REFERENCES `org` (`id`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+			names, defs := mysqlIndexDefs(create)
+			So(names, ShouldResemble, []string{"UQE_dashboard_org_id_title", "IDX_dashboard_title", "ft_title"})
+			So(defs["IDX_dashboard_title"], ShouldEqual, "KEY `IDX_dashboard_title` (`title`(100) DESC)")
+		})
+	})
+}
+
+func TestMysqlDefsWithAnsiQuotes(t *testing.T) {
+	Convey("Parsing SHOW CREATE TABLE on MySQL", t, func() {
+		Convey("handles ANSI_QUOTES", func() {
+			create := `CREATE TABLE "dashboard" (` + "\n" +
+				`  "id" bigint NOT NULL AUTO_INCREMENT,` + "\n" +
+				`  "say ""hi""" varchar(40) DEFAULT NULL,` + "\n" +
+				`  PRIMARY KEY ("id"),` + "\n" +
+				`  KEY "IDX_dashboard_say" ("say ""hi""")` + "\n" +
+				`)`
+
+			names, defs := mysqlColumnDefs(create)
+			So(names, ShouldResemble, []string{"id", `say "hi"`})
+			So(defs[`say "hi"`], ShouldEqual, `"say ""hi""" varchar(40) DEFAULT NULL`)
+
+			names, _ = mysqlIndexDefs(create)
+			So(names, ShouldResemble, []string{"IDX_dashboard_say"})
+		})
+	})
+}
+
+func TestMysqlLegacyIntegerColumns(t *testing.T) {
+	Convey("Integer display widths on MySQL", t, func() {
+		dialect := NewMysqlDialect(nil)
+		for _, tc := range []struct {
+			col          *Column
+			sqlType      string
+			introspected string
+		}{
+			{&Column{Type: DB_Int, DisplayWidth: 11}, "INT(11)", "int(11)"},
+			{&Column{Type: DB_Int, DisplayWidth: 10, Zerofill: true}, "INT(10) UNSIGNED ZEROFILL", "int(10) unsigned zerofill"},
+			{&Column{Type: DB_BigInt, Zerofill: true}, "BIGINT(20) UNSIGNED ZEROFILL", "bigint unsigned zerofill"},
+			{&Column{Type: DB_Decimal, Length: 10, Length2: 2, DisplayWidth: 11, Zerofill: true}, "DECIMAL(10,2)", "decimal(10,2)"},
+		} {
+			sqlType := dialect.SqlType(tc.col)
+			So(sqlType, ShouldEqual, tc.sqlType)
+			So(dialect.TypesEquivalent(sqlType, tc.introspected), ShouldBeTrue)
+		}
+
+		Convey("are ignored on Postgres", func() {
+			So(NewPostgresDialect(nil).SqlType(&Column{Type: DB_Int, DisplayWidth: 11, Zerofill: true}), ShouldEqual, DB_Integer)
+		})
+	})
+}
+
+func TestMysqlOrphanedRowsCondition(t *testing.T) {
+	Convey("Finding orphaned rows on MySQL", t, func() {
+		dialect := NewMysqlDialect(nil)
+		parent := &ForeignKey{Cols: []string{"parent_id"}, RefTable: "folder", RefCols: []string{"id"}}
+
+		Convey("reads self references through a derived table", func() {
+			So(dialect.OrphanedRowsCondition("folder", parent), ShouldContainSubstring, "FROM (SELECT DISTINCT `id` FROM `folder`) `fk_ref`")
+
+			// SQLite accepts the backticks, so the condition can be checked on it
+			x := newSqliteTestEngine(t)
+			execTestSql(x,
+				"CREATE TABLE folder (id INTEGER PRIMARY KEY, parent_id INTEGER)",
+				"INSERT INTO folder (id, parent_id) VALUES (1, NULL), (2, 1), (3, 7)",
+				"DELETE FROM `folder` WHERE "+dialect.OrphanedRowsCondition("folder", parent),
+			)
+			count, err := x.Table("folder").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("reads other tables directly", func() {
+			org := &ForeignKey{Cols: []string{"org_id"}, RefTable: "org", RefCols: []string{"id"}}
+			So(dialect.OrphanedRowsCondition("folder", org), ShouldContainSubstring, "FROM `org` `fk_ref`")
+		})
+	})
+}
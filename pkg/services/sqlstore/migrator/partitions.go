@@ -0,0 +1,39 @@
+package migrator
+
+import "fmt"
+
+// AddPartitionMigration adds a partition to a table created with
+// AddTableMigration.PartitionBy. Postgres creates the partition as a table of
+// its own, MySQL adds it to the table. SQLite has no partitioning and fails
+// validation.
+type AddPartitionMigration struct {
+	MigrationBase
+	tableName     string
+	partitionName string
+	bound         PartitionBound
+}
+
+func NewAddPartitionMigration(tableName string, partitionName string, bound PartitionBound) *AddPartitionMigration {
+	return &AddPartitionMigration{tableName: tableName, partitionName: partitionName, bound: bound}
+}
+
+func (m *AddPartitionMigration) Validate(mg *Migrator) error {
+	if len(m.bound.In) == 0 && m.bound.To == "" {
+		return fmt.Errorf("partition %s of %s needs an upper bound or a list of values", m.partitionName, m.tableName)
+	}
+	if len(m.bound.In) == 0 && m.bound.From == "" && mg.Dialect.DriverName() == POSTGRES {
+		return fmt.Errorf("partition %s of %s needs a lower bound, use MINVALUE for an open range", m.partitionName, m.tableName)
+	}
+
+	_, err := mg.Dialect.AddPartitionSql(m.tableName, m.partitionName, &m.bound)
+	return err
+}
+
+func (m *AddPartitionMigration) Sql(dialect Dialect) string {
+	sql, _ := dialect.AddPartitionSql(m.tableName, m.partitionName, &m.bound)
+	return sql
+}
+
+func (m *AddPartitionMigration) String() string {
+	return fmt.Sprintf("AddPartition %s OF %s", m.partitionName, m.tableName)
+}
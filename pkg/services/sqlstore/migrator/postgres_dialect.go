@@ -2,8 +2,10 @@ package migrator
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-xorm/xorm"
 	"github.com/lib/pq"
@@ -11,6 +13,7 @@ import (
 
 type Postgres struct {
 	BaseDialect
+	serverVersion int
 }
 
 func NewPostgresDialect(engine *xorm.Engine) *Postgres {
@@ -41,6 +44,109 @@ func (db *Postgres) BooleanStr(value bool) string {
 	return strconv.FormatBool(value)
 }
 
+// postgresTypeSynonyms maps type names and aliases to one name per type,
+// including the long names information_schema and format_type report.
+var postgresTypeSynonyms = map[string]string{
+	"INT":                         DB_Integer,
+	"INT4":                        DB_Integer,
+	DB_Serial:                     DB_Integer,
+	"SERIAL4":                     DB_Integer,
+	"INT8":                        DB_BigInt,
+	DB_BigSerial:                  DB_BigInt,
+	"SERIAL8":                     DB_BigInt,
+	"INT2":                        DB_SmallInt,
+	"SMALLSERIAL":                 DB_SmallInt,
+	"SERIAL2":                     DB_SmallInt,
+	"BOOL":                        "BOOLEAN",
+	"CHARACTER VARYING":           DB_Varchar,
+	"CHARACTER":                   DB_Char,
+	"BPCHAR":                      DB_Char,
+	"TIMESTAMP WITHOUT TIME ZONE": DB_TimeStamp,
+	"TIMESTAMP WITH TIME ZONE":    "TIMESTAMPTZ",
+	"TIME WITHOUT TIME ZONE":      DB_Time,
+	"TIME WITH TIME ZONE":         "TIMETZ",
+	"FLOAT4":                      DB_Real,
+	"FLOAT8":                      "DOUBLE PRECISION",
+	DB_Float:                      "DOUBLE PRECISION",
+	DB_Decimal:                    DB_Numeric,
+}
+
+func (db *Postgres) TypesEquivalent(declared string, introspected string) bool {
+	return canonicalType(declared, postgresTypeSynonyms) == canonicalType(introspected, postgresTypeSynonyms)
+}
+
+// BinaryStr decodes hex rather than using an escaped string literal, which
+// would depend on standard_conforming_strings.
+func (db *Postgres) BinaryStr(value []byte) string {
+	return fmt.Sprintf("decode('%X', 'hex')", value)
+}
+
+// OutOfRangeExpr checks the ranges of the types SqlType maps TINYINT and
+// MEDIUMINT to.
+func (db *Postgres) OutOfRangeExpr(col *Column) string {
+	switch col.Type {
+	case DB_TinyInt, DB_MediumInt:
+		mapped := *col
+		mapped.Type = DB_SmallInt
+		if col.Type == DB_MediumInt {
+			mapped.Type = DB_Int
+		}
+		return db.BaseDialect.OutOfRangeExpr(&mapped)
+	}
+	return db.BaseDialect.OutOfRangeExpr(col)
+}
+
+// JsonObjectExpr builds a jsonb object, which is cast to text or json when
+// assigned to columns of those types.
+func (db *Postgres) JsonObjectExpr(keys []string, values []string) string {
+	return "jsonb_build_object(" + jsonObjectArgs(keys, values) + ")"
+}
+
+// JsonExtractTextExpr casts expr to jsonb, so it works on text, json and
+// jsonb columns alike.
+func (db *Postgres) JsonExtractTextExpr(expr string, path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = ", '" + strings.Replace(key, "'", "''", -1) + "'"
+	}
+	return "jsonb_extract_path_text((" + expr + ")::jsonb" + strings.Join(keys, "") + ")"
+}
+
+func (db *Postgres) JsonExtractExpr(expr string, path []string) string {
+	return "((" + expr + ")::jsonb #> " + postgresTextArray(path) + ")"
+}
+
+func (db *Postgres) JsonValueExpr(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'::jsonb"
+}
+
+func (db *Postgres) JsonSetExpr(expr string, path []string, value string) string {
+	return "jsonb_set((" + expr + ")::jsonb, " + postgresTextArray(path) + ", " + value + ")"
+}
+
+func (db *Postgres) JsonRemoveExpr(expr string, path []string) string {
+	return "((" + expr + ")::jsonb #- " + postgresTextArray(path) + ")"
+}
+
+func postgresTextArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.Replace(value, "'", "''", -1) + "'"
+	}
+	return "ARRAY[" + strings.Join(quoted, ", ") + "]::text[]"
+}
+
+// SetSchemaSql uses SET LOCAL so the search path is reset when the
+// transaction ends and pooled connections are left untouched.
+func (db *Postgres) SetSchemaSql(schema string) (string, error) {
+	return "SET LOCAL search_path TO " + db.Quote(schema), nil
+}
+
+// ZeroDateTimeExpr returns expr unchanged since Postgres rejects zero dates.
+func (db *Postgres) ZeroDateTimeExpr(expr string, replacement string) string {
+	return expr
+}
+
 func (b *Postgres) Default(col *Column) string {
 	if col.Type == DB_Bool {
 		if col.Default == "0" {
@@ -101,18 +207,542 @@ func (db *Postgres) SqlType(c *Column) string {
 	return res
 }
 
+// TableLoggedSql turns write-ahead logging of a table off or on again, which
+// needs Postgres 9.5. Setting a table LOGGED writes all of its rows to the
+// log.
+func (db *Postgres) TableLoggedSql(tableName string, logged bool) (string, error) {
+	logging := "UNLOGGED"
+	if logged {
+		logging = "LOGGED"
+	}
+	return fmt.Sprintf("ALTER TABLE %s SET %s", db.Quote(tableName), logging), nil
+}
+
+// ClusterTableSql also marks the index as the one to cluster on, so a later
+// CLUSTER of the table without an index uses it again.
+func (db *Postgres) ClusterTableSql(tableName string, index *Index) (string, error) {
+	return fmt.Sprintf("CLUSTER %s USING %s", db.Quote(tableName), db.Quote(index.XName(tableName))), nil
+}
+
+// MaxColumns is the limit of Postgres, rows are not limited since long
+// values are moved to the TOAST table.
+func (db *Postgres) MaxColumns() int {
+	return 1600
+}
+
+// MaxIndexColumns is the INDEX_MAX_KEYS compile time default.
+func (db *Postgres) MaxIndexColumns() int {
+	return 32
+}
+
+func (db *Postgres) CreateTableSql(table *Table) string {
+	sql := db.BaseDialect.CreateTableSql(table)
+	if len(table.StorageParams) > 0 {
+		sql = strings.TrimSuffix(sql, ";") + storageParamsStr(table.StorageParams) + ";"
+	}
+	return sql
+}
+
+// CreateIndexSql leaves out NULLS NOT DISTINCT before Postgres 15, the index
+// migrations fail validation instead.
+func (db *Postgres) CreateIndexSql(tableName string, index *Index) string {
+	sql := db.BaseDialect.CreateIndexSql(tableName, index)
+	if index.NullsNotDistinct && index.Type == UniqueIndex {
+		if clause, err := db.NullsNotDistinctStr(); err == nil {
+			sql = strings.TrimSuffix(sql, ";") + clause + ";"
+		}
+	}
+	if len(index.StorageParams) > 0 {
+		sql = strings.TrimSuffix(sql, ";") + storageParamsStr(index.StorageParams) + ";"
+	}
+	return sql
+}
+
+func (db *Postgres) PartitionByStr(expr string) (string, error) {
+	return " PARTITION BY " + expr, nil
+}
+
+// AddPartitionSql creates the partition as a table, the primary key and
+// unique indexes of the parent table have to include the partition key.
+func (db *Postgres) AddPartitionSql(tableName string, partitionName string, bound *PartitionBound) (string, error) {
+	values := fmt.Sprintf("FROM (%s) TO (%s)", bound.From, bound.To)
+	if len(bound.In) > 0 {
+		values = fmt.Sprintf("IN (%s)", strings.Join(bound.In, ", "))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES %s", db.Quote(partitionName), db.Quote(tableName), values), nil
+}
+
+func (db *Postgres) NullsNotDistinctStr() (string, error) {
+	version, err := db.serverVersionNum()
+	if err != nil {
+		return "", err
+	}
+	if version < 150000 {
+		return "", fmt.Errorf("nulls not distinct: not supported by postgres %d, needs 15", version/10000)
+	}
+	return " NULLS NOT DISTINCT", nil
+}
+
+// serverVersionNum returns the server version as e.g. 150002 for 15.2.
+func (db *Postgres) serverVersionNum() (int, error) {
+	if db.serverVersion != 0 {
+		return db.serverVersion, nil
+	}
+
+	results, err := db.engine.SQL("SHOW server_version_num").Query()
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, fmt.Errorf("unable to read the server version")
+	}
+	version, err := strconv.Atoi(string(results[0]["server_version_num"]))
+	if err != nil {
+		return 0, err
+	}
+	db.serverVersion = version
+	return version, nil
+}
+
+func storageParamsStr(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+params[key])
+	}
+	return " WITH (" + strings.Join(pairs, ", ") + ")"
+}
+
+func (db *Postgres) CreateMaterializedViewSql(viewName string, sql string) (string, error) {
+	return fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS %s", db.Quote(viewName), sql), nil
+}
+
+func (db *Postgres) RefreshMaterializedViewSql(viewName string, concurrently bool) (string, error) {
+	if concurrently {
+		return fmt.Sprintf("REFRESH MATERIALIZED VIEW CONCURRENTLY %s", db.Quote(viewName)), nil
+	}
+	return fmt.Sprintf("REFRESH MATERIALIZED VIEW %s", db.Quote(viewName)), nil
+}
+
+func (db *Postgres) DropMaterializedViewSql(viewName string, ifExists bool, cascade bool) (string, error) {
+	return dropObjectSql("MATERIALIZED VIEW", db.Quote(viewName), ifExists, cascade), nil
+}
+
+func (db *Postgres) DropViewSql(viewName string, ifExists bool, cascade bool) string {
+	return dropObjectSql("VIEW", db.Quote(viewName), ifExists, cascade)
+}
+
+// ViewDefinitionSql covers both plain and materialized views.
+func (db *Postgres) ViewDefinitionSql(viewName string) (string, []interface{}) {
+	args := []interface{}{viewName, viewName}
+	sql := "SELECT " + db.Quote("definition") + " FROM " + db.Quote("pg_views") + " WHERE " + db.Quote("schemaname") + " = current_schema() AND " + db.Quote("viewname") + "=?" +
+		" UNION ALL SELECT " + db.Quote("definition") + " FROM " + db.Quote("pg_matviews") + " WHERE " + db.Quote("schemaname") + " = current_schema() AND " + db.Quote("matviewname") + "=?"
+	return sql, args
+}
+
+// TableSizeSql reads the row estimate of the planner, updated by VACUUM,
+// ANALYZE and CREATE INDEX, and 0 for tables never analyzed. The size
+// includes indexes and TOAST data. Indexes and sequences of the name are not
+// tables, materialized views are.
+func (db *Postgres) TableSizeSql(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	sql := "SELECT GREATEST(c.reltuples, 0)::bigint AS row_count, pg_total_relation_size(c.oid) AS byte_size" +
+		" FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.relname = ? AND n.nspname = current_schema()" +
+		" AND c.relkind IN ('r', 'p', 'm')"
+	return sql, args
+}
+
+// AddForeignKey adds the foreign key NOT VALID if asked to, which takes only
+// a brief lock as the existing rows are not checked.
+func (db *Postgres) AddForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error {
+	def, err := db.foreignKeyDef(tableName, fk)
+	if err != nil {
+		return err
+	}
+	_, err = sess.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s%s", db.Quote(tableName), def, notValidStr(fk.NotValid)))
+	return err
+}
+
+func (db *Postgres) AddCheckConstraint(sess *xorm.Session, tableName string, check *CheckConstraint) error {
+	_, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s%s", db.Quote(tableName), db.checkConstraintDef(check), notValidStr(check.NotValid)))
+	return err
+}
+
+// ReplacePrimaryKey turns the unique index into the primary key with ADD
+// CONSTRAINT ... USING INDEX, which renames the index rather than building
+// another one. The constraint keeps the name of the old primary key,
+// <table>_pkey if there is none. The index of a UNIQUE constraint can't be
+// used that way, the constraint is dropped and the primary key built.
+func (db *Postgres) ReplacePrimaryKey(sess *xorm.Session, tableName string, oldCols []string, index *Index) error {
+	constraints, err := db.ListConstraints(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	quote := db.Quote
+	pkName, uniqueConstraint := tableName+"_pkey", false
+	for _, constraint := range constraints {
+		switch {
+		case constraint.Type == ConstraintPrimaryKey:
+			pkName = constraint.Name
+		case constraint.Type == ConstraintUnique && constraint.Name == index.Name:
+			uniqueConstraint = true
+		}
+	}
+
+	changes := []string{}
+	if len(oldCols) > 0 {
+		changes = append(changes, "DROP CONSTRAINT "+quote(pkName))
+	}
+	if uniqueConstraint {
+		changes = append(changes, "DROP CONSTRAINT "+quote(index.Name), fmt.Sprintf("ADD CONSTRAINT %s PRIMARY KEY (%s)", quote(pkName), db.QuoteColList(index.Cols)))
+	} else {
+		changes = append(changes, fmt.Sprintf("ADD CONSTRAINT %s PRIMARY KEY USING INDEX %s", quote(pkName), quote(index.Name)))
+	}
+
+	// one statement each, the transaction of the migration keeps them together
+	for _, change := range changes {
+		if _, err := sess.Exec(fmt.Sprintf("ALTER TABLE %s %s", quote(tableName), change)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notValidStr(notValid bool) string {
+	if notValid {
+		return " NOT VALID"
+	}
+	return ""
+}
+
+// ForeignKeyChecksSql sets the session replication role of the transaction.
+// Postgres checks foreign keys with system triggers, as a replica it fires
+// neither those nor the triggers of the user, except ENABLE ALWAYS ones.
+// Setting the role needs superuser rights.
+func (db *Postgres) ForeignKeyChecksSql(enabled bool) string {
+	if enabled {
+		return "SET LOCAL session_replication_role = origin"
+	}
+	return "SET LOCAL session_replication_role = replica"
+}
+
+// SetLockTimeout sets lock_timeout for the transaction, in milliseconds. The
+// previous value is set again before the end of the migration, a rollback
+// discards the SET LOCAL anyway.
+func (db *Postgres) SetLockTimeout(sess *xorm.Session, timeout time.Duration) (string, error) {
+	results, err := sess.Query("SELECT current_setting('lock_timeout') AS lock_timeout")
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("lock_timeout not found")
+	}
+
+	milliseconds := int64((timeout + time.Millisecond - 1) / time.Millisecond)
+	if _, err := sess.Exec(postgresLockTimeoutSql(strconv.FormatInt(milliseconds, 10))); err != nil {
+		return "", err
+	}
+	return postgresLockTimeoutSql(string(results[0]["lock_timeout"])), nil
+}
+
+// postgresLockTimeoutSql sets lock_timeout to a value such as 500, which is in
+// milliseconds, or 2s as current_setting returns it.
+func postgresLockTimeoutSql(value string) string {
+	return "SET LOCAL lock_timeout = '" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+func (db *Postgres) ValidateConstraintSql(tableName string, constraintName string) string {
+	return fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", db.Quote(tableName), db.Quote(constraintName))
+}
+
+func (db *Postgres) AddExcludeConstraintSql(tableName string, constraint *ExcludeConstraint) (string, error) {
+	using := constraint.Using
+	if using == "" {
+		using = "gist"
+	}
+
+	elements := make([]string, 0, len(constraint.Elements))
+	for _, element := range constraint.Elements {
+		expr := "(" + element.Expr + ")"
+		if element.Column != "" {
+			expr = db.Quote(element.Column)
+		}
+		if element.OpClass != "" {
+			expr += " " + element.OpClass
+		}
+		elements = append(elements, expr+" WITH "+element.Operator)
+	}
+
+	sql := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s EXCLUDE USING %s (%s)", db.Quote(tableName), db.Quote(constraint.Name), using, strings.Join(elements, ", "))
+	if constraint.Where != "" {
+		sql += " WHERE (" + constraint.Where + ")"
+	}
+	return sql, nil
+}
+
+// CreateTriggerSql creates the trigger together with the plpgsql function it
+// executes. The function returns NEW, or OLD for delete triggers, after
+// running the body.
+func (db *Postgres) CreateTriggerSql(tableName string, trigger *Trigger, body string) []string {
+	row := "NEW"
+	if trigger.Event == TriggerDelete {
+		row = "OLD"
+	}
+
+	return []string{
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$\nBEGIN\n%s;\nRETURN %s;\nEND;\n$$ LANGUAGE plpgsql",
+			db.Quote(triggerFunctionName(trigger.Name)), strings.TrimSuffix(strings.TrimSpace(body), ";"), row),
+		fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW EXECUTE PROCEDURE %s()",
+			db.Quote(trigger.Name), trigger.Timing, trigger.Event, db.Quote(tableName), db.Quote(triggerFunctionName(trigger.Name))),
+	}
+}
+
+func (db *Postgres) IncrementOnUpdateTriggerSql(tableName string, triggerName string, columnName string) []string {
+	col := db.Quote(columnName)
+	trigger := &Trigger{Name: triggerName, Timing: TriggerBefore, Event: TriggerUpdate}
+	return db.CreateTriggerSql(tableName, trigger, fmt.Sprintf("NEW.%s := OLD.%s + 1", col, col))
+}
+
+func (db *Postgres) DropTriggerSql(tableName string, triggerName string) []string {
+	return []string{
+		fmt.Sprintf("DROP TRIGGER %s ON %s", db.Quote(triggerName), db.Quote(tableName)),
+		fmt.Sprintf("DROP FUNCTION %s()", db.Quote(triggerFunctionName(triggerName))),
+	}
+}
+
+func triggerFunctionName(triggerName string) string {
+	return triggerName + "_fn"
+}
+
+func (db *Postgres) SyncAutoIncrementSql(tableName string, col *Column) string {
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+		db.Quote(tableName), col.Name, db.Quote(col.Name), db.Quote(tableName))
+}
+
+// AutoIncrementStartSql sets the sequence of the column, which may also move
+// it back below existing ids.
+func (db *Postgres) AutoIncrementStartSql(tableName string, col *Column, value int64) []string {
+	return []string{fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), %d, false)", db.Quote(tableName), col.Name, value)}
+}
+
+func (db *Postgres) TableCheckSql(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	sql := "SELECT 1 FROM " + db.Quote("pg_tables") + " WHERE " + db.Quote("schemaname") + " = current_schema() AND " + db.Quote("tablename") + "=?"
+	return sql, args
+}
+
 func (db *Postgres) IndexCheckSql(tableName, indexName string) (string, []interface{}) {
 	args := []interface{}{tableName, indexName}
-	sql := "SELECT 1 FROM " + db.Quote("pg_indexes") + " WHERE" + db.Quote("tablename") + "=? AND " + db.Quote("indexname") + "=?"
+	sql := "SELECT 1 FROM " + db.Quote("pg_indexes") + " WHERE " + db.Quote("schemaname") + " = current_schema() AND " + db.Quote("tablename") + "=? AND " + db.Quote("indexname") + "=?"
 	return sql, args
 }
 
+// DeleteBatchSql selects the rows by ctid, Postgres has no DELETE ... LIMIT.
+func (db *Postgres) DeleteBatchSql(tableName string, where string, limit int64) string {
+	quoted := db.Quote(tableName)
+	return fmt.Sprintf("DELETE FROM %s WHERE ctid IN (SELECT ctid FROM %s WHERE %s%s)", quoted, quoted, where, db.Limit(limit))
+}
+
+func (db *Postgres) UpdateFromSql(tableName string, columnName string, sourceTable string, on string, expr string, where string) string {
+	sql := fmt.Sprintf("UPDATE %s SET %s = %s FROM %s WHERE (%s)", db.Quote(tableName), db.Quote(columnName), expr, db.Quote(sourceTable), on)
+	if where != "" {
+		sql += " AND (" + where + ")"
+	}
+	return sql
+}
+
+// ConstraintExistsSql looks the constraint up in pg_constraint, which unlike
+// the information schema also has exclusion constraints.
+func (db *Postgres) ConstraintExistsSql(tableName, constraintName string) (string, []interface{}) {
+	args := []interface{}{tableName, constraintName}
+	sql := "SELECT 1 FROM pg_constraint c JOIN pg_class t ON t.oid = c.conrelid JOIN pg_namespace n ON n.oid = t.relnamespace" +
+		" WHERE n.nspname = current_schema() AND t.relname = ? AND c.conname = ?"
+	return sql, args
+}
+
+func (db *Postgres) NullSafeEquals(a string, b string) string {
+	return a + " IS NOT DISTINCT FROM " + b
+}
+
+// DeleteDuplicatesSql numbers the rows of each key and deletes all but the
+// first by ctid, so the key column isn't needed.
+func (db *Postgres) DeleteDuplicatesSql(tableName string, index *Index, orderBy string, keyColumn string) string {
+	quote := db.Quote
+	if orderBy == "" {
+		orderBy = quote(keyColumn)
+	}
+
+	cols := db.QuoteColList(index.Cols)
+	numbered := fmt.Sprintf("SELECT ctid AS row_id, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS row_num FROM %s", cols, orderBy, quote(tableName))
+	if !index.NullsNotDistinct {
+		notNull := make([]string, len(index.Cols))
+		for i, col := range index.Cols {
+			notNull[i] = quote(col) + " IS NOT NULL"
+		}
+		numbered += " WHERE " + strings.Join(notNull, " AND ")
+	}
+	return fmt.Sprintf("DELETE FROM %s USING (%s) d WHERE %s.ctid = d.row_id AND d.row_num > 1", quote(tableName), numbered, quote(tableName))
+}
+
+// SupportsReturning is true, lib/pq doesn't support LastInsertId.
+func (db *Postgres) SupportsReturning() bool {
+	return true
+}
+
+// Placeholder returns $n, xorm rewrites ? on Postgres as well but numbered
+// parameters can be referenced more than once.
+func (db *Postgres) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (db *Postgres) ListTables(sess *xorm.Session) ([]string, error) {
+	return tableNames(sess, "SELECT tablename AS name FROM pg_tables WHERE schemaname = current_schema() ORDER BY tablename")
+}
+
+// DescribeTable reports serial columns, whose default is a sequence, as auto
+// increment columns without a default.
+func (db *Postgres) DescribeTable(sess *xorm.Session, tableName string) (*Table, error) {
+	sql := "SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS type, NOT a.attnotnull AS nullable, pg_get_expr(d.adbin, d.adrelid) AS dflt, i.indisprimary IS NOT NULL AS pk, col_description(c.oid, a.attnum) AS comment, obj_description(c.oid, 'pg_class') AS table_comment" +
+		" FROM pg_attribute a JOIN pg_class c ON c.oid = a.attrelid JOIN pg_namespace n ON n.oid = c.relnamespace" +
+		" LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum" +
+		" LEFT JOIN pg_index i ON i.indrelid = c.oid AND i.indisprimary AND a.attnum = ANY(i.indkey)" +
+		" WHERE c.relname = ? AND n.nspname = current_schema() AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum"
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	table := &Table{Name: tableName, Comment: string(results[0]["table_comment"])}
+	for _, row := range results {
+		col := &Column{
+			Name:         string(row["name"]),
+			Type:         string(row["type"]),
+			Nullable:     introspectedBool(row["nullable"]),
+			Default:      string(row["dflt"]),
+			IsPrimaryKey: introspectedBool(row["pk"]),
+			Comment:      string(row["comment"]),
+		}
+		if strings.HasPrefix(col.Default, "nextval(") {
+			col.IsAutoIncrement = true
+			col.Default = ""
+		}
+		if col.IsPrimaryKey {
+			table.PrimaryKeys = append(table.PrimaryKeys, col.Name)
+		}
+		table.Columns = append(table.Columns, col)
+	}
+	return table, nil
+}
+
+// ListIndexes skips expression columns of indexes, WITH ORDINALITY needs
+// Postgres 9.4.
+func (db *Postgres) ListIndexes(sess *xorm.Session, tableName string) ([]*Index, error) {
+	sql := "SELECT ic.relname AS index_name, ix.indisunique AS is_unique, a.attname AS column_name" +
+		" FROM pg_index ix JOIN pg_class t ON t.oid = ix.indrelid JOIN pg_class ic ON ic.oid = ix.indexrelid JOIN pg_namespace n ON n.oid = t.relnamespace" +
+		" JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, pos) ON true" +
+		" JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum" +
+		" WHERE t.relname = ? AND n.nspname = current_schema() AND NOT ix.indisprimary ORDER BY ic.relname, k.pos"
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	return collectIndexes(results), nil
+}
+
+// ListConstraints reads the constraints from pg_constraint. NOT NULL
+// constraints, which Postgres 18 keeps there too, are left out.
+func (db *Postgres) ListConstraints(sess *xorm.Session, tableName string) ([]*Constraint, error) {
+	sql := "SELECT c.conname AS name, CASE c.contype WHEN 'p' THEN 'PRIMARY KEY' WHEN 'u' THEN 'UNIQUE' WHEN 'f' THEN 'FOREIGN KEY' WHEN 'c' THEN 'CHECK' WHEN 'x' THEN 'EXCLUDE' END AS type," +
+		" a.attname AS column_name, r.relname AS ref_table, ra.attname AS ref_column" +
+		" FROM pg_constraint c JOIN pg_class t ON t.oid = c.conrelid JOIN pg_namespace n ON n.oid = t.relnamespace" +
+		" LEFT JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, pos) ON true" +
+		" LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum" +
+		" LEFT JOIN pg_class r ON r.oid = c.confrelid" +
+		" LEFT JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = c.confkey[k.pos]" +
+		" WHERE t.relname = ? AND n.nspname = current_schema() AND c.contype IN ('p', 'u', 'f', 'c', 'x') ORDER BY c.conname, k.pos"
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	return collectConstraints(results), nil
+}
+
+func (db *Postgres) IndexDefinitions(sess *xorm.Session, tableName string) ([]*IndexDefinition, error) {
+	sql := "SELECT ic.relname AS name, pg_get_indexdef(ix.indexrelid) AS definition" +
+		" FROM pg_index ix JOIN pg_class t ON t.oid = ix.indrelid JOIN pg_class ic ON ic.oid = ix.indexrelid JOIN pg_namespace n ON n.oid = t.relnamespace" +
+		" WHERE t.relname = ? AND n.nspname = current_schema() AND NOT ix.indisprimary" +
+		" AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid) ORDER BY ic.relname"
+	results, err := sess.SQL(sql, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make([]*IndexDefinition, len(results))
+	for i, row := range results {
+		name := string(row["name"])
+		definitions[i] = &IndexDefinition{Name: name, CreateSql: string(row["definition"]), DropSql: "DROP INDEX " + db.Quote(name)}
+	}
+	return definitions, nil
+}
+
+// TableDependents reads foreign keys from pg_constraint and views, including
+// materialized views, from the dependencies of their rewrite rules.
+func (db *Postgres) TableDependents(sess *xorm.Session, tableName string) ([]string, error) {
+	sql := "SELECT r.relname AS name FROM pg_constraint c JOIN pg_class r ON r.oid = c.conrelid" +
+		" JOIN pg_class t ON t.oid = c.confrelid JOIN pg_namespace n ON n.oid = t.relnamespace" +
+		" WHERE c.contype = 'f' AND t.relname = ? AND n.nspname = current_schema() AND r.oid <> t.oid" +
+		" UNION SELECT v.relname AS name FROM pg_depend d JOIN pg_rewrite w ON w.oid = d.objid JOIN pg_class v ON v.oid = w.ev_class" +
+		" JOIN pg_class t ON t.oid = d.refobjid JOIN pg_namespace n ON n.oid = t.relnamespace" +
+		" WHERE d.classid = 'pg_rewrite'::regclass AND t.relname = ? AND n.nspname = current_schema() AND v.oid <> t.oid" +
+		" ORDER BY name"
+	return tableNames(sess, sql, tableName, tableName)
+}
+
 func (db *Postgres) DropIndexSql(tableName string, index *Index) string {
 	quote := db.Quote
 	idxName := index.XName(tableName)
 	return fmt.Sprintf("DROP INDEX %v", quote(idxName))
 }
 
+func (db *Postgres) ModifyColumnSql(tableName string, col *Column) []string {
+	// render the plain type, SqlType turns auto increment columns into SERIAL
+	typeCol := *col
+	typeCol.IsAutoIncrement = false
+
+	quotedCol := db.Quote(col.Name)
+	actions := []string{"ALTER " + quotedCol + " TYPE " + db.SqlType(&typeCol)}
+	if !col.IsPrimaryKey {
+		if col.Nullable {
+			actions = append(actions, "ALTER "+quotedCol+" DROP NOT NULL")
+		} else {
+			actions = append(actions, "ALTER "+quotedCol+" SET NOT NULL")
+		}
+	}
+	if dflt := db.columnDefault(col); dflt != "" {
+		actions = append(actions, "ALTER "+quotedCol+" SET DEFAULT "+dflt)
+	}
+
+	statements := []string{"ALTER TABLE " + db.Quote(tableName) + " " + strings.Join(actions, ", ")}
+
+	// since Postgres 10 the sequence of a serial column has the integer type
+	// and keeps overflowing at 2^31 after the column is made a BIGINT
+	if col.IsAutoIncrement && (col.Type == DB_BigInt || col.Type == DB_BigSerial) {
+		statements = append(statements, fmt.Sprintf("DO $$ BEGIN IF current_setting('server_version_num')::int >= 100000 THEN "+
+			"EXECUTE format('ALTER SEQUENCE %%s AS BIGINT', pg_get_serial_sequence('%s', '%s')); END IF; END $$", db.Quote(tableName), col.Name))
+	}
+
+	return statements
+}
+
 func (db *Postgres) UpdateTableSql(tableName string, columns []*Column) string {
 	var statements = []string{}
 
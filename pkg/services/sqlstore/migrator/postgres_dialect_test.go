@@ -0,0 +1,19 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPostgresWidenVarcharAltersTypeOnly(t *testing.T) {
+	Convey("Widening a VARCHAR on Postgres", t, func() {
+		statements := NewPostgresDialect(nil).ModifyColumnSql("dashboard", &Column{Name: "title", Type: DB_NVarchar, Length: 255, Nullable: true})
+
+		Convey("is a plain type change, which doesn't rewrite the table", func() {
+			So(statements, ShouldHaveLength, 1)
+			So(statements[0], ShouldContainSubstring, `ALTER "title" TYPE VARCHAR(255)`)
+			So(statements[0], ShouldNotContainSubstring, "USING")
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package migrator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// RepeatableMigration runs the migration it wraps again whenever its
+// checksum differs from the checksum recorded in the migration log for its
+// last run, e.g. a CreateViewMigration whose body changes between versions.
+// It also runs when it is first registered. The wrapped migration has to be
+// idempotent and an SQL migration, the checksum is of its sql as recorded in
+// the log, so the log needs no checksum column.
+type RepeatableMigration struct {
+	wrappedMigration
+}
+
+func NewRepeatableMigration(m Migration) *RepeatableMigration {
+	return &RepeatableMigration{wrappedMigration{Migration: m}}
+}
+
+func (m *RepeatableMigration) SqlStatements(dialect Dialect) []string {
+	if multiStatementMigration, ok := m.Migration.(MultiStatementMigration); ok {
+		return multiStatementMigration.SqlStatements(dialect)
+	}
+	return []string{m.Migration.Sql(dialect)}
+}
+
+func (m *RepeatableMigration) Validate(mg *Migrator) error {
+	if _, ok := m.Migration.(CodeMigration); ok {
+		return fmt.Errorf("code migration %s cannot be repeatable, it has no sql to checksum", m.Migration)
+	}
+	return m.wrappedMigration.Validate(mg)
+}
+
+func (m *RepeatableMigration) String() string {
+	return fmt.Sprintf("Repeatable %s", m.Migration)
+}
+
+func sqlChecksum(sql string) string {
+	checksum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(checksum[:])
+}
@@ -0,0 +1,52 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRepeatableMigration(t *testing.T) {
+	Convey("Repeating migrations", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+			"INSERT INTO dashboard (id, title) VALUES (1, 'a')",
+		)
+		view := func(body string) *RepeatableMigration {
+			return NewRepeatableMigration(NewCreateViewMigration("dashboard_title").As(body))
+		}
+		mg.AddMigration("create view", view("SELECT title FROM dashboard"))
+		So(mg.Start(), ShouldBeNil)
+
+		Convey("is skipped while its checksum is unchanged", func() {
+			next := NewMigrator(x)
+			next.AddMigration("create view", view("SELECT title FROM dashboard"))
+			So(next.Start(), ShouldBeNil)
+			So(migrationLogRows(x, "create view"), ShouldHaveLength, 1)
+		})
+
+		Convey("runs again when its checksum changes", func() {
+			next := NewMigrator(x)
+			next.AddMigration("create view", view("SELECT upper(title) AS title FROM dashboard"))
+			So(next.Start(), ShouldBeNil)
+			So(migrationLogRows(x, "create view"), ShouldHaveLength, 2)
+			So(queryRows(x, "SELECT title FROM dashboard_title"), ShouldResemble, []map[string]string{{"title": "A"}})
+		})
+
+		Convey("verifies the wrapped migration", func() {
+			execTestSql(x, "CREATE TABLE dashboard_copy (id INTEGER PRIMARY KEY, title TEXT)")
+			mg.AddMigration("copy dashboards", NewRepeatableMigration(
+				NewCopyTableDataMigration("dashboard_copy", "dashboard", map[string]string{"id": "id", "title": "title"}).ExpectCount(2),
+			))
+			err := mg.Start()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expected 2 rows in dashboard_copy")
+			So(queryRows(x, "SELECT id FROM dashboard_copy"), ShouldBeEmpty)
+		})
+
+		Convey("refuses code migrations", func() {
+			So(NewRepeatableMigration(NewSeedDataMigration("dashboard", "id").Row(2)).Validate(mg), ShouldNotBeNil)
+		})
+	})
+}
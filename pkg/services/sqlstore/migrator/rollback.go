@@ -0,0 +1,53 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/go-xorm/xorm"
+)
+
+// Rollback undoes the migration with the given id, see ReversibleMigration,
+// and removes it from the migration log so the next Start runs it again.
+// Only the last applied migration can be rolled back, migrations after it
+// may depend on it. On MySQL Down commits its DDL implicitly, a rollback
+// failing after that leaves the migration undone but still logged.
+func (mg *Migrator) Rollback(id string) error {
+	logMap, err := mg.GetMigrationLog()
+	if err != nil {
+		return err
+	}
+
+	var reversible ReversibleMigration
+	for _, m := range mg.migrations {
+		if m.Id() == id {
+			reversibleMigration, ok := m.(ReversibleMigration)
+			if !ok {
+				return fmt.Errorf("migration %s (%s) can't be rolled back", id, m)
+			}
+			if _, applied := logMap[id]; !applied {
+				return fmt.Errorf("migration %s was not applied", id)
+			}
+			reversible = reversibleMigration
+			continue
+		}
+		if _, applied := logMap[m.Id()]; reversible != nil && applied {
+			return fmt.Errorf("unable to roll back migration %s, migration %s ran after it", id, m.Id())
+		}
+	}
+	if reversible == nil {
+		return fmt.Errorf("unknown migration %s", id)
+	}
+
+	mg.Logger.Info("Rolling back migration", "id", id, "migration", reversible.String())
+	return mg.inTransaction(func(sess *xorm.Session) error {
+		if err := reversible.Down(sess, mg); err != nil {
+			mg.Logger.Error("Rolling back migration failed", "id", id, "error", err)
+			return err
+		}
+		if _, err := sess.Where("migration_id = ?", id).Delete(&MigrationLog{}); err != nil {
+			return err
+		}
+		_, err := mg.clearFingerprint(sess)
+		return err
+	})
+}
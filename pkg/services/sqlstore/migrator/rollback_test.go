@@ -0,0 +1,54 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRollback(t *testing.T) {
+	Convey("Rolling back migrations", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x, "CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)")
+		addUid := NewAddColumnMigration(Table{Name: "dashboard"}, &Column{Name: "uid", Type: DB_NVarchar, Length: 40, Nullable: true})
+
+		Convey("undoes the last migration and lets Start run it again", func() {
+			mg.AddMigration("add uid", addUid)
+			So(mg.Start(), ShouldBeNil)
+
+			So(mg.Rollback("add uid"), ShouldBeNil)
+			So(migrationLogRows(x, "add uid"), ShouldBeEmpty)
+			_, err := x.QueryString("SELECT uid FROM dashboard")
+			So(err, ShouldNotBeNil)
+
+			So(mg.Start(), ShouldBeNil)
+			So(migrationLogRows(x, "add uid"), ShouldHaveLength, 1)
+			_, err = x.QueryString("SELECT uid FROM dashboard")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("refuses migrations that can't undo themselves", func() {
+			mg.AddMigration("add title index", NewRawSqlMigration("CREATE INDEX IDX_dashboard_title ON dashboard (title)"))
+			So(mg.Start(), ShouldBeNil)
+			So(mg.Rollback("add title index"), ShouldNotBeNil)
+			So(migrationLogRows(x, "add title index"), ShouldHaveLength, 1)
+		})
+
+		Convey("refuses migrations that weren't applied", func() {
+			mg.AddMigration("add uid", addUid)
+			So(mg.Rollback("add uid"), ShouldNotBeNil)
+			So(mg.Rollback("unknown"), ShouldNotBeNil)
+		})
+
+		Convey("refuses migrations applied before others", func() {
+			mg.AddMigration("add uid", addUid)
+			mg.AddMigration("add title index", NewRawSqlMigration("CREATE INDEX IDX_dashboard_title ON dashboard (title)"))
+			So(mg.Start(), ShouldBeNil)
+
+			err := mg.Rollback("add uid")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "migration add title index ran after it")
+			So(migrationLogRows(x, "add uid"), ShouldHaveLength, 1)
+		})
+	})
+}
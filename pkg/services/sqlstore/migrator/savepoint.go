@@ -0,0 +1,99 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/go-xorm/xorm"
+)
+
+// StatementsMigration runs statements in order, like a MultiStatementMigration,
+// but some of them may be optional, e.g. best effort cleanups. An optional
+// statement runs after a savepoint and if it fails, the transaction is rolled
+// back to the savepoint and the migration continues with the next statement.
+// MySQL commits the transaction around DDL statements, which releases the
+// savepoint, so there only data statements can be optional.
+type StatementsMigration struct {
+	MigrationBase
+	statements []migrationStatement
+}
+
+type migrationStatement struct {
+	sql      string
+	optional bool
+}
+
+func NewStatementsMigration() *StatementsMigration {
+	return &StatementsMigration{}
+}
+
+// Statement adds a statement whose failure fails the migration.
+func (m *StatementsMigration) Statement(sql string) *StatementsMigration {
+	m.statements = append(m.statements, migrationStatement{sql: sql})
+	return m
+}
+
+// OptionalStatement adds a statement whose failure is logged and rolled back
+// without failing the migration.
+func (m *StatementsMigration) OptionalStatement(sql string) *StatementsMigration {
+	m.statements = append(m.statements, migrationStatement{sql: sql, optional: true})
+	return m
+}
+
+func (m *StatementsMigration) Validate(mg *Migrator) error {
+	if len(m.statements) == 0 {
+		return fmt.Errorf("migration %s has no statements", m.Id())
+	}
+	if !mg.Dialect.SupportsTransactionalDDL() {
+		for _, statement := range m.statements {
+			if statement.optional && !isDataStatement(statement.sql) {
+				return fmt.Errorf("optional statement of migration %s is not a data statement, %s commits DDL and its savepoint: %s", m.Id(), mg.Dialect.DriverName(), statement.sql)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *StatementsMigration) SqlStatements(dialect Dialect) []string {
+	statements := make([]string, 0, len(m.statements))
+	for _, statement := range m.statements {
+		statements = append(statements, statement.sql)
+	}
+	return statements
+}
+
+func (m *StatementsMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.SqlStatements(dialect))
+}
+
+func (m *StatementsMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	dialect := mg.Dialect
+	statements := mg.statements(m)
+	for i, statement := range m.statements {
+		sql := statements[i]
+		if !statement.optional {
+			if _, err := sess.Exec(sql); err != nil {
+				return err
+			}
+			continue
+		}
+
+		savepoint := fmt.Sprintf("optional_statement_%d", i+1)
+		if _, err := sess.Exec(dialect.SavepointSql(savepoint)); err != nil {
+			return err
+		}
+		if _, err := sess.Exec(sql); err != nil {
+			mg.Logger.Warn("Optional statement failed, rolling back to savepoint", "id", m.Id(), "sql", sql, "error", err)
+			if _, err := sess.Exec(dialect.RollbackToSavepointSql(savepoint)); err != nil {
+				return err
+			}
+		}
+		if _, err := sess.Exec(dialect.ReleaseSavepointSql(savepoint)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *StatementsMigration) String() string {
+	return fmt.Sprintf("Statements (%d)", len(m.statements))
+}
@@ -0,0 +1,53 @@
+package migrator
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatementsMigration(t *testing.T) {
+	Convey("Running statements with optional ones", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x, "CREATE TABLE tag (id INTEGER PRIMARY KEY, term TEXT)")
+		statements := NewStatementsMigration().
+			Statement("INSERT INTO tag (id, term) VALUES (1, 'a')").
+			OptionalStatement("INSERT INTO tag (id, term) VALUES (1, 'duplicate')").
+			Statement("INSERT INTO tag (id, term) VALUES (2, 'b')")
+
+		Convey("rolls a failing optional statement back to its savepoint and continues", func() {
+			mg.AddMigration("insert tags", statements)
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT id, term FROM tag ORDER BY id"), ShouldResemble, []map[string]string{
+				{"id": "1", "term": "a"},
+				{"id": "2", "term": "b"},
+			})
+
+			results, err := x.QueryString("SELECT sql, success FROM migration_log WHERE migration_id = 'insert tags'")
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 1)
+			So(results[0]["success"], ShouldEqual, "1")
+			So(results[0]["sql"], ShouldEqual, statements.Sql(mg.Dialect))
+			So(results[0]["sql"], ShouldContainSubstring, "VALUES (2, 'b')")
+		})
+
+		Convey("fails on a failing required statement", func() {
+			statements.Statement("INSERT INTO tag (id, term) VALUES (2, 'duplicate')")
+			mg.AddMigration("insert tags", statements)
+			err := mg.Start()
+			So(err, ShouldNotBeNil)
+			So(err.(*MigrationError).Sql, ShouldContainSubstring, "VALUES (2, 'duplicate')")
+			So(queryRows(x, "SELECT id FROM tag"), ShouldBeEmpty)
+		})
+
+		Convey("runs every statement through the sql rewriter", func() {
+			mg.SqlRewriter = func(migrationId string, sql string) string {
+				return strings.Replace(sql, "'b'", "'rewritten'", 1)
+			}
+			mg.AddMigration("insert tags", statements)
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT term FROM tag WHERE id = 2"), ShouldResemble, []map[string]string{{"term": "rewritten"}})
+		})
+	})
+}
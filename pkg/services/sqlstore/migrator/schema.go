@@ -0,0 +1,236 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+const (
+	DiffMissingTable    = "missing table"
+	DiffMissingColumn   = "missing column"
+	DiffExtraColumn     = "unexpected column"
+	DiffColumnType      = "column type"
+	DiffColumnNullable  = "column nullability"
+	DiffColumnOrder     = "column order"
+	DiffMissingIndex    = "missing index"
+	DiffExtraIndex      = "unexpected index"
+	DiffIndexDefinition = "index definition"
+)
+
+// SchemaDifference is a difference between a declared table and the table
+// in the database. Name is the column or index that differs.
+type SchemaDifference struct {
+	Table    string
+	Kind     string
+	Name     string
+	Expected string
+	Actual   string
+}
+
+func (d SchemaDifference) String() string {
+	object := d.Table
+	if d.Name != "" {
+		object += "." + d.Name
+	}
+	if d.Expected == "" && d.Actual == "" {
+		return fmt.Sprintf("%s: %s", object, d.Kind)
+	}
+	return fmt.Sprintf("%s: %s differs, expected %s, actual %s", object, d.Kind, d.Expected, d.Actual)
+}
+
+type DiffOptions struct {
+	// IgnoreColumnOrder treats tables with the same columns in another order
+	// as equal. Most engines cannot reorder columns without rebuilding the
+	// table, so this is the default.
+	IgnoreColumnOrder bool
+}
+
+var DefaultDiffOptions = DiffOptions{IgnoreColumnOrder: true}
+
+// DiffSchema compares the declared tables with the tables in the database,
+// using DefaultDiffOptions if opts is nil. Column types are compared with
+// Dialect.TypesEquivalent, defaults are not compared.
+func (mg *Migrator) DiffSchema(expected []Table, opts *DiffOptions) ([]SchemaDifference, error) {
+	if opts == nil {
+		defaults := DefaultDiffOptions
+		opts = &defaults
+	}
+
+	var differences []SchemaDifference
+	err := mg.inTransaction(func(sess *xorm.Session) error {
+		for i := range expected {
+			tableDifferences, err := diffTable(sess, mg.Dialect, &expected[i], opts)
+			if err != nil {
+				return err
+			}
+			differences = append(differences, tableDifferences...)
+		}
+		return nil
+	})
+	return differences, err
+}
+
+func diffTable(sess *xorm.Session, dialect Dialect, expected *Table, opts *DiffOptions) ([]SchemaDifference, error) {
+	sql, args := dialect.TableCheckSql(expected.Name)
+	results, err := sess.SQL(sql, args...).Query()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return []SchemaDifference{{Table: expected.Name, Kind: DiffMissingTable}}, nil
+	}
+
+	actual, err := dialect.DescribeTable(sess, expected.Name)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := dialect.ListIndexes(sess, expected.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	differences := diffColumns(dialect, expected, actual, opts)
+	return append(differences, diffIndexes(expected, indexes)...), nil
+}
+
+func diffColumns(dialect Dialect, expected *Table, actual *Table, opts *DiffOptions) []SchemaDifference {
+	differences := []SchemaDifference{}
+	actualCols := map[string]*Column{}
+	for _, col := range actual.Columns {
+		actualCols[strings.ToLower(col.Name)] = col
+	}
+
+	expectedNames := map[string]bool{}
+	expectedOrder := []string{}
+	for _, col := range expected.Columns {
+		expectedNames[strings.ToLower(col.Name)] = true
+		actualCol, ok := actualCols[strings.ToLower(col.Name)]
+		if !ok {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffMissingColumn, Name: col.Name})
+			continue
+		}
+		expectedOrder = append(expectedOrder, col.Name)
+
+		// SqlType marks serial columns as primary keys on SQLite
+		typeCol := *col
+		if declared := dialect.SqlType(&typeCol); !dialect.TypesEquivalent(declared, actualCol.Type) {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffColumnType, Name: col.Name, Expected: declared, Actual: actualCol.Type})
+		}
+		// primary keys are NOT NULL whatever they were declared as
+		if !col.IsPrimaryKey && col.Nullable != actualCol.Nullable {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffColumnNullable, Name: col.Name, Expected: nullability(col.Nullable), Actual: nullability(actualCol.Nullable)})
+		}
+	}
+
+	actualOrder := []string{}
+	for _, col := range actual.Columns {
+		if !expectedNames[strings.ToLower(col.Name)] {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffExtraColumn, Name: col.Name})
+			continue
+		}
+		actualOrder = append(actualOrder, col.Name)
+	}
+
+	if !opts.IgnoreColumnOrder && !strings.EqualFold(strings.Join(expectedOrder, ","), strings.Join(actualOrder, ",")) {
+		differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffColumnOrder, Expected: strings.Join(expectedOrder, ", "), Actual: strings.Join(actualOrder, ", ")})
+	}
+
+	return differences
+}
+
+func diffIndexes(expected *Table, actual []*Index) []SchemaDifference {
+	differences := []SchemaDifference{}
+	actualIndexes := map[string]*Index{}
+	for _, index := range actual {
+		actualIndexes[strings.ToLower(index.Name)] = index
+	}
+
+	expectedNames := map[string]bool{}
+	for _, index := range expected.Indices {
+		name := index.XName(expected.Name)
+		expectedNames[strings.ToLower(name)] = true
+		actualIndex, ok := actualIndexes[strings.ToLower(name)]
+		if !ok {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffMissingIndex, Name: name})
+			continue
+		}
+		if want, got := indexDefinition(index), indexDefinition(actualIndex); !strings.EqualFold(want, got) {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffIndexDefinition, Name: name, Expected: want, Actual: got})
+		}
+	}
+
+	for _, index := range actual {
+		if !expectedNames[strings.ToLower(index.Name)] {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Kind: DiffExtraIndex, Name: index.Name})
+		}
+	}
+
+	return differences
+}
+
+func indexDefinition(index *Index) string {
+	definition := "(" + strings.Join(index.Cols, ", ") + ")"
+	if index.Type == UniqueIndex {
+		return "UNIQUE " + definition
+	}
+	return definition
+}
+
+func nullability(nullable bool) string {
+	if nullable {
+		return "NULL"
+	}
+	return "NOT NULL"
+}
+
+// collectIndexes builds indexes from rows of index_name, is_unique and
+// column_name ordered by index and position of the column in the index.
+func collectIndexes(results []map[string][]byte) []*Index {
+	indexes := []*Index{}
+	var index *Index
+	for _, row := range results {
+		name := string(row["index_name"])
+		if index == nil || index.Name != name {
+			index = &Index{Name: name, Type: IndexType}
+			if introspectedBool(row["is_unique"]) {
+				index.Type = UniqueIndex
+			}
+			indexes = append(indexes, index)
+		}
+		index.Cols = append(index.Cols, string(row["column_name"]))
+	}
+	return indexes
+}
+
+// collectConstraints groups rows of constraint columns ordered by constraint
+// name and position, as returned by ListConstraints queries. Rows of check
+// constraints may have no column.
+func collectConstraints(results []map[string][]byte) []*Constraint {
+	constraints := []*Constraint{}
+	var constraint *Constraint
+	for _, row := range results {
+		name := string(row["name"])
+		if constraint == nil || constraint.Name != name {
+			constraint = &Constraint{Name: name, Type: string(row["type"]), RefTable: string(row["ref_table"])}
+			constraints = append(constraints, constraint)
+		}
+		if col := string(row["column_name"]); col != "" {
+			constraint.Cols = append(constraint.Cols, col)
+		}
+		if refCol := string(row["ref_column"]); refCol != "" {
+			constraint.RefCols = append(constraint.RefCols, refCol)
+		}
+	}
+	return constraints
+}
+
+// introspectedBool parses the booleans drivers return for catalog queries.
+func introspectedBool(value []byte) bool {
+	switch strings.ToLower(string(value)) {
+	case "1", "t", "true", "y", "yes":
+		return true
+	}
+	return false
+}
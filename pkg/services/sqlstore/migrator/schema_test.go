@@ -0,0 +1,75 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffSchema(t *testing.T) {
+	Convey("Diffing the declared schema", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		dashboard := Table{
+			Name: "dashboard",
+			Columns: []*Column{
+				{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+				{Name: "title", Type: DB_NVarchar, Length: 255, Nullable: false},
+				{Name: "uid", Type: DB_NVarchar, Length: 40, Nullable: true},
+			},
+			Indices: []*Index{
+				{Cols: []string{"uid"}, Type: UniqueIndex},
+				{Cols: []string{"title"}},
+			},
+		}
+
+		Convey("finds no differences once the table is created", func() {
+			mg.AddMigration("create dashboard", NewAddTableMigration(dashboard))
+			mg.AddMigration("add uid index", NewAddIndexMigration(dashboard, dashboard.Indices[0]))
+			mg.AddMigration("add title index", NewAddIndexMigration(dashboard, dashboard.Indices[1]))
+			So(mg.Start(), ShouldBeNil)
+
+			differences, err := mg.DiffSchema([]Table{dashboard}, nil)
+			So(err, ShouldBeNil)
+			So(differences, ShouldBeEmpty)
+		})
+
+		Convey("reports a missing table", func() {
+			differences, err := mg.DiffSchema([]Table{dashboard}, nil)
+			So(err, ShouldBeNil)
+			So(differences, ShouldResemble, []SchemaDifference{{Table: "dashboard", Kind: DiffMissingTable}})
+			So(differences[0].String(), ShouldEqual, "dashboard: missing table")
+		})
+
+		Convey("reports columns and indexes that differ", func() {
+			execTestSql(x,
+				"CREATE TABLE dashboard (slug TEXT, id INTEGER PRIMARY KEY AUTOINCREMENT, title INTEGER)",
+				"CREATE INDEX IDX_dashboard_title ON dashboard (title, id)",
+				"CREATE INDEX IDX_dashboard_slug ON dashboard (slug)",
+			)
+			differences, err := mg.DiffSchema([]Table{dashboard}, nil)
+			So(err, ShouldBeNil)
+			So(differences, ShouldResemble, []SchemaDifference{
+				{Table: "dashboard", Kind: DiffColumnType, Name: "title", Expected: "TEXT", Actual: "INTEGER"},
+				{Table: "dashboard", Kind: DiffColumnNullable, Name: "title", Expected: "NOT NULL", Actual: "NULL"},
+				{Table: "dashboard", Kind: DiffMissingColumn, Name: "uid"},
+				{Table: "dashboard", Kind: DiffExtraColumn, Name: "slug"},
+				{Table: "dashboard", Kind: DiffMissingIndex, Name: "UQE_dashboard_uid"},
+				{Table: "dashboard", Kind: DiffIndexDefinition, Name: "IDX_dashboard_title", Expected: "(title)", Actual: "(title, id)"},
+				{Table: "dashboard", Kind: DiffExtraIndex, Name: "IDX_dashboard_slug"},
+			})
+		})
+
+		Convey("compares the column order unless it is ignored", func() {
+			execTestSql(x, "CREATE TABLE dashboard (id INTEGER PRIMARY KEY AUTOINCREMENT, uid TEXT, title TEXT NOT NULL)")
+			differences, err := mg.DiffSchema([]Table{{Name: "dashboard", Columns: dashboard.Columns}}, &DiffOptions{})
+			So(err, ShouldBeNil)
+			So(differences, ShouldResemble, []SchemaDifference{
+				{Table: "dashboard", Kind: DiffColumnOrder, Expected: "id, title, uid", Actual: "id, uid, title"},
+			})
+
+			differences, err = mg.DiffSchema([]Table{{Name: "dashboard", Columns: dashboard.Columns}}, nil)
+			So(err, ShouldBeNil)
+			So(differences, ShouldBeEmpty)
+		})
+	})
+}
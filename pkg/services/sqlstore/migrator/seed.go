@@ -0,0 +1,234 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+// SeedDataMigration inserts rows into a table unless a row with the same key
+// already exists, so seeding rows that were added by hand or by an earlier
+// seed does not fail or duplicate them.
+type SeedDataMigration struct {
+	MigrationBase
+	tableName  string
+	columns    []string
+	keyColumns []string
+	rows       [][]interface{}
+}
+
+// NewSeedDataMigration seeds the given columns of a table, rows are keyed on
+// the first column unless KeyColumns says otherwise.
+func NewSeedDataMigration(tableName string, columns ...string) *SeedDataMigration {
+	m := &SeedDataMigration{tableName: tableName, columns: columns}
+	if len(columns) > 0 {
+		m.keyColumns = columns[:1]
+	}
+	return m
+}
+
+func (m *SeedDataMigration) KeyColumns(cols ...string) *SeedDataMigration {
+	m.keyColumns = cols
+	return m
+}
+
+// Row adds a row with one value per seeded column.
+func (m *SeedDataMigration) Row(values ...interface{}) *SeedDataMigration {
+	m.rows = append(m.rows, values)
+	return m
+}
+
+func (m *SeedDataMigration) Validate(mg *Migrator) error {
+	if len(m.keyColumns) == 0 {
+		return fmt.Errorf("seed data for %s needs at least one key column", m.tableName)
+	}
+	for _, key := range m.keyColumns {
+		if m.columnIndex(key) == -1 {
+			return fmt.Errorf("key column %s of seed data for %s is not seeded", key, m.tableName)
+		}
+	}
+	for i, row := range m.rows {
+		if len(row) != len(m.columns) {
+			return fmt.Errorf("row %d of seed data for %s has %d values, expected %d", i, m.tableName, len(row), len(m.columns))
+		}
+	}
+	return nil
+}
+
+func (m *SeedDataMigration) columnIndex(col string) int {
+	for i, c := range m.columns {
+		if c == col {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *SeedDataMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *SeedDataMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	quote := mg.Dialect.Quote
+
+	where := make([]string, len(m.keyColumns))
+	for i, key := range m.keyColumns {
+		where[i] = quote(key) + "=" + mg.Dialect.Placeholder(i+1)
+	}
+	existsSql := fmt.Sprintf("SELECT 1 FROM %s WHERE %s", quote(m.tableName), strings.Join(where, " AND "))
+
+	cols := make([]string, len(m.columns))
+	placeholders := make([]string, len(m.columns))
+	for i, col := range m.columns {
+		cols[i] = quote(col)
+		placeholders[i] = mg.Dialect.Placeholder(i + 1)
+	}
+	insertSql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(m.tableName), strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+
+	inserted := 0
+	for _, row := range m.rows {
+		keys := make([]interface{}, len(m.keyColumns))
+		for i, key := range m.keyColumns {
+			keys[i] = row[m.columnIndex(key)]
+		}
+
+		results, err := sess.SQL(existsSql, keys...).Query()
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 {
+			continue
+		}
+
+		if _, err := sess.Exec(insertSql, row...); err != nil {
+			return err
+		}
+		inserted++
+	}
+
+	mg.Logger.Debug("Seeded table", "table", m.tableName, "rows", len(m.rows), "inserted", inserted)
+	return nil
+}
+
+func (m *SeedDataMigration) String() string {
+	return fmt.Sprintf("SeedData %s (%d rows)", m.tableName, len(m.rows))
+}
+
+// AddReferenceTableMigration creates a table with its indices and seeds its
+// canonical rows in one migration, for lookup tables that are of no use
+// without their rows. Rows are keyed on the primary key of the table unless
+// KeyColumns says otherwise. MySQL commits DDL implicitly, so there a failing
+// seed leaves the created table behind; existing tables, indices and rows are
+// skipped, so the migration can simply be run again.
+type AddReferenceTableMigration struct {
+	MigrationBase
+	table *AddTableMigration
+	seed  *SeedDataMigration
+}
+
+func NewAddReferenceTableMigration(table Table, columns ...string) *AddReferenceTableMigration {
+	m := &AddReferenceTableMigration{
+		table: NewAddTableMigration(table),
+		seed:  NewSeedDataMigration(table.Name, columns...),
+	}
+	if pks := m.table.table.PrimaryKeys; len(pks) > 0 {
+		m.seed.KeyColumns(pks...)
+	}
+	return m
+}
+
+func (m *AddReferenceTableMigration) KeyColumns(cols ...string) *AddReferenceTableMigration {
+	m.seed.KeyColumns(cols...)
+	return m
+}
+
+func (m *AddReferenceTableMigration) Row(values ...interface{}) *AddReferenceTableMigration {
+	m.seed.Row(values...)
+	return m
+}
+
+// SetId also sets the id of the table migration, which logs it validating.
+func (m *AddReferenceTableMigration) SetId(id string) {
+	m.MigrationBase.SetId(id)
+	m.table.SetId(id)
+}
+
+func (m *AddReferenceTableMigration) Validate(mg *Migrator) error {
+	if err := m.table.Validate(mg); err != nil {
+		return err
+	}
+	return m.seed.Validate(mg)
+}
+
+func (m *AddReferenceTableMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *AddReferenceTableMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	table := &m.table.table
+
+	if _, err := sess.Exec(m.table.Sql(mg.Dialect)); err != nil {
+		return err
+	}
+
+	for _, index := range table.Indices {
+		sql, args := mg.Dialect.IndexCheckSql(table.Name, index.XName(table.Name))
+		results, err := sess.SQL(sql, args...).Query()
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 {
+			continue
+		}
+
+		if _, err := sess.Exec(mg.Dialect.CreateIndexSql(table.Name, index)); err != nil {
+			return err
+		}
+	}
+
+	return m.seed.Exec(sess, mg)
+}
+
+func (m *AddReferenceTableMigration) String() string {
+	return fmt.Sprintf("AddReferenceTable %s (%d columns, %d rows)", m.table.table.Name, len(m.table.table.Columns), len(m.seed.rows))
+}
+
+// SetAutoIncrementStartMigration sets the next value of an auto increment
+// column, e.g. to 101 after seeding built-in rows with the ids 1 to 100.
+type SetAutoIncrementStartMigration struct {
+	MigrationBase
+	tableName string
+	column    *Column
+	value     int64
+}
+
+func NewSetAutoIncrementStartMigration(table Table, col *Column, value int64) *SetAutoIncrementStartMigration {
+	return &SetAutoIncrementStartMigration{tableName: table.Name, column: col, value: value}
+}
+
+func (m *SetAutoIncrementStartMigration) Validate(mg *Migrator) error {
+	if !m.column.IsAutoIncrement {
+		return fmt.Errorf("column %s.%s is not an auto increment column", m.tableName, m.column.Name)
+	}
+	if m.value < 1 {
+		return fmt.Errorf("invalid auto increment start %d for %s.%s", m.value, m.tableName, m.column.Name)
+	}
+	return nil
+}
+
+func (m *SetAutoIncrementStartMigration) Sql(dialect Dialect) string {
+	statements := dialect.AutoIncrementStartSql(m.tableName, m.column, m.value)
+	if len(statements) == 0 {
+		return CodeMigrationSql
+	}
+	return joinStatements(statements)
+}
+
+func (m *SetAutoIncrementStartMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	return mg.Dialect.SetAutoIncrementStart(sess, m.tableName, m.column, m.value)
+}
+
+func (m *SetAutoIncrementStartMigration) String() string {
+	return fmt.Sprintf("SetAutoIncrementStart %s.%s %d", m.tableName, m.column.Name, m.value)
+}
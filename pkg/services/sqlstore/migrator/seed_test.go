@@ -0,0 +1,102 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSeedDataMigration(t *testing.T) {
+	Convey("Seeding rows", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE role (id INTEGER PRIMARY KEY, org_id INTEGER, name TEXT)",
+			"INSERT INTO role (id, org_id, name) VALUES (1, 1, 'changed by hand')",
+		)
+		seed := func() *SeedDataMigration {
+			return NewSeedDataMigration("role", "id", "org_id", "name").
+				Row(1, 1, "viewer").
+				Row(2, 1, "editor")
+		}
+
+		Convey("skips rows whose key exists and inserts the others", func() {
+			mg.AddMigration("seed roles", seed())
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT id, name FROM role ORDER BY id"), ShouldResemble, []map[string]string{
+				{"id": "1", "name": "changed by hand"},
+				{"id": "2", "name": "editor"},
+			})
+		})
+
+		Convey("inserts nothing when seeded again", func() {
+			mg.AddMigration("seed roles", seed())
+			mg.AddMigration("seed roles again", seed().Row(3, 2, "admin"))
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT id FROM role ORDER BY id"), ShouldResemble, []map[string]string{{"id": "1"}, {"id": "2"}, {"id": "3"}})
+		})
+
+		Convey("keys on all key columns", func() {
+			mg.AddMigration("seed roles", NewSeedDataMigration("role", "org_id", "name").
+				KeyColumns("org_id", "name").
+				Row(1, "changed by hand").
+				Row(2, "changed by hand"))
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT org_id FROM role ORDER BY org_id"), ShouldResemble, []map[string]string{{"org_id": "1"}, {"org_id": "2"}})
+		})
+
+		Convey("validates the key columns and rows", func() {
+			So(seed().KeyColumns("missing").Validate(mg), ShouldNotBeNil)
+			So(seed().Row(3, 1).Validate(mg), ShouldNotBeNil)
+			So(seed().Validate(mg), ShouldBeNil)
+		})
+	})
+}
+
+func TestAddReferenceTableMigration(t *testing.T) {
+	Convey("Adding a reference table", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		table := Table{
+			Name: "role",
+			Columns: []*Column{
+				{Name: "id", Type: DB_BigInt, IsPrimaryKey: true},
+				{Name: "name", Type: DB_Text},
+			},
+			Indices: []*Index{{Cols: []string{"name"}, Type: UniqueIndex}},
+		}
+		reference := func() *AddReferenceTableMigration {
+			return NewAddReferenceTableMigration(table, "id", "name").
+				Row(1, "viewer").
+				Row(2, "editor")
+		}
+
+		Convey("creates the table with its indices and rows", func() {
+			mg.AddMigration("add role", reference())
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT id, name FROM role ORDER BY id"), ShouldResemble, []map[string]string{
+				{"id": "1", "name": "viewer"},
+				{"id": "2", "name": "editor"},
+			})
+			_, err := x.Exec("INSERT INTO role (id, name) VALUES (3, 'viewer')")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("completes a table left behind by an earlier run", func() {
+			execTestSql(x,
+				"CREATE TABLE role (id INTEGER PRIMARY KEY, name TEXT)",
+				"INSERT INTO role (id, name) VALUES (1, 'viewer')",
+			)
+			mg.AddMigration("add role", reference())
+			So(mg.Start(), ShouldBeNil)
+			So(queryRows(x, "SELECT id FROM role ORDER BY id"), ShouldResemble, []map[string]string{{"id": "1"}, {"id": "2"}})
+			So(queryRows(x, "SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'role'"), ShouldResemble, []map[string]string{{"name": "UQE_role_name"}})
+		})
+
+		Convey("validates the table as well as the seed", func() {
+			partitioned := table
+			partitioned.PartitionBy = "RANGE (id)"
+			So(NewAddReferenceTableMigration(partitioned, "id", "name").Validate(mg), ShouldNotBeNil)
+			So(reference().Row(3).Validate(mg), ShouldNotBeNil)
+			So(reference().Validate(mg), ShouldBeNil)
+		})
+	})
+}
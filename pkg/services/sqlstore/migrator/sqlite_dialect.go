@@ -2,6 +2,9 @@ package migrator
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-xorm/xorm"
 	sqlite3 "github.com/mattn/go-sqlite3"
@@ -42,6 +45,42 @@ func (db *Sqlite3) DateTimeFunc(value string) string {
 	return "datetime(" + value + ")"
 }
 
+// Random scales random(), which returns a signed 64-bit integer in SQLite,
+// down to [0, 1) by keeping the 53 bits a float can represent exactly.
+func (db *Sqlite3) Random() string {
+	return "((random() & 9007199254740991) / 9007199254740992.0)"
+}
+
+// OutOfRangeExpr returns an empty string, SQLite column types are only
+// affinities and neither lengths nor integer sizes are enforced.
+func (db *Sqlite3) OutOfRangeExpr(col *Column) string {
+	return ""
+}
+
+// TypesEquivalent compares type affinities, SQLite keeps the declared type
+// but only its affinity affects how values are stored.
+func (db *Sqlite3) TypesEquivalent(declared string, introspected string) bool {
+	return sqliteTypeAffinity(declared) == sqliteTypeAffinity(introspected)
+}
+
+// sqliteTypeAffinity applies the rules of
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+func sqliteTypeAffinity(sqlType string) string {
+	sqlType = strings.ToUpper(sqlType)
+	switch {
+	case strings.Contains(sqlType, "INT"):
+		return DB_Integer
+	case strings.Contains(sqlType, "CHAR"), strings.Contains(sqlType, "CLOB"), strings.Contains(sqlType, "TEXT"):
+		return DB_Text
+	case strings.Contains(sqlType, "BLOB"), strings.TrimSpace(sqlType) == "":
+		return DB_Blob
+	case strings.Contains(sqlType, "REAL"), strings.Contains(sqlType, "FLOA"), strings.Contains(sqlType, "DOUB"):
+		return DB_Real
+	default:
+		return DB_Numeric
+	}
+}
+
 func (db *Sqlite3) SqlType(c *Column) string {
 	switch c.Type {
 	case DB_Date, DB_DateTime, DB_TimeStamp, DB_Time:
@@ -68,12 +107,251 @@ func (db *Sqlite3) SqlType(c *Column) string {
 	}
 }
 
+// MaxColumns is the SQLITE_MAX_COLUMN compile time default.
+func (db *Sqlite3) MaxColumns() int {
+	return 2000
+}
+
+// MaxIndexColumns is the SQLITE_MAX_COLUMN compile time default.
+func (db *Sqlite3) MaxIndexColumns() int {
+	return 2000
+}
+
+// SetTransactionIsolationSql returns no statements, SQLite transactions are
+// always serializable which satisfies every level.
+func (db *Sqlite3) SetTransactionIsolationSql(level string) ([]string, error) {
+	_, err := normalizeIsolationLevel(level)
+	return nil, err
+}
+
+// CreateViewSql drops and recreates the view, SQLite has no CREATE OR REPLACE VIEW.
+func (db *Sqlite3) CreateViewSql(viewName string, sql string) []string {
+	return []string{
+		fmt.Sprintf("DROP VIEW IF EXISTS %s", db.Quote(viewName)),
+		fmt.Sprintf("CREATE VIEW %s AS %s", db.Quote(viewName), sql),
+	}
+}
+
+func (db *Sqlite3) ViewDefinitionSql(viewName string) (string, []interface{}) {
+	args := []interface{}{viewName}
+	sql := "SELECT " + db.Quote("sql") + " AS " + db.Quote("definition") + " FROM " + db.Quote("sqlite_master") + " WHERE " + db.Quote("type") + "='view' AND " + db.Quote("name") + "=?"
+	return sql, args
+}
+
+// ExplainSql uses EXPLAIN QUERY PLAN, plain EXPLAIN lists the bytecode of
+// the statement.
+func (db *Sqlite3) ExplainSql(query string) string {
+	return "EXPLAIN QUERY PLAN " + query
+}
+
+// SetAutoIncrementStart sets the sequence of an AUTOINCREMENT table in
+// sqlite_sequence, SQLite still never hands out an id below the largest one.
+func (db *Sqlite3) SetAutoIncrementStart(sess *xorm.Session, tableName string, col *Column, value int64) error {
+	def, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+	if !def.isAutoIncrement(col.Name) {
+		return fmt.Errorf("unable to set the auto increment start of %s, column %s is not an AUTOINCREMENT column", tableName, col.Name)
+	}
+
+	exists, err := sqliteHasSequenceTable(sess)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("unable to set the auto increment start of %s, sqlite_sequence does not exist", tableName)
+	}
+
+	if _, err := sess.Exec("DELETE FROM sqlite_sequence WHERE name = ?", tableName); err != nil {
+		return err
+	}
+	_, err = sess.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)", tableName, value-1)
+	return err
+}
+
+// SwapTableSql drops the table before renaming the new one into place, as
+// table rebuilds do, and leaves no backup. Renaming the table to the backup
+// name would make views, triggers and foreign keys of other tables refer to
+// the backup, dangling once it is dropped.
+func (db *Sqlite3) SwapTableSql(tableName string, newTableName string, backupTableName string) []string {
+	return append([]string{"DROP TABLE " + db.Quote(tableName)}, sqliteRenameIntoPlaceSql(db, newTableName, tableName)...)
+}
+
+// TableDependents only returns tables referencing the table while foreign
+// keys are enforced. Views and unenforced foreign keys refer to the table by
+// name and find the new one, see sqliteRenameIntoPlaceSql.
+func (db *Sqlite3) TableDependents(sess *xorm.Session, tableName string) ([]string, error) {
+	return sqliteEnforcedReferences(sess, db, tableName)
+}
+
+// IncrementOnUpdateTriggerSql updates the row again after it was updated,
+// SQLite can't change NEW. The table needs a rowid.
+func (db *Sqlite3) IncrementOnUpdateTriggerSql(tableName string, triggerName string, columnName string) []string {
+	col := db.Quote(columnName)
+	trigger := &Trigger{Name: triggerName, Timing: TriggerAfter, Event: TriggerUpdate}
+	body := fmt.Sprintf("UPDATE %s SET %s = OLD.%s + 1 WHERE rowid = NEW.rowid", db.Quote(tableName), col, col)
+	return db.CreateTriggerSql(tableName, trigger, body)
+}
+
+func (db *Sqlite3) TableCheckSql(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	sql := "SELECT 1 FROM " + db.Quote("sqlite_master") + " WHERE " + db.Quote("type") + "='table' AND " + db.Quote("name") + "=?"
+	return sql, args
+}
+
 func (db *Sqlite3) IndexCheckSql(tableName, indexName string) (string, []interface{}) {
 	args := []interface{}{tableName, indexName}
 	sql := "SELECT 1 FROM " + db.Quote("sqlite_master") + " WHERE " + db.Quote("type") + "='index' AND " + db.Quote("tbl_name") + "=? AND " + db.Quote("name") + "=?"
 	return sql, args
 }
 
+// DeleteBatchSql selects the rows by rowid, DELETE ... LIMIT needs SQLite to
+// be compiled with SQLITE_ENABLE_UPDATE_DELETE_LIMIT.
+func (db *Sqlite3) DeleteBatchSql(tableName string, where string, limit int64) string {
+	quoted := db.Quote(tableName)
+	return fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s WHERE %s%s)", quoted, quoted, where, db.Limit(limit))
+}
+
+// CastExpr leaves dates and times alone, SQLite stores them as text and a
+// cast to their NUMERIC affinity would turn them into numbers.
+func (db *Sqlite3) CastExpr(expr string, col *Column) string {
+	switch col.Type {
+	case DB_Date, DB_DateTime, DB_TimeStamp, DB_Time:
+		return expr
+	}
+	return db.BaseDialect.CastExpr(expr, col)
+}
+
+// ConstraintExistsSql looks for the named constraint in the CREATE TABLE
+// statement, the name may be quoted or not. Unique constraints created as
+// unique indexes are found by the index name, as DropConstraint drops them.
+func (db *Sqlite3) ConstraintExistsSql(tableName, constraintName string) (string, []interface{}) {
+	name := db.EscapeLike(constraintName)
+	args := []interface{}{tableName, "%CONSTRAINT " + name + " %", "%CONSTRAINT `" + name + "`%", `%CONSTRAINT "` + name + `"%`, tableName, constraintName}
+	like := db.Quote("sql") + " LIKE ? " + db.LikeEscapeStr()
+	sql := "SELECT 1 FROM " + db.Quote("sqlite_master") + " WHERE " + db.Quote("type") + "='table' AND " + db.Quote("name") + "=? AND (" + like + " OR " + like + " OR " + like + ")" +
+		" UNION ALL SELECT 1 FROM " + db.Quote("sqlite_master") + " WHERE " + db.Quote("type") + "='index' AND " + db.Quote("tbl_name") + "=? AND " + db.Quote("name") + "=? AND " + db.Quote("sql") + " LIKE 'CREATE UNIQUE INDEX%'"
+	return sql, args
+}
+
+// SupportsReturning depends on the linked SQLite library, RETURNING needs
+// SQLite 3.35.
+func (db *Sqlite3) SupportsReturning() bool {
+	_, version, _ := sqlite3.Version()
+	return version >= 3035000
+}
+
+// DeleteDuplicatesSql identifies rows by rowid, which every table but
+// WITHOUT ROWID tables has.
+func (db *Sqlite3) DeleteDuplicatesSql(tableName string, index *Index, orderBy string, keyColumn string) string {
+	if orderBy == "" {
+		orderBy = db.Quote(keyColumn)
+	}
+	return db.BaseDialect.DeleteDuplicatesSql(tableName, index, orderBy, "rowid")
+}
+
+// ListTables skips the internal tables of SQLite, such as sqlite_sequence.
+func (db *Sqlite3) ListTables(sess *xorm.Session) ([]string, error) {
+	return tableNames(sess, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' ORDER BY name")
+}
+
+// DescribeTable leaves comments empty, SQLite has no comments.
+func (db *Sqlite3) DescribeTable(sess *xorm.Session, tableName string) (*Table, error) {
+	results, err := sess.Query("PRAGMA table_info(" + db.Quote(tableName) + ")")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	def, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return nil, err
+	}
+	autoIncrement := def.hasAutoIncrement()
+
+	table := &Table{Name: tableName}
+	for _, row := range results {
+		col := &Column{
+			Name:         string(row["name"]),
+			Type:         string(row["type"]),
+			Nullable:     !introspectedBool(row["notnull"]),
+			Default:      string(row["dflt_value"]),
+			IsPrimaryKey: string(row["pk"]) != "0",
+		}
+		if col.IsPrimaryKey {
+			col.IsAutoIncrement = autoIncrement
+			table.PrimaryKeys = append(table.PrimaryKeys, col.Name)
+		}
+		table.Columns = append(table.Columns, col)
+	}
+	return table, nil
+}
+
+// ListIndexes includes the indexes backing UNIQUE constraints, which are
+// named sqlite_autoindex_<table>_<n>.
+func (db *Sqlite3) ListIndexes(sess *xorm.Session, tableName string) ([]*Index, error) {
+	list, err := sess.Query("PRAGMA index_list(" + db.Quote(tableName) + ")")
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := []*Index{}
+	for _, row := range list {
+		if string(row["origin"]) == "pk" {
+			continue
+		}
+
+		index := &Index{Name: string(row["name"]), Type: IndexType}
+		if introspectedBool(row["unique"]) {
+			index.Type = UniqueIndex
+		}
+		cols, err := sess.Query("PRAGMA index_info(" + db.Quote(index.Name) + ")")
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range cols {
+			index.Cols = append(index.Cols, string(col["name"]))
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// ListConstraints parses the constraints from the CREATE TABLE statement,
+// both table constraints and constraints of column definitions. Unnamed
+// constraints have an empty name. Unique indexes created with CREATE UNIQUE
+// INDEX are listed by ListIndexes.
+func (db *Sqlite3) ListConstraints(sess *xorm.Session, tableName string) ([]*Constraint, error) {
+	def, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return nil, err
+	}
+	constraints := []*Constraint{}
+	for _, d := range def.Defs {
+		constraints = append(constraints, sqliteParseConstraints(d)...)
+	}
+	sort.SliceStable(constraints, func(i, j int) bool { return constraints[i].Name < constraints[j].Name })
+	return constraints, nil
+}
+
+// IndexDefinitions reads the CREATE INDEX statements, indexes backing inline
+// UNIQUE constraints have none.
+func (db *Sqlite3) IndexDefinitions(sess *xorm.Session, tableName string) ([]*IndexDefinition, error) {
+	indexes, err := sqliteLoadObjects(sess, "index", tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make([]*IndexDefinition, len(indexes))
+	for i, index := range indexes {
+		definitions[i] = &IndexDefinition{Name: index.Name, CreateSql: index.Sql, DropSql: "DROP INDEX " + db.Quote(index.Name)}
+	}
+	return definitions, nil
+}
+
 func (db *Sqlite3) DropIndexSql(tableName string, index *Index) string {
 	quote := db.Quote
 	//var unique string
@@ -81,6 +359,303 @@ func (db *Sqlite3) DropIndexSql(tableName string, index *Index) string {
 	return fmt.Sprintf("DROP INDEX %v", quote(idxName))
 }
 
+func (db *Sqlite3) ModifyColumnSql(tableName string, col *Column) []string {
+	return nil
+}
+
+// ModifyColumn rebuilds the table with the new column definition.
+func (db *Sqlite3) ModifyColumn(sess *xorm.Session, tableName string, col *Column) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	found := false
+	for i, def := range newDef.Defs {
+		if sqliteIsConstraintDef(def) || !strings.EqualFold(sqliteDefName(def), col.Name) {
+			continue
+		}
+		found = true
+		if col.IsPrimaryKey && strings.Contains(strings.ToUpper(def), "PRIMARY KEY") {
+			newDef.Defs[i] = strings.TrimSpace(col.String(db))
+		} else {
+			newDef.Defs[i] = strings.TrimSpace(col.StringNoPk(db))
+		}
+	}
+	if !found {
+		return fmt.Errorf("column %s not found on table %s", col.Name, tableName)
+	}
+
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+func (db *Sqlite3) DropColumnSql(tableName string, columnName string) []string {
+	return nil
+}
+
+// DropColumn rebuilds the table without the column. Indexes and table
+// constraints covering the column are dropped with it, everything else is
+// recreated. Columns and triggers using the column have to be changed first.
+func (db *Sqlite3) DropColumn(sess *xorm.Session, tableName string, columnName string) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	newDef.Defs = []string{}
+	found := false
+	for _, def := range oldDef.Defs {
+		if sqliteIsConstraintDef(def) {
+			if !sqliteConstraintCovers(def, columnName) {
+				newDef.Defs = append(newDef.Defs, def)
+			}
+			continue
+		}
+
+		name := sqliteDefName(def)
+		if strings.EqualFold(name, columnName) {
+			found = true
+			continue
+		}
+		if sqliteColumnUses(def, columnName) {
+			return fmt.Errorf("column %s of table %s uses column %s", name, tableName, columnName)
+		}
+		newDef.Defs = append(newDef.Defs, def)
+	}
+	if !found {
+		return fmt.Errorf("column %s not found on table %s", columnName, tableName)
+	}
+
+	newDef.Indexes = []sqliteObject{}
+	for _, index := range oldDef.Indexes {
+		if !sqliteIndexCovers(index.Sql, columnName) {
+			newDef.Indexes = append(newDef.Indexes, index)
+		}
+	}
+
+	for _, trigger := range oldDef.Triggers {
+		if sqliteMentions(trigger.Sql, columnName) {
+			return fmt.Errorf("trigger %s of table %s uses column %s", trigger.Name, tableName, columnName)
+		}
+	}
+
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+// ReorderColumns rebuilds the table with the column definitions in the new
+// order, table constraints stay after the columns.
+func (db *Sqlite3) ReorderColumns(sess *xorm.Session, tableName string, columns []string) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	order, changed, err := columnOrder(tableName, oldDef.ColumnNames(), columns)
+	if err != nil || !changed {
+		return err
+	}
+
+	colDefs := map[string]string{}
+	constraintDefs := []string{}
+	for _, def := range oldDef.Defs {
+		if sqliteIsConstraintDef(def) {
+			constraintDefs = append(constraintDefs, def)
+		} else {
+			colDefs[sqliteDefName(def)] = def
+		}
+	}
+
+	newDef := oldDef.clone()
+	newDef.Defs = []string{}
+	for _, name := range order {
+		newDef.Defs = append(newDef.Defs, colDefs[name])
+	}
+	newDef.Defs = append(newDef.Defs, constraintDefs...)
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+func (db *Sqlite3) AddForeignKey(sess *xorm.Session, tableName string, fk *ForeignKey) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	def, err := db.foreignKeyDef(tableName, fk)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	newDef.Defs = append(newDef.Defs, def)
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+// ForeignKeyChecksSql defers the foreign key checks to the commit, since
+// PRAGMA foreign_keys has no effect within the transaction of a migration.
+// Unlike on the other engines, rows still violating a foreign key fail the
+// commit.
+func (db *Sqlite3) ForeignKeyChecksSql(enabled bool) string {
+	if enabled {
+		return "PRAGMA defer_foreign_keys = OFF"
+	}
+	return "PRAGMA defer_foreign_keys = ON"
+}
+
+// SetLockTimeout sets busy_timeout, how long SQLite retries when another
+// connection holds a lock on the database. SQLite locks the whole database
+// rather than tables or rows, and the transaction of a migration waits for
+// it before its first write.
+func (db *Sqlite3) SetLockTimeout(sess *xorm.Session, timeout time.Duration) (string, error) {
+	results, err := sess.Query("PRAGMA busy_timeout")
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("busy_timeout not found")
+	}
+
+	milliseconds := int64((timeout + time.Millisecond - 1) / time.Millisecond)
+	if _, err := sess.Exec(fmt.Sprintf("PRAGMA busy_timeout = %d", milliseconds)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("PRAGMA busy_timeout = %s", results[0]["timeout"]), nil
+}
+
+func (db *Sqlite3) AddCheckConstraint(sess *xorm.Session, tableName string, check *CheckConstraint) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	newDef.Defs = append(newDef.Defs, db.checkConstraintDef(check))
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+// AddPrimaryKey rebuilds the table with a PRIMARY KEY table constraint.
+func (db *Sqlite3) AddPrimaryKey(sess *xorm.Session, tableName string, cols []string) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = db.Quote(col)
+	}
+	newDef := oldDef.clone()
+	newDef.Defs = append(newDef.Defs, "PRIMARY KEY ("+strings.Join(quoted, ", ")+")")
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+// ReplacePrimaryKey rebuilds the table with a PRIMARY KEY table constraint
+// on the columns of the index, without the old primary key and the index. An
+// INTEGER PRIMARY KEY column stops being an alias of the rowid: it keeps its
+// values, but SQLite no longer assigns them to new rows.
+func (db *Sqlite3) ReplacePrimaryKey(sess *xorm.Session, tableName string, oldCols []string, index *Index) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	newDef.Defs = []string{}
+	for _, def := range oldDef.Defs {
+		if !sqliteIsConstraintDef(def) {
+			def = sqliteStripPrimaryKey(def)
+		} else if constraints := sqliteParseConstraints(def); len(constraints) == 1 && constraints[0].Type == ConstraintPrimaryKey {
+			continue
+		}
+		newDef.Defs = append(newDef.Defs, def)
+	}
+	quoted := make([]string, len(index.Cols))
+	for i, col := range index.Cols {
+		quoted[i] = db.Quote(col)
+	}
+	newDef.Defs = append(newDef.Defs, "PRIMARY KEY ("+strings.Join(quoted, ", ")+")")
+
+	newDef.Indexes = []sqliteObject{}
+	for _, existing := range oldDef.Indexes {
+		if !strings.EqualFold(existing.Name, index.Name) {
+			newDef.Indexes = append(newDef.Indexes, existing)
+		}
+	}
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+// DropConstraint rebuilds the table without the named constraint. Unique
+// constraints created as unique indexes are dropped as indexes.
+func (db *Sqlite3) DropConstraint(sess *xorm.Session, tableName string, constraintName string) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	newDef.Defs = []string{}
+	found := false
+	for _, def := range oldDef.Defs {
+		if sqliteIsConstraintDef(def) && strings.EqualFold(sqliteDefName(def), constraintName) {
+			found = true
+			continue
+		}
+		if stripped, ok := sqliteStripColumnConstraint(def, constraintName); ok {
+			found = true
+			def = stripped
+		}
+		newDef.Defs = append(newDef.Defs, def)
+	}
+
+	if !found {
+		for _, index := range oldDef.Indexes {
+			if strings.EqualFold(index.Name, constraintName) {
+				_, err := sess.Exec("DROP INDEX " + db.Quote(index.Name))
+				return err
+			}
+		}
+		return fmt.Errorf("constraint %s not found on table %s", constraintName, tableName)
+	}
+
+	return sqliteRebuildTable(sess, db, oldDef, newDef)
+}
+
+// RenameConstraint rebuilds the table with the constraint renamed. Unique
+// constraints created as unique indexes are recreated under the new name.
+func (db *Sqlite3) RenameConstraint(sess *xorm.Session, tableName string, oldName string, newName string) error {
+	oldDef, err := sqliteLoadTableDef(sess, tableName)
+	if err != nil {
+		return err
+	}
+
+	newDef := oldDef.clone()
+	found := false
+	for i, def := range newDef.Defs {
+		if renamed, ok := sqliteRenameObject(def, []string{"CONSTRAINT"}, oldName, db.Quote(newName)); ok {
+			newDef.Defs[i] = renamed
+			found = true
+		}
+	}
+	if found {
+		return sqliteRebuildTable(sess, db, oldDef, newDef)
+	}
+
+	for _, index := range oldDef.Indexes {
+		if !strings.EqualFold(index.Name, oldName) {
+			continue
+		}
+		renamed, _ := sqliteRenameObject(index.Sql, []string{"INDEX", "EXISTS"}, oldName, db.Quote(newName))
+		if _, err := sess.Exec("DROP INDEX " + db.Quote(index.Name)); err != nil {
+			return err
+		}
+		_, err := sess.Exec(renamed)
+		return err
+	}
+
+	return fmt.Errorf("constraint %s not found on table %s", oldName, tableName)
+}
+
 func (db *Sqlite3) CleanDB() error {
 	return nil
 }
@@ -0,0 +1,262 @@
+package migrator
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSqliteDropColumn(t *testing.T) {
+	Convey("Dropping a column on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		sess := x.NewSession()
+		defer sess.Close()
+
+		Convey("keeps the indexes, constraints and triggers not covering it", func() {
+			execTestSql(x,
+				"CREATE TABLE org (id INTEGER PRIMARY KEY)",
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY AUTOINCREMENT, org_id INTEGER NOT NULL DEFAULT 1, slug TEXT CHECK (length(slug) < 100), title TEXT, legacy TEXT, "+
+					"CONSTRAINT fk_org FOREIGN KEY (org_id) REFERENCES org (id), CONSTRAINT uq_legacy UNIQUE (org_id, legacy))",
+				"CREATE UNIQUE INDEX UQE_dashboard_org_id_slug ON dashboard (org_id, slug)",
+				"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+				"CREATE INDEX IDX_dashboard_org_id_legacy ON dashboard (org_id, legacy)",
+				"CREATE INDEX IDX_dashboard_partial ON dashboard (title) WHERE legacy IS NOT NULL",
+				"CREATE TRIGGER dashboard_slug AFTER INSERT ON dashboard BEGIN UPDATE dashboard SET slug = lower(title) WHERE id = NEW.id; END",
+				"INSERT INTO org (id) VALUES (1)",
+				"INSERT INTO dashboard (slug, title, legacy) VALUES ('a', 'A', 'x')",
+			)
+
+			So(NewDialect(x).DropColumn(sess, "dashboard", "legacy"), ShouldBeNil)
+
+			def, err := sqliteLoadTableDef(sess, "dashboard")
+			So(err, ShouldBeNil)
+			So(def.HasColumn("legacy"), ShouldBeFalse)
+
+			indexes := []string{}
+			for _, index := range def.Indexes {
+				indexes = append(indexes, index.Name)
+			}
+			So(indexes, ShouldResemble, []string{"UQE_dashboard_org_id_slug", "IDX_dashboard_title"})
+			So(def.Triggers, ShouldHaveLength, 1)
+			So(def.Triggers[0].Name, ShouldEqual, "dashboard_slug")
+
+			create := strings.Join(def.Defs, ", ")
+			for _, part := range []string{"AUTOINCREMENT", "DEFAULT 1", "CHECK (length(slug) < 100)", "CONSTRAINT fk_org FOREIGN KEY"} {
+				So(create, ShouldContainSubstring, part)
+			}
+			So(create, ShouldNotContainSubstring, "uq_legacy")
+
+			results, err := x.QueryString("SELECT id, org_id, slug, title FROM dashboard")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"id": "1", "org_id": "1", "slug": "a", "title": "A"}})
+
+			_, err = x.Exec("INSERT INTO dashboard (org_id, slug, title) VALUES (1, 'a', 'B')")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("keeps views selecting from the table working", func() {
+			execTestSql(x,
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT, legacy TEXT)",
+				"CREATE VIEW dashboard_title AS SELECT title FROM dashboard",
+				"INSERT INTO dashboard (title, legacy) VALUES ('A', 'x')",
+			)
+
+			So(NewDialect(x).DropColumn(sess, "dashboard", "legacy"), ShouldBeNil)
+
+			results, err := x.QueryString("SELECT title FROM dashboard_title")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"title": "A"}})
+		})
+
+		Convey("fails if a trigger uses it", func() {
+			execTestSql(x,
+				"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, slug TEXT, title TEXT)",
+				"CREATE TRIGGER dashboard_slug AFTER INSERT ON dashboard BEGIN UPDATE dashboard SET slug = lower(title) WHERE id = NEW.id; END",
+			)
+
+			So(NewDialect(x).DropColumn(sess, "dashboard", "title"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSqliteListConstraints(t *testing.T) {
+	Convey("Listing the constraints of a table on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE org (id INTEGER PRIMARY KEY, name TEXT, UNIQUE (name))",
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY AUTOINCREMENT, org_id INTEGER NOT NULL REFERENCES org (id), "+
+				"slug TEXT CONSTRAINT chk_slug CHECK (length(slug) < 100), org_name TEXT, "+
+				"CONSTRAINT `fk_org_name` FOREIGN KEY (org_id, org_name) REFERENCES org (id, name) ON DELETE CASCADE, "+
+				"CONSTRAINT uq_slug UNIQUE (org_id, slug COLLATE NOCASE))",
+		)
+
+		sess := x.NewSession()
+		defer sess.Close()
+		constraints, err := NewDialect(x).ListConstraints(sess, "dashboard")
+		So(err, ShouldBeNil)
+
+		found := []string{}
+		for _, c := range constraints {
+			found = append(found, c.Name+" "+c.Type+" ("+strings.Join(c.Cols, ", ")+") "+c.RefTable+" ("+strings.Join(c.RefCols, ", ")+")")
+		}
+		So(found, ShouldResemble, []string{
+			" PRIMARY KEY (id)  ()",
+			" FOREIGN KEY (org_id) org (id)",
+			"chk_slug CHECK (slug)  ()",
+			"fk_org_name FOREIGN KEY (org_id, org_name) org (id, name)",
+			"uq_slug UNIQUE (org_id, slug)  ()",
+		})
+	})
+}
+
+func TestSqliteReorderColumns(t *testing.T) {
+	Convey("Reordering columns on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, org_id INTEGER NOT NULL DEFAULT 1, slug TEXT, CONSTRAINT uq_slug UNIQUE (org_id, slug))",
+			"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+			"INSERT INTO dashboard (title, org_id, slug) VALUES ('A', 2, 'a')",
+		)
+
+		sess := x.NewSession()
+		defer sess.Close()
+		dialect := NewDialect(x)
+
+		Convey("moves the given columns first and keeps the rest", func() {
+			So(dialect.ReorderColumns(sess, "dashboard", []string{"id", "org_id"}), ShouldBeNil)
+
+			def, err := sqliteLoadTableDef(sess, "dashboard")
+			So(err, ShouldBeNil)
+			So(def.ColumnNames(), ShouldResemble, []string{"id", "org_id", "title", "slug"})
+			So(def.Indexes, ShouldHaveLength, 1)
+			So(def.Indexes[0].Name, ShouldEqual, "IDX_dashboard_title")
+
+			results, err := x.QueryString("SELECT id, org_id, title, slug FROM dashboard")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"id": "1", "org_id": "2", "title": "A", "slug": "a"}})
+		})
+
+		Convey("fails for missing columns", func() {
+			So(dialect.ReorderColumns(sess, "dashboard", []string{"missing"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSqliteBulkLoad(t *testing.T) {
+	Convey("Bulk loading rows on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x, "CREATE TABLE tag (id INTEGER PRIMARY KEY, term TEXT, note TEXT)")
+
+		rows := "id\tterm\tnote\n"
+		for i := 1; i <= 400; i++ {
+			rows += strconv.Itoa(i) + "\t\"say \"\"hi\"\"\"\t\\N\n"
+		}
+
+		sess := x.NewSession()
+		defer sess.Close()
+		data := &DelimitedData{Columns: []string{"id", "term", "note"}, Comma: '\t', Header: true}
+		loaded, err := NewDialect(x).BulkLoad(sess, "tag", data, strings.NewReader(rows))
+		So(err, ShouldBeNil)
+		So(loaded, ShouldEqual, 400)
+
+		results, err := sess.QueryString("SELECT count(*) AS total, count(note) AS notes, max(term) AS term FROM tag")
+		So(err, ShouldBeNil)
+		So(results[0], ShouldResemble, map[string]string{"total": "400", "notes": "0", "term": `say "hi"`})
+	})
+}
+
+func TestSqliteRebuildKeepsAutoIncrementSequence(t *testing.T) {
+	Convey("Rebuilding a table on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, legacy TEXT)",
+			"INSERT INTO dashboard (title) VALUES ('a'), ('b'), ('c')",
+			"DELETE FROM dashboard WHERE id = 3",
+		)
+		dialect := NewDialect(x)
+		sess := x.NewSession()
+		defer sess.Close()
+
+		shouldNotReuseDeletedIds := func() {
+			execTestSql(x, "INSERT INTO dashboard (title) VALUES ('d')")
+			results, err := x.QueryString("SELECT id FROM dashboard WHERE title = 'd'")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"id": "4"}})
+		}
+
+		Convey("to drop a column keeps the sequence", func() {
+			So(dialect.DropColumn(sess, "dashboard", "legacy"), ShouldBeNil)
+			shouldNotReuseDeletedIds()
+		})
+
+		Convey("to add a check constraint keeps the sequence", func() {
+			So(dialect.AddCheckConstraint(sess, "dashboard", &CheckConstraint{Name: "chk_title", Expr: "length(title) < 100"}), ShouldBeNil)
+			shouldNotReuseDeletedIds()
+		})
+	})
+}
+
+func TestSqliteRebuildReferencedTable(t *testing.T) {
+	Convey("Rebuilding a table other tables reference on SQLite", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE org (id INTEGER PRIMARY KEY, name TEXT)",
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, org_id INTEGER REFERENCES org (id) ON DELETE CASCADE)",
+			"INSERT INTO org (id, name) VALUES (1, 'main')",
+			"INSERT INTO dashboard (org_id) VALUES (1), (1)",
+		)
+		mg.AddMigration("widen org name", NewModifyColumnMigration(Table{Name: "org"}, &Column{Name: "name", Type: DB_NVarchar, Length: 255, Nullable: true}))
+
+		shouldKeepDashboards := func() {
+			count, err := x.Table("dashboard").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		}
+
+		Convey("fails when foreign keys are enforced", func() {
+			execTestSql(x, "PRAGMA foreign_keys = ON")
+			err := mg.Start()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "referenced by table dashboard")
+			shouldKeepDashboards()
+		})
+
+		Convey("works when foreign keys aren't enforced", func() {
+			So(mg.Start(), ShouldBeNil)
+			shouldKeepDashboards()
+		})
+	})
+}
+
+func TestSqliteSetAutoIncrementStart(t *testing.T) {
+	Convey("Setting the auto increment start on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		sess := x.NewSession()
+		defer sess.Close()
+		dialect := NewDialect(x)
+		id := &Column{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true}
+
+		Convey("sets the next id of AUTOINCREMENT columns", func() {
+			execTestSql(x, "CREATE TABLE `we'ird` (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT)")
+			So(dialect.SetAutoIncrementStart(sess, "we'ird", id, 101), ShouldBeNil)
+
+			execTestSql(x, "INSERT INTO `we'ird` (title) VALUES ('a')")
+			results, err := x.QueryString("SELECT id FROM `we'ird`")
+			So(err, ShouldBeNil)
+			So(results, ShouldResemble, []map[string]string{{"id": "101"}})
+		})
+
+		Convey("rejects columns without AUTOINCREMENT", func() {
+			execTestSql(x, "CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)")
+			err := dialect.SetAutoIncrementStart(sess, "dashboard", id, 101)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "not an AUTOINCREMENT column")
+
+			exists, err := sqliteHasSequenceTable(sess)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,647 @@
+package migrator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-xorm/xorm"
+)
+
+// SQLite only supports a small subset of ALTER TABLE, so structural changes
+// such as dropping a constraint are done by rebuilding the table: create a new
+// table from a rewritten definition, copy the rows, drop the old table, rename
+// the new one into place and recreate its indexes and triggers.
+// See https://www.sqlite.org/lang_altertable.html#otheralter
+
+type sqliteObject struct {
+	Name string
+	Sql  string
+}
+
+type sqliteTableDef struct {
+	Name     string
+	Defs     []string
+	Options  string
+	Indexes  []sqliteObject
+	Triggers []sqliteObject
+}
+
+func sqliteLoadTableDef(sess *xorm.Session, tableName string) (*sqliteTableDef, error) {
+	results, err := sess.SQL("SELECT sql FROM sqlite_master WHERE type='table' AND name=?", tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	def, err := sqliteParseCreateTable(string(results[0]["sql"]))
+	if err != nil {
+		return nil, err
+	}
+	def.Name = tableName
+
+	if def.Indexes, err = sqliteLoadObjects(sess, "index", tableName); err != nil {
+		return nil, err
+	}
+	if def.Triggers, err = sqliteLoadObjects(sess, "trigger", tableName); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+func sqliteLoadObjects(sess *xorm.Session, objectType string, tableName string) ([]sqliteObject, error) {
+	// auto indexes backing inline UNIQUE/PRIMARY KEY constraints have no sql
+	// and are recreated together with the table
+	results, err := sess.SQL("SELECT name, sql FROM sqlite_master WHERE type=? AND tbl_name=? AND sql IS NOT NULL", objectType, tableName).Query()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]sqliteObject, 0, len(results))
+	for _, row := range results {
+		objects = append(objects, sqliteObject{Name: string(row["name"]), Sql: string(row["sql"])})
+	}
+	return objects, nil
+}
+
+func sqliteParseCreateTable(sql string) (*sqliteTableDef, error) {
+	start := strings.Index(sql, "(")
+	if start == -1 {
+		return nil, fmt.Errorf("unable to parse table definition: %s", sql)
+	}
+
+	def := &sqliteTableDef{}
+	depth, last := 0, start+1
+	for i := start; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '\'', '"', '`', '[':
+			i = sqliteSkipQuoted(sql, i)
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				def.Defs = append(def.Defs, strings.TrimSpace(sql[last:i]))
+				def.Options = strings.TrimSpace(sql[i+1:])
+				return def, nil
+			}
+		case ',':
+			if depth == 1 {
+				def.Defs = append(def.Defs, strings.TrimSpace(sql[last:i]))
+				last = i + 1
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unable to parse table definition: %s", sql)
+}
+
+// sqliteSkipQuoted returns the position of the character closing the quoted
+// identifier or string literal starting at pos.
+func sqliteSkipQuoted(sql string, pos int) int {
+	closing := sql[pos]
+	if closing == '[' {
+		closing = ']'
+	}
+	for i := pos + 1; i < len(sql); i++ {
+		if sql[i] == closing {
+			// doubled quote characters are escapes
+			if i+1 < len(sql) && sql[i+1] == closing && closing != ']' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql) - 1
+}
+
+// sqliteTokens splits a column or constraint definition into tokens, keeping
+// quoted names and parenthesized groups together.
+func sqliteTokens(def string) []string {
+	tokens := []string{}
+	for i := 0; i < len(def); i++ {
+		c := def[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := sqliteSkipQuoted(def, i)
+			tokens = append(tokens, def[i:end+1])
+			i = end
+		case c == '(':
+			depth, end := 0, len(def)-1
+			for j := i; j < len(def); j++ {
+				if def[j] == '\'' || def[j] == '"' || def[j] == '`' {
+					j = sqliteSkipQuoted(def, j)
+				} else if def[j] == '(' {
+					depth++
+				} else if def[j] == ')' {
+					depth--
+					if depth == 0 {
+						end = j
+						break
+					}
+				}
+			}
+			tokens = append(tokens, def[i:end+1])
+			i = end
+		default:
+			end := i
+			for end < len(def) && !strings.ContainsRune(" \t\n\r(", rune(def[end])) {
+				end++
+			}
+			tokens = append(tokens, def[i:end])
+			i = end - 1
+		}
+	}
+	return tokens
+}
+
+func sqliteUnquote(name string) string {
+	if len(name) >= 2 {
+		switch name[0] {
+		case '`', '"', '\'':
+			return strings.Replace(name[1:len(name)-1], name[:1]+name[:1], name[:1], -1)
+		case '[':
+			return name[1 : len(name)-1]
+		}
+	}
+	return name
+}
+
+var sqliteTableConstraintKeywords = []string{"CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN"}
+
+// sqliteIsConstraintDef reports whether def is a table constraint rather than
+// a column definition.
+func sqliteIsConstraintDef(def string) bool {
+	tokens := sqliteTokens(def)
+	if len(tokens) == 0 {
+		return false
+	}
+	first := strings.ToUpper(tokens[0])
+	for _, keyword := range sqliteTableConstraintKeywords {
+		if first == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteDefName returns the column name of a column definition, or the
+// constraint name of a named table constraint.
+func sqliteDefName(def string) string {
+	tokens := sqliteTokens(def)
+	if len(tokens) == 0 {
+		return ""
+	}
+	if strings.ToUpper(tokens[0]) == "CONSTRAINT" {
+		if len(tokens) > 1 {
+			return sqliteUnquote(tokens[1])
+		}
+		return ""
+	}
+	if sqliteIsConstraintDef(def) {
+		return ""
+	}
+	return sqliteUnquote(tokens[0])
+}
+
+var sqliteColumnConstraintKeywords = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+// sqliteStripColumnConstraint removes the named constraint from a column
+// definition, returning false if the column has no such constraint.
+func sqliteStripColumnConstraint(def string, constraintName string) (string, bool) {
+	tokens := sqliteTokens(def)
+	for i := 1; i < len(tokens)-1; i++ {
+		if strings.ToUpper(tokens[i]) != "CONSTRAINT" || !strings.EqualFold(sqliteUnquote(tokens[i+1]), constraintName) {
+			continue
+		}
+
+		// skip the keyword opening the constraint body (both words of NOT NULL)
+		end := i + 3
+		if i+2 < len(tokens) && strings.ToUpper(tokens[i+2]) == "NOT" {
+			end++
+		}
+		for ; end < len(tokens); end++ {
+			if sqliteIsColumnConstraintStart(tokens, end) {
+				break
+			}
+		}
+
+		result := append(append([]string{}, tokens[:i]...), tokens[end:]...)
+		return strings.Join(result, " "), true
+	}
+	return def, false
+}
+
+// sqliteStripPrimaryKey removes the PRIMARY KEY constraint from a column
+// definition, including its sort order, conflict clause and AUTOINCREMENT.
+func sqliteStripPrimaryKey(def string) string {
+	tokens := sqliteTokens(def)
+	for i := 1; i < len(tokens)-1; i++ {
+		if strings.ToUpper(tokens[i]) != "PRIMARY" || strings.ToUpper(tokens[i+1]) != "KEY" {
+			continue
+		}
+
+		start := i
+		if i >= 3 && strings.ToUpper(tokens[i-2]) == "CONSTRAINT" {
+			start = i - 2
+		}
+		end := i + 2
+		for ; end < len(tokens); end++ {
+			if sqliteIsColumnConstraintStart(tokens, end) {
+				break
+			}
+		}
+
+		result := append(append([]string{}, tokens[:start]...), tokens[end:]...)
+		return strings.Join(result, " ")
+	}
+	return def
+}
+
+// sqliteRenameObject replaces the name following one of the keywords in a
+// definition or CREATE statement, returning false if the name is not found.
+func sqliteRenameObject(def string, keywords []string, oldName string, newName string) (string, bool) {
+	tokens := sqliteTokens(def)
+	for i := 1; i < len(tokens); i++ {
+		if !strings.EqualFold(sqliteUnquote(tokens[i]), oldName) {
+			continue
+		}
+		for _, keyword := range keywords {
+			if strings.EqualFold(tokens[i-1], keyword) {
+				tokens[i] = newName
+				return strings.Join(tokens, " "), true
+			}
+		}
+	}
+	return def, false
+}
+
+func sqliteIsColumnConstraintStart(tokens []string, pos int) bool {
+	token := strings.ToUpper(tokens[pos])
+	// NOT DEFERRABLE belongs to a foreign key clause
+	if token == "NOT" && pos+1 < len(tokens) && strings.ToUpper(tokens[pos+1]) == "DEFERRABLE" {
+		return false
+	}
+	for _, keyword := range sqliteColumnConstraintKeywords {
+		if token == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteParseConstraints returns the constraints of a table constraint or
+// column definition. Column constraints other than primary key, unique,
+// check and references, e.g. NOT NULL, are skipped.
+func sqliteParseConstraints(def string) []*Constraint {
+	tokens := sqliteTokens(def)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	column, start := "", 0
+	if !sqliteIsConstraintDef(def) {
+		column, start = sqliteUnquote(tokens[0]), 1
+	}
+
+	constraints := []*Constraint{}
+	for i := start; i < len(tokens); i++ {
+		name := ""
+		if strings.ToUpper(tokens[i]) == "CONSTRAINT" && i+2 < len(tokens) {
+			name = sqliteUnquote(tokens[i+1])
+			i += 2
+		}
+
+		constraint := &Constraint{Name: name}
+		switch strings.ToUpper(tokens[i]) {
+		case "PRIMARY":
+			constraint.Type = ConstraintPrimaryKey
+		case "UNIQUE":
+			constraint.Type = ConstraintUnique
+		case "CHECK":
+			constraint.Type = ConstraintCheck
+		case "FOREIGN", "REFERENCES":
+			constraint.Type = ConstraintForeignKey
+		default:
+			continue
+		}
+
+		if column != "" {
+			constraint.Cols = []string{column}
+		} else {
+			for i+1 < len(tokens) && !strings.HasPrefix(tokens[i+1], "(") {
+				i++
+			}
+			if i+1 < len(tokens) {
+				i++
+				if constraint.Type != ConstraintCheck {
+					constraint.Cols = sqliteColumnList(tokens[i])
+				}
+			}
+		}
+
+		if constraint.Type == ConstraintForeignKey {
+			for i < len(tokens) && strings.ToUpper(tokens[i]) != "REFERENCES" {
+				i++
+			}
+			if i+1 < len(tokens) {
+				i++
+				constraint.RefTable = sqliteUnquote(tokens[i])
+				if i+1 < len(tokens) && strings.HasPrefix(tokens[i+1], "(") {
+					i++
+					constraint.RefCols = sqliteColumnList(tokens[i])
+				}
+			}
+		}
+
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
+
+// sqliteColumnList returns the column names of a parenthesized list of
+// indexed columns, without their collation or sort order.
+func sqliteColumnList(list string) []string {
+	cols := []string{}
+	for _, part := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(list, "("), ")"), ",") {
+		if tokens := sqliteTokens(part); len(tokens) > 0 {
+			cols = append(cols, sqliteUnquote(tokens[0]))
+		}
+	}
+	return cols
+}
+
+// sqliteIndexCovers reports whether the CREATE INDEX statement uses the
+// column, in its column list or the WHERE clause of a partial index.
+func sqliteIndexCovers(indexSql string, columnName string) bool {
+	start := strings.Index(indexSql, "(")
+	if start == -1 {
+		return false
+	}
+	return sqliteMentions(indexSql[start:], columnName)
+}
+
+// sqliteConstraintCovers reports whether the table constraint uses the
+// column. Only the own columns of a foreign key are compared, not the
+// referenced ones.
+func sqliteConstraintCovers(def string, columnName string) bool {
+	foreignKey := false
+	for _, token := range sqliteTokens(def) {
+		if strings.ToUpper(token) == "FOREIGN" {
+			foreignKey = true
+		}
+		if !strings.HasPrefix(token, "(") {
+			continue
+		}
+		if sqliteMentions(token, columnName) {
+			return true
+		}
+		if foreignKey {
+			return false
+		}
+	}
+	return false
+}
+
+// sqliteColumnUses reports whether a column definition uses another column,
+// e.g. in a CHECK constraint or as a generated column.
+func sqliteColumnUses(def string, columnName string) bool {
+	for _, token := range sqliteTokens(def)[1:] {
+		if strings.HasPrefix(token, "(") && sqliteMentions(token, columnName) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteMentions reports whether the name appears as an identifier in sql,
+// quoted or not, outside of string literals.
+func sqliteMentions(sql string, name string) bool {
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			i = sqliteSkipQuoted(sql, i)
+		case c == '"' || c == '`' || c == '[':
+			end := sqliteSkipQuoted(sql, i)
+			if strings.EqualFold(sqliteUnquote(sql[i:end+1]), name) {
+				return true
+			}
+			i = end
+		case sqliteIsIdentifierChar(c):
+			end := i
+			for end < len(sql) && sqliteIsIdentifierChar(sql[end]) {
+				end++
+			}
+			if strings.EqualFold(sql[i:end], name) {
+				return true
+			}
+			i = end - 1
+		}
+	}
+	return false
+}
+
+func sqliteIsIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func (t *sqliteTableDef) ColumnNames() []string {
+	names := []string{}
+	for _, def := range t.Defs {
+		if !sqliteIsConstraintDef(def) {
+			names = append(names, sqliteDefName(def))
+		}
+	}
+	return names
+}
+
+func (t *sqliteTableDef) HasColumn(name string) bool {
+	for _, col := range t.ColumnNames() {
+		if strings.EqualFold(col, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *sqliteTableDef) CreateSql(d Dialect, tableName string) string {
+	sql := "CREATE TABLE " + d.Quote(tableName) + " (\n" + strings.Join(t.Defs, "\n, ") + ")"
+	if t.Options != "" {
+		sql += " " + t.Options
+	}
+	return sql
+}
+
+// sqliteRebuildTable replaces the table described by oldDef with newDef,
+// copying the columns the two definitions have in common.
+func sqliteRebuildTable(sess *xorm.Session, d Dialect, oldDef *sqliteTableDef, newDef *sqliteTableDef) error {
+	tmpName := newDef.Name + "_tmp_rebuild"
+
+	if err := sqliteCheckNotReferenced(sess, d, oldDef.Name); err != nil {
+		return err
+	}
+
+	// dropping the old table deletes its sequence, copying the rows only
+	// raises the new one to the largest id left
+	seq, hasSeq, err := sqliteSequence(sess, oldDef.Name)
+	if err != nil {
+		return err
+	}
+
+	cols := []string{}
+	for _, col := range newDef.ColumnNames() {
+		if oldDef.HasColumn(col) {
+			cols = append(cols, col)
+		}
+	}
+
+	statements := []string{
+		d.DropTable(tmpName),
+		newDef.CreateSql(d, tmpName),
+		d.CopyTableData(oldDef.Name, tmpName, cols, cols),
+		"DROP TABLE " + d.Quote(oldDef.Name),
+	}
+	statements = append(statements, sqliteRenameIntoPlaceSql(d, tmpName, newDef.Name)...)
+	for _, index := range newDef.Indexes {
+		statements = append(statements, index.Sql)
+	}
+	for _, trigger := range newDef.Triggers {
+		statements = append(statements, trigger.Sql)
+	}
+
+	for _, sql := range statements {
+		if _, err := sess.Exec(sql); err != nil {
+			return fmt.Errorf("rebuild of table %s failed: %v, sql: %s", oldDef.Name, err, sql)
+		}
+	}
+
+	if hasSeq && newDef.hasAutoIncrement() {
+		return sqliteRaiseSequence(sess, newDef.Name, seq)
+	}
+	return nil
+}
+
+// sqliteRenameIntoPlaceSql renames a new table to the name of the table it
+// replaces, which was dropped. Since SQLite 3.26 the rename fails on views and
+// triggers still referring to the dropped table unless legacy_alter_table is
+// on, which leaves them and foreign keys of other tables to find the new one.
+func sqliteRenameIntoPlaceSql(d Dialect, newTableName string, tableName string) []string {
+	return []string{
+		"PRAGMA legacy_alter_table = ON",
+		d.RenameTable(newTableName, tableName),
+		"PRAGMA legacy_alter_table = OFF",
+	}
+}
+
+// sqliteCheckNotReferenced fails if foreign keys are enforced and other tables
+// reference the table. Dropping the old table then deletes its rows first,
+// which cascades into or fails on the referencing rows, and PRAGMA
+// foreign_keys can't be turned off within the transaction of a migration.
+func sqliteCheckNotReferenced(sess *xorm.Session, d Dialect, tableName string) error {
+	referencing, err := sqliteEnforcedReferences(sess, d, tableName)
+	if err != nil || len(referencing) == 0 {
+		return err
+	}
+	return fmt.Errorf("unable to rebuild table %s, it is referenced by table %s and foreign keys are enforced", tableName, referencing[0])
+}
+
+// sqliteEnforcedReferences returns the other tables with a foreign key
+// referencing the table if PRAGMA foreign_keys is on, none otherwise.
+func sqliteEnforcedReferences(sess *xorm.Session, d Dialect, tableName string) ([]string, error) {
+	results, err := sess.Query("PRAGMA foreign_keys")
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || string(results[0]["foreign_keys"]) != "1" {
+		return nil, nil
+	}
+
+	tables, err := sess.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name <> ? ORDER BY name", tableName)
+	if err != nil {
+		return nil, err
+	}
+	referencing := []string{}
+	for _, table := range tables {
+		name := string(table["name"])
+		keys, err := sess.Query("PRAGMA foreign_key_list(" + d.Quote(name) + ")")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if strings.EqualFold(string(key["table"]), tableName) {
+				referencing = append(referencing, name)
+				break
+			}
+		}
+	}
+	return referencing, nil
+}
+
+// hasAutoIncrement tells whether the table has an AUTOINCREMENT column, which
+// SQLite keeps a sequence in sqlite_sequence for.
+func (t *sqliteTableDef) hasAutoIncrement() bool {
+	for _, def := range t.Defs {
+		if !sqliteIsConstraintDef(def) && strings.Contains(strings.ToUpper(def), "AUTOINCREMENT") {
+			return true
+		}
+	}
+	return false
+}
+
+// isAutoIncrement reports whether the column is declared AUTOINCREMENT.
+func (t *sqliteTableDef) isAutoIncrement(columnName string) bool {
+	for _, def := range t.Defs {
+		if !sqliteIsConstraintDef(def) && strings.EqualFold(sqliteDefName(def), columnName) {
+			return strings.Contains(strings.ToUpper(def), "AUTOINCREMENT")
+		}
+	}
+	return false
+}
+
+// sqliteHasSequenceTable reports whether sqlite_sequence exists, it is only
+// created once a table with an AUTOINCREMENT column was created.
+func sqliteHasSequenceTable(sess *xorm.Session) (bool, error) {
+	results, err := sess.Query("SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'")
+	return len(results) > 0, err
+}
+
+// sqliteSequence returns the largest id the AUTOINCREMENT column of a table
+// ever used. sqlite_sequence has no row for tables nothing was inserted into.
+func sqliteSequence(sess *xorm.Session, tableName string) (int64, bool, error) {
+	exists, err := sqliteHasSequenceTable(sess)
+	if err != nil || !exists {
+		return 0, false, err
+	}
+
+	results, err := sess.Query("SELECT seq FROM sqlite_sequence WHERE name = ?", tableName)
+	if err != nil || len(results) == 0 {
+		return 0, false, err
+	}
+	seq, err := strconv.ParseInt(string(results[0]["seq"]), 10, 64)
+	return seq, err == nil, err
+}
+
+// sqliteRaiseSequence raises the sequence of a table to seq, creating its row
+// if the table has none.
+func sqliteRaiseSequence(sess *xorm.Session, tableName string, seq int64) error {
+	if _, err := sess.Exec("INSERT INTO sqlite_sequence (name, seq) SELECT ?, 0 WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = ?)", tableName, tableName); err != nil {
+		return err
+	}
+	_, err := sess.Exec("UPDATE sqlite_sequence SET seq = ? WHERE name = ? AND seq < ?", seq, tableName, seq)
+	return err
+}
+
+func (t *sqliteTableDef) clone() *sqliteTableDef {
+	c := *t
+	c.Defs = append([]string{}, t.Defs...)
+	c.Indexes = append([]sqliteObject{}, t.Indexes...)
+	c.Triggers = append([]sqliteObject{}, t.Triggers...)
+	return &c
+}
@@ -0,0 +1,48 @@
+package migrator
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-xorm/xorm"
+)
+
+// TableSize returns the number of rows of a table and its size in bytes,
+// indexes included, e.g. to choose between changing a table at once or in
+// batches. The numbers come from the statistics of MySQL and Postgres and are
+// approximate there, see Dialect.TableSizeSql. SQLite counts the rows, which
+// reads the whole table, and reports the size only if it was compiled with
+// the dbstat virtual table, otherwise the size is -1.
+func TableSize(sess *xorm.Session, mg *Migrator, tableName string) (rows int64, bytes int64, err error) {
+	sql, args := mg.Dialect.TableSizeSql(tableName)
+	results, err := sess.SQL(sql, args...).Query()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(results) == 0 {
+		return 0, 0, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	if rows, err = strconv.ParseInt(string(results[0]["row_count"]), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	size := results[0]["byte_size"]
+	if len(size) == 0 && mg.Dialect.DriverName() == SQLITE && sqliteHasDbstat(sess) {
+		results, err := sess.SQL("SELECT SUM(pgsize) AS byte_size FROM dbstat WHERE name IN (SELECT name FROM sqlite_master WHERE tbl_name = ?)", tableName).Query()
+		if err != nil {
+			return 0, 0, err
+		}
+		size = results[0]["byte_size"]
+	}
+	if len(size) == 0 {
+		return rows, -1, nil
+	}
+
+	bytes, err = strconv.ParseInt(string(size), 10, 64)
+	return rows, bytes, err
+}
+
+func sqliteHasDbstat(sess *xorm.Session) bool {
+	_, err := sess.Exec("SELECT 1 FROM dbstat LIMIT 1")
+	return err == nil
+}
@@ -0,0 +1,31 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSqliteTableSize(t *testing.T) {
+	Convey("Reading the size of a table on SQLite", t, func() {
+		x := newSqliteTestEngine(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+			"CREATE INDEX IDX_dashboard_title ON dashboard (title)",
+			"INSERT INTO dashboard (title) VALUES ('a'), ('b'), ('c')",
+		)
+
+		sess := x.NewSession()
+		defer sess.Close()
+		rows, bytes, err := TableSize(sess, NewMigrator(x), "dashboard")
+		So(err, ShouldBeNil)
+		So(rows, ShouldEqual, 3)
+
+		// dbstat is a compile time option
+		if sqliteHasDbstat(sess) {
+			So(bytes, ShouldBeGreaterThan, 0)
+		} else {
+			So(bytes, ShouldEqual, -1)
+		}
+	})
+}
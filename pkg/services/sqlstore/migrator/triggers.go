@@ -0,0 +1,135 @@
+package migrator
+
+import (
+	"fmt"
+)
+
+// CreateTriggerMigration creates a row level trigger from a per dialect body:
+//
+//   - MySQL: the statements run for each row, e.g. SET NEW.x = ...
+//   - SQLite: the statements between BEGIN and END, e.g. UPDATE ... WHERE id = NEW.id
+//   - Postgres: the plpgsql body of the trigger function, the dialect adds the
+//     function declaration and RETURN NEW (OLD for delete triggers)
+type CreateTriggerMigration struct {
+	MigrationBase
+	tableName string
+	trigger   *Trigger
+	body      map[string]string
+}
+
+func NewCreateTriggerMigration(tableName string, trigger *Trigger) *CreateTriggerMigration {
+	return &CreateTriggerMigration{tableName: tableName, trigger: trigger, body: make(map[string]string)}
+}
+
+func (m *CreateTriggerMigration) Default(body string) *CreateTriggerMigration {
+	m.body["default"] = body
+	return m
+}
+
+func (m *CreateTriggerMigration) Sqlite(body string) *CreateTriggerMigration {
+	m.body[SQLITE] = body
+	return m
+}
+
+func (m *CreateTriggerMigration) Mysql(body string) *CreateTriggerMigration {
+	m.body[MYSQL] = body
+	return m
+}
+
+func (m *CreateTriggerMigration) Postgres(body string) *CreateTriggerMigration {
+	m.body[POSTGRES] = body
+	return m
+}
+
+func (m *CreateTriggerMigration) Validate(mg *Migrator) error {
+	if dialectSql(m.body).forDialect(mg.Dialect) == "" {
+		return fmt.Errorf("trigger %s has no body for %s", m.trigger.Name, mg.Dialect.DriverName())
+	}
+	return nil
+}
+
+func (m *CreateTriggerMigration) SqlStatements(dialect Dialect) []string {
+	return dialect.CreateTriggerSql(m.tableName, m.trigger, dialectSql(m.body).forDialect(dialect))
+}
+
+func (m *CreateTriggerMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.SqlStatements(dialect))
+}
+
+func (m *CreateTriggerMigration) String() string {
+	return fmt.Sprintf("CreateTrigger %s %s %s ON %s", m.trigger.Name, m.trigger.Timing, m.trigger.Event, m.tableName)
+}
+
+type DropTriggerMigration struct {
+	MigrationBase
+	tableName   string
+	triggerName string
+}
+
+func NewDropTriggerMigration(tableName string, triggerName string) *DropTriggerMigration {
+	return &DropTriggerMigration{tableName: tableName, triggerName: triggerName}
+}
+
+func (m *DropTriggerMigration) SqlStatements(dialect Dialect) []string {
+	return dialect.DropTriggerSql(m.tableName, m.triggerName)
+}
+
+func (m *DropTriggerMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.SqlStatements(dialect))
+}
+
+func (m *DropTriggerMigration) String() string {
+	return fmt.Sprintf("DropTrigger %s ON %s", m.triggerName, m.tableName)
+}
+
+// AddVersionColumnMigration adds a BIGINT column for optimistic locking that
+// a trigger increments on every update of a row, so writers can update with
+// WHERE version = <version read> and detect concurrent changes by the number
+// of affected rows. SQLite can't change NEW and bumps the column with an
+// update after the row was updated, which needs a table with a rowid.
+type AddVersionColumnMigration struct {
+	MigrationBase
+	tableName string
+	column    *Column
+	trigger   bool
+}
+
+func NewAddVersionColumnMigration(table Table, columnName string) *AddVersionColumnMigration {
+	m := &AddVersionColumnMigration{
+		tableName: table.Name,
+		column:    &Column{Name: columnName, Type: DB_BigInt, Nullable: false, Default: "0"},
+		trigger:   true,
+	}
+	m.Condition = &IfColumnNotExistsCondition{TableName: table.Name, ColumnName: columnName}
+	return m
+}
+
+// WithoutTrigger only adds the column, the application then increments it
+// itself, e.g. with SET version = version + 1 WHERE id = ? AND version = ?.
+func (m *AddVersionColumnMigration) WithoutTrigger() *AddVersionColumnMigration {
+	m.trigger = false
+	return m
+}
+
+// TriggerName is the name of the trigger bumping the column, for dropping it
+// with a DropTriggerMigration.
+func (m *AddVersionColumnMigration) TriggerName() string {
+	return fmt.Sprintf("%s_%s_bump", m.tableName, m.column.Name)
+}
+
+func (m *AddVersionColumnMigration) SqlStatements(dialect Dialect) []string {
+	statements := []string{dialect.AddColumnSql(m.tableName, m.column)}
+	if !m.trigger {
+		return statements
+	}
+
+	return append(statements, dialect.IncrementOnUpdateTriggerSql(m.tableName, m.TriggerName(), m.column.Name)...)
+}
+
+func (m *AddVersionColumnMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.SqlStatements(dialect))
+}
+
+func (m *AddVersionColumnMigration) String() string {
+	return fmt.Sprintf("AddVersionColumn %s.%s", m.tableName, m.column.Name)
+}
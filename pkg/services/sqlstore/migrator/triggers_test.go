@@ -0,0 +1,60 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAddVersionColumnMigration(t *testing.T) {
+	Convey("Adding a version column", t, func() {
+		x, mg := newSqliteTestMigrator(t)
+		execTestSql(x,
+			"CREATE TABLE dashboard (id INTEGER PRIMARY KEY, title TEXT)",
+			"INSERT INTO dashboard (title) VALUES ('a'), ('b')",
+		)
+		addVersion := NewAddVersionColumnMigration(Table{Name: "dashboard"}, "version")
+
+		versions := func() []map[string]string {
+			results, err := x.QueryString("SELECT title, version FROM dashboard ORDER BY id")
+			So(err, ShouldBeNil)
+			return results
+		}
+
+		Convey("increments it on every update", func() {
+			mg.AddMigration("add version", addVersion)
+			So(mg.Start(), ShouldBeNil)
+			So(versions(), ShouldResemble, []map[string]string{{"title": "a", "version": "0"}, {"title": "b", "version": "0"}})
+
+			execTestSql(x,
+				"UPDATE dashboard SET title = 'A' WHERE id = 1",
+				"UPDATE dashboard SET title = 'AA' WHERE id = 1",
+			)
+			So(versions(), ShouldResemble, []map[string]string{{"title": "AA", "version": "2"}, {"title": "b", "version": "0"}})
+
+			Convey("until its trigger is dropped", func() {
+				mg.AddMigration("drop version trigger", NewDropTriggerMigration("dashboard", addVersion.TriggerName()))
+				So(mg.Start(), ShouldBeNil)
+				execTestSql(x, "UPDATE dashboard SET title = 'B' WHERE id = 2")
+				So(versions()[1], ShouldResemble, map[string]string{"title": "B", "version": "0"})
+			})
+		})
+
+		Convey("without a trigger leaves it to the application", func() {
+			mg.AddMigration("add version", addVersion.WithoutTrigger())
+			So(mg.Start(), ShouldBeNil)
+			execTestSql(x, "UPDATE dashboard SET title = 'A' WHERE id = 1")
+			So(versions()[0], ShouldResemble, map[string]string{"title": "A", "version": "0"})
+		})
+
+		Convey("bumps it in the row being updated on MySQL and Postgres", func() {
+			sql := addVersion.Sql(NewMysqlDialect(nil))
+			So(sql, ShouldContainSubstring, "BEFORE UPDATE ON `dashboard`")
+			So(sql, ShouldContainSubstring, "SET NEW.`version` = OLD.`version` + 1")
+
+			sql = addVersion.Sql(NewPostgresDialect(nil))
+			So(sql, ShouldContainSubstring, `NEW."version" := OLD."version" + 1`)
+			So(sql, ShouldContainSubstring, `CREATE TRIGGER "dashboard_version_bump" BEFORE UPDATE ON "dashboard" FOR EACH ROW EXECUTE PROCEDURE "dashboard_version_bump_fn"()`)
+		})
+	})
+}
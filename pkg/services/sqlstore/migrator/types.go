@@ -14,11 +14,32 @@ const (
 	MSSQL    = "mssql"
 )
 
+// Transaction isolation levels the migrator can run migrations with, see
+// Migrator.IsolationLevel.
+const (
+	IsolationReadUncommitted = "READ UNCOMMITTED"
+	IsolationReadCommitted   = "READ COMMITTED"
+	IsolationRepeatableRead  = "REPEATABLE READ"
+	IsolationSerializable    = "SERIALIZABLE"
+)
+
+// Migration is a change to the database. Before and After return setup and
+// teardown sql around the change, e.g. disabling a trigger and enabling it
+// again, empty for none. MigrationBase has no hooks.
+//
+// Before runs once the condition of the migration is fulfilled, After once
+// the migration was executed, right before Verify. All three run in the
+// migration's transaction: if any of them fails the migration is rolled back
+// and After doesn't run, except for what MySQL commits implicitly, e.g. DDL.
+// Skipped and deferred migrations run neither hook.
 type Migration interface {
 	Sql(dialect Dialect) string
+	Before(dialect Dialect) string
+	After(dialect Dialect) string
 	Id() string
 	SetId(string)
 	GetCondition() MigrationCondition
+	String() string
 }
 
 type CodeMigration interface {
@@ -26,6 +47,56 @@ type CodeMigration interface {
 	Exec(sess *xorm.Session, migrator *Migrator) error
 }
 
+// CodeMigrationSql is returned by the Sql of code migrations that have no sql
+// of their own to log.
+const CodeMigrationSql = "code migration"
+
+// MultiStatementMigration is implemented by migrations made of several
+// statements, they are executed in order within the migration's transaction.
+type MultiStatementMigration interface {
+	Migration
+	SqlStatements(dialect Dialect) []string
+}
+
+// ValidatingMigration is implemented by migrations that can tell up front
+// that they would fail on the current database. All pending migrations are
+// validated before the first one is executed.
+type ValidatingMigration interface {
+	Migration
+	Validate(migrator *Migrator) error
+}
+
+// VerifyingMigration is implemented by migrations that check their result.
+// Verify is called in the migration's transaction right after the migration
+// was executed, returning an error fails and rolls back the migration.
+type VerifyingMigration interface {
+	Migration
+	Verify(sess *xorm.Session, migrator *Migrator) error
+}
+
+// BatchedMigration is implemented by code migrations processing more rows
+// than one transaction should hold, e.g. deleting old rows of a large table.
+// If its condition is fulfilled, ExecBatches is called before the migration's
+// transaction is started and commits the rows in batches, see
+// ChunkedExec.RunCommittedBatches. The migration then runs as usual, its Exec
+// processing whatever is left, and is only recorded in the migration log once
+// all batches are done. If a batch fails, the batches before it stay
+// committed and the next run picks up the remaining rows.
+type BatchedMigration interface {
+	CodeMigration
+	ExecBatches(migrator *Migrator) error
+}
+
+// ReversibleMigration is implemented by migrations that can undo themselves,
+// see Migrator.Rollback. AddTable, AddColumn, AddIndex and RenameTable
+// migrations derive Down from their own definition. Migrations changing or
+// moving data, dropping objects or running raw sql can't tell what they
+// destroyed and don't implement it.
+type ReversibleMigration interface {
+	Migration
+	Down(sess *xorm.Session, migrator *Migrator) error
+}
+
 type SQLType string
 
 type ColumnType string
@@ -35,10 +106,24 @@ const (
 )
 
 type Table struct {
-	Name        string
-	Columns     []*Column
-	PrimaryKeys []string
-	Indices     []*Index
+	Name          string
+	Columns       []*Column
+	PrimaryKeys   []string
+	Indices       []*Index
+	StorageParams map[string]string
+	// PartitionBy is the partitioning method and key, e.g. RANGE (created).
+	// Only Postgres and MySQL support partitioning.
+	PartitionBy string
+	Comment     string
+}
+
+// IndexDefinition is an index as defined in the database, with the statements
+// dropping it and creating it again exactly as it was, see
+// Dialect.IndexDefinitions.
+type IndexDefinition struct {
+	Name      string
+	CreateSql string
+	DropSql   string
 }
 
 const (
@@ -47,9 +132,13 @@ const (
 )
 
 type Index struct {
-	Name string
-	Type int
-	Cols []string
+	Name          string
+	Type          int
+	Cols          []string
+	StorageParams map[string]string
+	// NullsNotDistinct makes a unique index treat NULLs as equal, so at most
+	// one row may have NULL. Needs Postgres 15.
+	NullsNotDistinct bool
 }
 
 func (index *Index) XName(tableName string) string {
@@ -67,6 +156,176 @@ func (index *Index) XName(tableName string) string {
 	return index.Name
 }
 
+type ForeignKey struct {
+	Name     string
+	Cols     []string
+	RefTable string
+	RefCols  []string
+	OnDelete string
+	OnUpdate string
+
+	// Deferrable foreign keys may be checked at commit rather than after
+	// every statement, InitiallyDeferred makes that the default. MySQL has no
+	// deferrable foreign keys and SQLite only enforces foreign keys at all
+	// with PRAGMA foreign_keys=ON.
+	Deferrable        bool
+	InitiallyDeferred bool
+
+	// NotValid adds the foreign key on Postgres without checking the
+	// existing rows, which a ValidateConstraintMigration checks later
+	// without blocking writes. Other dialects check the rows right away.
+	NotValid bool
+}
+
+// What to do with rows referencing missing rows when adding a foreign key.
+const (
+	OrphansFail    = "fail"
+	OrphansSetNull = "set null"
+	OrphansDelete  = "delete"
+)
+
+// What to do with rows of a merged table whose key is already in the target
+// table, see MergeTablesMigration.
+const (
+	ConflictsFail   = "fail"
+	ConflictsSkip   = "skip"
+	ConflictsUpdate = "update"
+)
+
+func (fk *ForeignKey) XName(tableName string) string {
+	if fk.Name == "" {
+		fk.Name = fmt.Sprintf("FK_%v_%v", tableName, strings.Join(fk.Cols, "_"))
+	}
+	return fk.Name
+}
+
+// Constraint types, as MySQL reports them in the information schema.
+const (
+	ConstraintPrimaryKey = "PRIMARY KEY"
+	ConstraintUnique     = "UNIQUE"
+	ConstraintForeignKey = "FOREIGN KEY"
+	ConstraintCheck      = "CHECK"
+	ConstraintExclude    = "EXCLUDE"
+)
+
+// Constraint is a constraint of a table as read from the database by
+// Dialect.ListConstraints. Type is one of the Constraint* constants, RefTable
+// and RefCols are only set for foreign keys. Cols is empty for check
+// constraints on MySQL.
+type Constraint struct {
+	Name     string
+	Type     string
+	Cols     []string
+	RefTable string
+	RefCols  []string
+}
+
+// PartitionBound are the values of a partition of a partitioned table, either
+// the range From (inclusive) To (exclusive), or the list In. The values are
+// SQL literals, MINVALUE and MAXVALUE mark open ranges. MySQL ranges have no
+// lower bound, a partition starts where the previous one ends.
+type PartitionBound struct {
+	From string
+	To   string
+	In   []string
+}
+
+// CheckConstraint rejects rows for which Expr is false. NotValid works as for
+// foreign keys.
+type CheckConstraint struct {
+	Name     string
+	Expr     string
+	NotValid bool
+}
+
+// ExcludeConstraint is a Postgres exclusion constraint, rejecting rows for
+// which the operators of all elements return true when compared with another
+// row, e.g. overlapping time ranges of the same room. Using defaults to gist.
+type ExcludeConstraint struct {
+	Name     string
+	Using    string
+	Elements []ExcludeElement
+	Where    string
+}
+
+// ExcludeElement compares either a column or an expression with Operator,
+// OpClass optionally sets the operator class used by the index.
+type ExcludeElement struct {
+	Column   string
+	Expr     string
+	OpClass  string
+	Operator string
+}
+
+// DelimitedData describes CSV or TSV rows loaded with Dialect.BulkLoad. The
+// fields of a row are separated by Comma, a comma unless set, and hold the
+// values of Columns in order. Fields may be enclosed in double quotes, quotes
+// within them are doubled. Lines end with \n. Header skips the first line. A
+// field equal to Null, \N unless set, is loaded as NULL.
+type DelimitedData struct {
+	Columns []string
+	Comma   rune
+	Header  bool
+	Null    string
+}
+
+func (d *DelimitedData) comma() rune {
+	if d.Comma == 0 {
+		return ','
+	}
+	return d.Comma
+}
+
+func (d *DelimitedData) null() string {
+	if d.Null == "" {
+		return `\N`
+	}
+	return d.Null
+}
+
+// OnlineDDL asks MySQL to alter a table using the given algorithm and lock,
+// e.g. INPLACE and NONE to keep the table writable while it is altered. An
+// empty field leaves the choice to MySQL. Other engines ignore it.
+type OnlineDDL struct {
+	Algorithm string
+	Lock      string
+}
+
+const (
+	AlgorithmInplace = "INPLACE"
+	AlgorithmCopy    = "COPY"
+
+	LockNone      = "NONE"
+	LockShared    = "SHARED"
+	LockExclusive = "EXCLUSIVE"
+)
+
+// Changes online DDL can be requested for.
+const (
+	DDLAddColumn    = "add column"
+	DDLModifyColumn = "modify column"
+	DDLWidenVarchar = "widen varchar"
+	DDLAddIndex     = "add index"
+	DDLDropIndex    = "drop index"
+)
+
+const (
+	TriggerBefore = "BEFORE"
+	TriggerAfter  = "AFTER"
+
+	TriggerInsert = "INSERT"
+	TriggerUpdate = "UPDATE"
+	TriggerDelete = "DELETE"
+)
+
+// Trigger describes a row level trigger, Timing is one of TriggerBefore or
+// TriggerAfter and Event one of TriggerInsert, TriggerUpdate or TriggerDelete.
+type Trigger struct {
+	Name   string
+	Timing string
+	Event  string
+}
+
 var (
 	DB_Bit       = "BIT"
 	DB_TinyInt   = "TINYINT"
@@ -0,0 +1,330 @@
+package migrator
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/go-xorm/xorm"
+)
+
+// CreateViewMigration creates or replaces a view. The view body can be set
+// per dialect, like the sql of a RawSqlMigration. Note that Postgres can only
+// replace a view when the new body keeps the existing columns.
+type CreateViewMigration struct {
+	MigrationBase
+	viewName string
+	sql      map[string]string
+}
+
+func NewCreateViewMigration(viewName string) *CreateViewMigration {
+	return &CreateViewMigration{viewName: viewName, sql: make(map[string]string)}
+}
+
+func (m *CreateViewMigration) Name(viewName string) *CreateViewMigration {
+	m.viewName = viewName
+	return m
+}
+
+func (m *CreateViewMigration) As(sql string) *CreateViewMigration {
+	m.sql["default"] = sql
+	return m
+}
+
+func (m *CreateViewMigration) Sqlite(sql string) *CreateViewMigration {
+	m.sql[SQLITE] = sql
+	return m
+}
+
+func (m *CreateViewMigration) Mysql(sql string) *CreateViewMigration {
+	m.sql[MYSQL] = sql
+	return m
+}
+
+func (m *CreateViewMigration) Postgres(sql string) *CreateViewMigration {
+	m.sql[POSTGRES] = sql
+	return m
+}
+
+func (m *CreateViewMigration) Validate(mg *Migrator) error {
+	if dialectSql(m.sql).forDialect(mg.Dialect) == "" {
+		return fmt.Errorf("view %s has no definition for %s", m.viewName, mg.Dialect.DriverName())
+	}
+	return nil
+}
+
+func (m *CreateViewMigration) SqlStatements(dialect Dialect) []string {
+	return dialect.CreateViewSql(m.viewName, dialectSql(m.sql).forDialect(dialect))
+}
+
+func (m *CreateViewMigration) Sql(dialect Dialect) string {
+	return joinStatements(m.SqlStatements(dialect))
+}
+
+func (m *CreateViewMigration) String() string {
+	return fmt.Sprintf("CreateView %s", m.viewName)
+}
+
+type DropViewMigration struct {
+	MigrationBase
+	viewName string
+	ifExists bool
+	cascade  bool
+}
+
+func NewDropViewMigration(viewName string) *DropViewMigration {
+	return &DropViewMigration{viewName: viewName}
+}
+
+func (m *DropViewMigration) IfExists() *DropViewMigration {
+	m.ifExists = true
+	return m
+}
+
+// Cascade drops the views depending on the view as well, only Postgres
+// supports it.
+func (m *DropViewMigration) Cascade() *DropViewMigration {
+	m.cascade = true
+	return m
+}
+
+func (m *DropViewMigration) Sql(dialect Dialect) string {
+	return dialect.DropViewSql(m.viewName, m.ifExists, m.cascade)
+}
+
+func (m *DropViewMigration) String() string {
+	return fmt.Sprintf("DropView %s", m.viewName)
+}
+
+// DropViewsMigration drops a group of views, dropping the views depending on
+// other views of the group first. Dependencies are found by looking for the
+// names of the other views in the stored view definitions, views depending on
+// each other in a cycle are dropped in the order given.
+type DropViewsMigration struct {
+	MigrationBase
+	views    []droppedView
+	ifExists bool
+	cascade  bool
+}
+
+type droppedView struct {
+	name         string
+	materialized bool
+	definition   string
+}
+
+func NewDropViewsMigration(viewNames ...string) *DropViewsMigration {
+	m := &DropViewsMigration{}
+	for _, name := range viewNames {
+		m.views = append(m.views, droppedView{name: name})
+	}
+	return m
+}
+
+// MaterializedViews adds Postgres materialized views to the group.
+func (m *DropViewsMigration) MaterializedViews(viewNames ...string) *DropViewsMigration {
+	for _, name := range viewNames {
+		m.views = append(m.views, droppedView{name: name, materialized: true})
+	}
+	return m
+}
+
+func (m *DropViewsMigration) IfExists() *DropViewsMigration {
+	m.ifExists = true
+	return m
+}
+
+// Cascade drops views outside of the group depending on the dropped views as
+// well, only Postgres supports it.
+func (m *DropViewsMigration) Cascade() *DropViewsMigration {
+	m.cascade = true
+	return m
+}
+
+func (m *DropViewsMigration) Validate(mg *Migrator) error {
+	for _, view := range m.views {
+		if view.materialized {
+			if _, err := mg.Dialect.DropMaterializedViewSql(view.name, m.ifExists, m.cascade); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *DropViewsMigration) Sql(dialect Dialect) string {
+	return CodeMigrationSql
+}
+
+func (m *DropViewsMigration) Exec(sess *xorm.Session, mg *Migrator) error {
+	views := []droppedView{}
+	for _, view := range m.views {
+		sql, args := mg.Dialect.ViewDefinitionSql(view.name)
+		if sql != "" {
+			results, err := sess.SQL(sql, args...).Query()
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				if m.ifExists {
+					continue
+				}
+				return fmt.Errorf("view %s does not exist", view.name)
+			}
+			view.definition = string(results[0]["definition"])
+		}
+		views = append(views, view)
+	}
+
+	// a view dropped by an earlier cascade is gone already
+	ifExists := m.ifExists || m.cascade
+
+	for _, view := range orderViewDrops(views) {
+		sql := mg.Dialect.DropViewSql(view.name, ifExists, m.cascade)
+		if view.materialized {
+			var err error
+			if sql, err = mg.Dialect.DropMaterializedViewSql(view.name, ifExists, m.cascade); err != nil {
+				return err
+			}
+		}
+
+		mg.Logger.Debug("Dropping view", "view", view.name, "sql", sql)
+		if _, err := sess.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DropViewsMigration) String() string {
+	return fmt.Sprintf("DropViews (%d views)", len(m.views))
+}
+
+// orderViewDrops orders views so that every view comes before the views its
+// definition mentions.
+func orderViewDrops(views []droppedView) []droppedView {
+	ordered := make([]droppedView, 0, len(views))
+	remaining := append([]droppedView{}, views...)
+
+	for len(remaining) > 0 {
+		next := -1
+		for i, view := range remaining {
+			if !viewIsReferenced(view, remaining) {
+				next = i
+				break
+			}
+		}
+		// a cycle, keep the given order
+		if next == -1 {
+			return append(ordered, remaining...)
+		}
+
+		ordered = append(ordered, remaining[next])
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return ordered
+}
+
+func viewIsReferenced(view droppedView, views []droppedView) bool {
+	pattern := regexp.MustCompile(`(?i)(^|[^a-z0-9_$])` + regexp.QuoteMeta(view.name) + `($|[^a-z0-9_$])`)
+	for _, other := range views {
+		if other.name != view.name && pattern.MatchString(other.definition) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateMaterializedViewMigration creates a Postgres materialized view, other
+// dialects fail validation.
+type CreateMaterializedViewMigration struct {
+	MigrationBase
+	viewName string
+	sql      string
+}
+
+func NewCreateMaterializedViewMigration(viewName string, sql string) *CreateMaterializedViewMigration {
+	return &CreateMaterializedViewMigration{viewName: viewName, sql: sql}
+}
+
+func (m *CreateMaterializedViewMigration) Validate(mg *Migrator) error {
+	_, err := mg.Dialect.CreateMaterializedViewSql(m.viewName, m.sql)
+	return err
+}
+
+func (m *CreateMaterializedViewMigration) Sql(dialect Dialect) string {
+	sql, _ := dialect.CreateMaterializedViewSql(m.viewName, m.sql)
+	return sql
+}
+
+func (m *CreateMaterializedViewMigration) String() string {
+	return fmt.Sprintf("CreateMaterializedView %s", m.viewName)
+}
+
+// RefreshMaterializedViewMigration refreshes a Postgres materialized view.
+// A concurrent refresh doesn't block reads of the view, but requires a unique
+// index on the view covering all rows (no WHERE clause, no expressions) and
+// the view to be populated already.
+type RefreshMaterializedViewMigration struct {
+	MigrationBase
+	viewName     string
+	concurrently bool
+}
+
+func NewRefreshMaterializedViewMigration(viewName string) *RefreshMaterializedViewMigration {
+	return &RefreshMaterializedViewMigration{viewName: viewName}
+}
+
+func (m *RefreshMaterializedViewMigration) Concurrently() *RefreshMaterializedViewMigration {
+	m.concurrently = true
+	return m
+}
+
+func (m *RefreshMaterializedViewMigration) Validate(mg *Migrator) error {
+	_, err := mg.Dialect.RefreshMaterializedViewSql(m.viewName, m.concurrently)
+	return err
+}
+
+func (m *RefreshMaterializedViewMigration) Sql(dialect Dialect) string {
+	sql, _ := dialect.RefreshMaterializedViewSql(m.viewName, m.concurrently)
+	return sql
+}
+
+func (m *RefreshMaterializedViewMigration) String() string {
+	return fmt.Sprintf("RefreshMaterializedView %s", m.viewName)
+}
+
+type DropMaterializedViewMigration struct {
+	MigrationBase
+	viewName string
+	ifExists bool
+	cascade  bool
+}
+
+func NewDropMaterializedViewMigration(viewName string) *DropMaterializedViewMigration {
+	return &DropMaterializedViewMigration{viewName: viewName}
+}
+
+func (m *DropMaterializedViewMigration) IfExists() *DropMaterializedViewMigration {
+	m.ifExists = true
+	return m
+}
+
+// Cascade drops the views depending on the view as well.
+func (m *DropMaterializedViewMigration) Cascade() *DropMaterializedViewMigration {
+	m.cascade = true
+	return m
+}
+
+func (m *DropMaterializedViewMigration) Validate(mg *Migrator) error {
+	_, err := mg.Dialect.DropMaterializedViewSql(m.viewName, m.ifExists, m.cascade)
+	return err
+}
+
+func (m *DropMaterializedViewMigration) Sql(dialect Dialect) string {
+	sql, _ := dialect.DropMaterializedViewSql(m.viewName, m.ifExists, m.cascade)
+	return sql
+}
+
+func (m *DropMaterializedViewMigration) String() string {
+	return fmt.Sprintf("DropMaterializedView %s", m.viewName)
+}
@@ -0,0 +1,45 @@
+package migrator
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOrderViewDrops(t *testing.T) {
+	Convey("Ordering views to drop", t, func() {
+		names := func(views []droppedView) []string {
+			result := []string{}
+			for _, view := range views {
+				result = append(result, view.name)
+			}
+			return result
+		}
+
+		Convey("drops views before the views they select from", func() {
+			views := []droppedView{
+				{name: "dashboard_base", definition: "SELECT id, title FROM dashboard"},
+				{name: "dashboard_titles", definition: "SELECT title FROM dashboard_base"},
+				{name: "dashboard_summary", definition: "SELECT count(*) FROM \"dashboard_titles\" JOIN dashboard_base ON 1 = 1"},
+			}
+			So(names(orderViewDrops(views)), ShouldResemble, []string{"dashboard_summary", "dashboard_titles", "dashboard_base"})
+		})
+
+		Convey("matches whole names only", func() {
+			views := []droppedView{
+				{name: "dashboard", definition: "SELECT 1"},
+				{name: "dashboard_v2", definition: "SELECT id FROM dashboard_tag"},
+			}
+			So(names(orderViewDrops(views)), ShouldResemble, []string{"dashboard", "dashboard_v2"})
+		})
+
+		Convey("keeps the given order for views in a cycle", func() {
+			views := []droppedView{
+				{name: "independent", definition: "SELECT 1"},
+				{name: "a", definition: "SELECT * FROM b"},
+				{name: "b", definition: "SELECT * FROM a"},
+			}
+			So(names(orderViewDrops(views)), ShouldResemble, []string{"independent", "a", "b"})
+		})
+	})
+}
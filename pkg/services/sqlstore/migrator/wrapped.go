@@ -0,0 +1,51 @@
+package migrator
+
+import (
+	"github.com/go-xorm/xorm"
+)
+
+// wrappedMigration is embedded by migrations running another migration with
+// a setting of the session changed, such as LockTimeoutMigration, or under
+// other rules, such as RepeatableMigration. Validation and verification are
+// left to the wrapped migration.
+type wrappedMigration struct {
+	Migration
+}
+
+func (m *wrappedMigration) Validate(mg *Migrator) error {
+	if validatingMigration, ok := m.Migration.(ValidatingMigration); ok {
+		return validatingMigration.Validate(mg)
+	}
+	return nil
+}
+
+func (m *wrappedMigration) Verify(sess *xorm.Session, mg *Migrator) error {
+	if verifyingMigration, ok := m.Migration.(VerifyingMigration); ok {
+		return verifyingMigration.Verify(sess, mg)
+	}
+	return nil
+}
+
+// execWrapped runs the statements or the code of the wrapped migration.
+func (m *wrappedMigration) execWrapped(sess *xorm.Session, mg *Migrator) error {
+	return mg.execMigration(m.Migration, mg.statements(m.Migration), sess)
+}
+
+// withSessionSetting runs fn after set changed a setting of the session and
+// executes the statement set returned to change it back afterwards, also when
+// fn fails.
+func withSessionSetting(sess *xorm.Session, set func() (string, error), fn func() error) (err error) {
+	restore, err := set()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// a failed Postgres transaction rejects the statement, its SET LOCAL
+		// ends with the rollback anyway
+		if _, restoreErr := sess.Exec(restore); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}()
+
+	return fn()
+}
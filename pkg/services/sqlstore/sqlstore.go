@@ -136,6 +136,7 @@ func (ss *SqlStore) Init() error {
 	dialect = ss.Dialect
 
 	migrator := migrator.NewMigrator(x)
+	migrator.IsolationLevel = ss.dbCfg.MigrationIsolationLevel
 	migrations.AddMigrations(migrator)
 
 	for _, descriptor := range registry.GetServices() {
@@ -339,6 +340,8 @@ func (ss *SqlStore) readConfig() {
 	ss.dbCfg.Path = sec.Key("path").MustString("data/grafana.db")
 
 	ss.dbCfg.CacheMode = sec.Key("cache_mode").MustString("private")
+
+	ss.dbCfg.MigrationIsolationLevel = sec.Key("migration_isolation_level").String()
 }
 
 func InitTestDB(t *testing.T) *SqlStore {
@@ -428,4 +431,6 @@ type DatabaseConfig struct {
 	ConnMaxLifetime  int
 	CacheMode        string
 	UrlQueryParams   map[string][]string
+
+	MigrationIsolationLevel string
 }